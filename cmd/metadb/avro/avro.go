@@ -0,0 +1,49 @@
+// Package avro decodes Kafka messages written by the Kafka Connect Avro
+// converter, using schemas stored in a Confluent Schema Registry.
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Decoder decodes messages in the Confluent wire format, which consists of a
+// zero byte, a four-byte schema ID, and the Avro binary encoded data.
+type Decoder struct {
+	registry *Registry
+}
+
+func NewDecoder(registryURL string) *Decoder {
+	return &Decoder{registry: NewRegistry(registryURL)}
+}
+
+// Decode converts a message key or value to the JSON format produced by the
+// Kafka Connect JSON converter with schemas enabled, i.e. an object
+// containing "schema" and "payload".
+func (d *Decoder) Decode(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("avro: message too short")
+	}
+	if data[0] != 0 {
+		return nil, fmt.Errorf("avro: unknown magic byte %d", data[0])
+	}
+	id := int32(binary.BigEndian.Uint32(data[1:5]))
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, fmt.Errorf("avro: %w", err)
+	}
+	payload, err := decodeValue(&reader{b: data[5:]}, schema)
+	if err != nil {
+		return nil, fmt.Errorf("avro: schema ID %d: %w", id, err)
+	}
+	cs, err := connectSchema(schema, false)
+	if err != nil {
+		return nil, fmt.Errorf("avro: schema ID %d: %w", id, err)
+	}
+	b, err := json.Marshal(map[string]any{"schema": cs, "payload": payload})
+	if err != nil {
+		return nil, fmt.Errorf("avro: schema ID %d: %w", id, err)
+	}
+	return b, nil
+}
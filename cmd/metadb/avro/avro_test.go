@@ -0,0 +1,189 @@
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+const testKeySchema = `{"type": "record", "name": "Key", "namespace": "db.public.t",
+  "fields": [{"name": "id", "type": "int"}], "connect.name": "db.public.t.Key"}`
+
+const testValueSchema = `{"type": "record", "name": "Envelope", "namespace": "db.public.t",
+  "fields": [
+    {"name": "before", "type": ["null", {"type": "record", "name": "Value", "fields": [
+      {"name": "id", "type": "int"},
+      {"name": "amount", "type": ["null", {"type": "bytes", "scale": 2, "precision": 10,
+        "connect.version": 1, "connect.parameters": {"scale": "2", "connect.decimal.precision": "10"},
+        "connect.name": "org.apache.kafka.connect.data.Decimal", "logicalType": "decimal"}], "default": null},
+      {"name": "name", "type": ["null", "string"], "default": null}],
+      "connect.name": "db.public.t.Value"}], "default": null},
+    {"name": "after", "type": ["null", "Value"], "default": null},
+    {"name": "source", "type": {"type": "record", "name": "Source", "namespace": "io.debezium.connector.postgresql",
+      "fields": [
+        {"name": "ts_ms", "type": "long"},
+        {"name": "snapshot", "type": ["null", "string"]},
+        {"name": "schema", "type": "string"},
+        {"name": "table", "type": "string"}]}},
+    {"name": "op", "type": "string"},
+    {"name": "ts_ms", "type": ["null", "long"], "default": null}],
+  "connect.name": "db.public.t.Envelope"}`
+
+type encoder []byte
+
+func (e encoder) long(v int64) encoder {
+	return binary.AppendUvarint(e, uint64((v<<1)^(v>>63)))
+}
+
+func (e encoder) bytes(b []byte) encoder {
+	return append(e.long(int64(len(b))), b...)
+}
+
+func (e encoder) string(s string) encoder {
+	return e.bytes([]byte(s))
+}
+
+func message(id int32, e encoder) []byte {
+	b := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return append(b, e...)
+}
+
+func registryStub(t *testing.T) *httptest.Server {
+	schemas := map[string]string{"1": testKeySchema, "2": testValueSchema}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := schemas[r.URL.Path[len("/schemas/ids/"):]]
+		if !ok {
+			http.Error(w, `{"error_code": 40403, "message": "Schema not found"}`, http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"schema": s}); err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestDecodeChangeEvent(t *testing.T) {
+	registry := registryStub(t)
+	defer registry.Close()
+
+	key := message(1, encoder{}.long(42))
+	value := encoder{}.
+		long(0).                                        // before: null
+		long(1).long(42).long(1).bytes([]byte{4, 210}). // after: id, amount
+		long(1).string("abc").
+		long(1700000000000).long(1).string("false"). // source
+		string("public").string("t").
+		string("c").                // op
+		long(1).long(1700000000001) // ts_ms
+	topic := "db.public.t"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Key:            key,
+		Value:          message(2, value),
+	}
+
+	ce, err := change.NewEvent(msg, NewDecoder(registry.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, _, err := command.NewCommand(log.NewMessageSet(), ce, &command.SourceOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SchemaName != "public" || cmd.TableName != "t" || cmd.Op != command.MergeOp {
+		t.Fatalf("got %s.%s %v; want public.t merge", cmd.SchemaName, cmd.TableName, cmd.Op)
+	}
+	want := map[string]string{"id": "42", "amount": "12.34", "name": "abc"}
+	for _, col := range cmd.Column {
+		if col.SQLData == nil || *col.SQLData != want[col.Name] {
+			t.Errorf("column %q: got %v; want %v", col.Name, col.SQLData, want[col.Name])
+		}
+		if col.Name == "id" && col.PrimaryKey != 1 {
+			t.Errorf("column %q: got primary key %d; want 1", col.Name, col.PrimaryKey)
+		}
+	}
+	if len(cmd.Column) != len(want) {
+		t.Errorf("got %d columns; want %d", len(cmd.Column), len(want))
+	}
+}
+
+func TestDecodeUnknownSchema(t *testing.T) {
+	registry := registryStub(t)
+	defer registry.Close()
+
+	_, err := NewDecoder(registry.URL).Decode(message(3, encoder{}.long(1)))
+	if err == nil {
+		t.Fatal("expected error for unknown schema ID")
+	}
+	var rerr *RegistryError
+	if errors.As(err, &rerr) {
+		t.Errorf("unknown schema ID reported as registry failure: %v", err)
+	}
+}
+
+func TestDecodeRegistryFailure(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer registry.Close()
+
+	topic := "db.public.t"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Key:            message(1, encoder{}.long(42)),
+		Value:          message(2, encoder{}.long(0)),
+	}
+	_, err := change.NewEvent(msg, NewDecoder(registry.URL))
+	var rerr *RegistryError
+	if !errors.As(err, &rerr) {
+		t.Errorf("got %v; want registry failure", err)
+	}
+}
+
+func TestRegistryReadsSchemaOnce(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		if err := json.NewEncoder(w).Encode(map[string]string{"schema": testKeySchema}); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer registry.Close()
+
+	r := NewRegistry(registry.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Schema(1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// A cached schema is returned while another is being read.
+	r.mu.Lock()
+	r.schemas[2] = &Schema{}
+	r.mu.Unlock()
+	if _, err := r.Schema(2); err != nil {
+		t.Error(err)
+	}
+	close(release)
+	wg.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests; want 1", n)
+	}
+}
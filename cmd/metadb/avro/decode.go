@@ -0,0 +1,283 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var errShortBuffer = errors.New("unexpected end of data")
+
+type reader struct {
+	b []byte
+}
+
+func (r *reader) long() (int64, error) {
+	u, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errShortBuffer
+	}
+	r.b = r.b[n:]
+	// Zigzag decoding
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *reader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b) {
+		return nil, errShortBuffer
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.next(int(n))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+// decodeValue reads a value of schema s in Avro binary encoding.  The result
+// uses Go types that encode to JSON in the same way as the Kafka Connect JSON
+// converter: records and maps become map[string]any, bytes become []byte
+// (base64 in JSON), and union values are not wrapped.
+func decodeValue(r *reader, s *Schema) (any, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		return r.long()
+	case "float":
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		return r.bytes()
+	case "string":
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case "fixed":
+		b, err := r.next(s.Size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.Symbols) {
+			return nil, fmt.Errorf("enum %q: index %d out of range", s.Name, i)
+		}
+		return s.Symbols[i], nil
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.Branches) {
+			return nil, fmt.Errorf("union: index %d out of range", i)
+		}
+		return decodeValue(r, s.Branches[i])
+	case "record":
+		m := make(map[string]any, len(s.Fields))
+		for _, f := range s.Fields {
+			v, err := decodeValue(r, f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.Name, f.Name, err)
+			}
+			m[f.Name] = v
+		}
+		return m, nil
+	case "array":
+		a := make([]any, 0)
+		err := readBlocks(r, func() error {
+			v, err := decodeValue(r, s.Items)
+			if err != nil {
+				return err
+			}
+			a = append(a, v)
+			return nil
+		})
+		return a, err
+	case "map":
+		m := make(map[string]any)
+		err := readBlocks(r, func() error {
+			k, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := decodeValue(r, s.Values)
+			if err != nil {
+				return err
+			}
+			m[string(k)] = v
+			return nil
+		})
+		return m, err
+	default:
+		return nil, fmt.Errorf("unsupported type %q", s.Type)
+	}
+}
+
+// readBlocks reads the blocks of an array or map, calling item for each item.
+func readBlocks(r *reader, item func() error) error {
+	for {
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if n < 0 {
+			// A negative count is followed by the block size in bytes.
+			n = -n
+			if _, err = r.long(); err != nil {
+				return err
+			}
+		}
+		for i := int64(0); i < n; i++ {
+			if err = item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// connectSchema converts an Avro schema written by the Kafka Connect Avro
+// converter back to the schema format of the Kafka Connect JSON converter.
+func connectSchema(s *Schema, optional bool) (map[string]any, error) {
+	if s.Type == "union" {
+		var branch *Schema
+		for _, b := range s.Branches {
+			if b.Type == "null" {
+				optional = true
+				continue
+			}
+			if branch != nil {
+				return nil, fmt.Errorf("unsupported union of more than one non-null type")
+			}
+			branch = b
+		}
+		if branch == nil {
+			return nil, fmt.Errorf("unsupported union of null type only")
+		}
+		return connectSchema(branch, optional)
+	}
+	c := map[string]any{"optional": optional}
+	switch s.Type {
+	case "boolean", "string", "bytes":
+		c["type"] = s.Type
+	case "int":
+		c["type"] = "int32"
+		if t, ok := s.Props["connect.type"].(string); ok {
+			c["type"] = t
+		}
+	case "long":
+		c["type"] = "int64"
+	case "float":
+		c["type"] = "float"
+	case "double":
+		c["type"] = "float64"
+	case "fixed":
+		c["type"] = "bytes"
+	case "enum":
+		c["type"] = "string"
+	case "array":
+		items, err := connectSchema(s.Items, false)
+		if err != nil {
+			return nil, err
+		}
+		c["type"] = "array"
+		c["items"] = items
+	case "map":
+		values, err := connectSchema(s.Values, false)
+		if err != nil {
+			return nil, err
+		}
+		c["type"] = "map"
+		c["keys"] = map[string]any{"type": "string", "optional": false}
+		c["values"] = values
+	case "record":
+		fields := make([]any, 0, len(s.Fields))
+		for _, f := range s.Fields {
+			fc, err := connectSchema(f.Type, false)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			fc["field"] = f.Name
+			fields = append(fields, fc)
+		}
+		c["type"] = "struct"
+		c["fields"] = fields
+		c["name"] = s.Name
+	default:
+		return nil, fmt.Errorf("unsupported type %q", s.Type)
+	}
+	// Semantic type
+	if name, ok := s.Props["connect.name"].(string); ok {
+		c["name"] = name
+	} else if name = logicalTypeName(s); name != "" {
+		c["name"] = name
+	}
+	if v, ok := s.Props["connect.version"]; ok {
+		c["version"] = v
+	}
+	if p, ok := s.Props["connect.parameters"].(map[string]any); ok {
+		c["parameters"] = p
+	} else if s.Props["logicalType"] == "decimal" {
+		scale, _ := s.Props["scale"].(float64)
+		c["parameters"] = map[string]any{"scale": strconv.Itoa(int(scale))}
+	}
+	return c, nil
+}
+
+// logicalTypeName returns the Kafka Connect semantic type that corresponds to
+// an Avro logical type, for schemas that do not specify "connect.name".
+func logicalTypeName(s *Schema) string {
+	switch s.Props["logicalType"] {
+	case "decimal":
+		return "org.apache.kafka.connect.data.Decimal"
+	case "date":
+		return "org.apache.kafka.connect.data.Date"
+	case "time-millis":
+		return "org.apache.kafka.connect.data.Time"
+	case "time-micros":
+		return "io.debezium.time.MicroTime"
+	case "timestamp-millis":
+		return "org.apache.kafka.connect.data.Timestamp"
+	case "timestamp-micros":
+		return "io.debezium.time.MicroTimestamp"
+	case "uuid":
+		return "io.debezium.data.Uuid"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,125 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry is a client for a Confluent Schema Registry.  Schemas are
+// immutable once registered, and so they are cached by ID.
+type Registry struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	schemas map[int32]*Schema
+	pending map[int32]*pendingSchema
+}
+
+// RegistryError is a failure to read a schema from the registry, such as a
+// network error or an error status returned by the registry, which may be
+// resolved by retrying.  It does not indicate that the message being decoded
+// is invalid.
+type RegistryError struct {
+	Err error
+}
+
+func (e *RegistryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// pendingSchema is a schema being read from the registry.  The result is
+// available when done is closed.
+type pendingSchema struct {
+	done   chan struct{}
+	schema *Schema
+	err    error
+}
+
+// NewRegistry returns a client for the registry at url.  Basic
+// authentication credentials may be included in the URL.
+func NewRegistry(url string) *Registry {
+	return &Registry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		schemas: make(map[int32]*Schema),
+		pending: make(map[int32]*pendingSchema),
+	}
+}
+
+// Schema returns the schema with the specified ID.  The lock is not held
+// while the schema is read from the registry, so that cached schemas remain
+// available; concurrent requests for the same schema wait for a single read.
+func (r *Registry) Schema(id int32) (*Schema, error) {
+	r.mu.Lock()
+	if s, ok := r.schemas[id]; ok {
+		r.mu.Unlock()
+		return s, nil
+	}
+	if p, ok := r.pending[id]; ok {
+		r.mu.Unlock()
+		<-p.done
+		return p.schema, p.err
+	}
+	p := &pendingSchema{done: make(chan struct{})}
+	r.pending[id] = p
+	r.mu.Unlock()
+
+	p.schema, p.err = r.fetch(id)
+
+	r.mu.Lock()
+	delete(r.pending, id)
+	if p.err == nil {
+		r.schemas[id] = p.schema
+	}
+	r.mu.Unlock()
+	close(p.done)
+	return p.schema, p.err
+}
+
+func (r *Registry) fetch(id int32) (*Schema, error) {
+	url := r.url + "/schemas/ids/" + strconv.FormatInt(int64(id), 10)
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return nil, &RegistryError{Err: fmt.Errorf("reading schema ID %d from registry: %w", id, err)}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &RegistryError{Err: fmt.Errorf("reading schema ID %d from registry: %w", id, err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("reading schema ID %d from registry: %s: %s", id, resp.Status,
+			strings.TrimSpace(string(body)))
+		// A schema ID that is not found is a property of the
+		// message, which cannot be decoded.
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, err
+		}
+		return nil, &RegistryError{Err: err}
+	}
+	var rs struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err = json.Unmarshal(body, &rs); err != nil {
+		return nil, fmt.Errorf("reading schema ID %d from registry: %w", id, err)
+	}
+	if rs.SchemaType != "" && rs.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema ID %d has unsupported type %q", id, rs.SchemaType)
+	}
+	s, err := ParseSchema(rs.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema ID %d: %w", id, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,162 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema is a parsed Avro schema.  Named types (record, enum, fixed) may be
+// referenced more than once within a schema, in which case the same *Schema
+// is shared.
+type Schema struct {
+	// Type is a primitive type name or one of "record", "enum", "array",
+	// "map", "union", or "fixed".
+	Type string
+	// Name is the full name of a named type.
+	Name     string
+	Fields   []Field
+	Symbols  []string
+	Items    *Schema
+	Values   *Schema
+	Branches []*Schema
+	Size     int
+	// Props contains other attributes of the schema, such as
+	// "logicalType" or "connect.name".
+	Props map[string]any
+}
+
+type Field struct {
+	Name string
+	Type *Schema
+}
+
+// ParseSchema parses an Avro schema in JSON format.
+func ParseSchema(s string) (*Schema, error) {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	return parseNode(v, "", make(map[string]*Schema))
+}
+
+func isPrimitive(t string) bool {
+	switch t {
+	case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+		return true
+	default:
+		return false
+	}
+}
+
+func parseNode(v any, namespace string, names map[string]*Schema) (*Schema, error) {
+	switch n := v.(type) {
+	case string:
+		if isPrimitive(n) {
+			return &Schema{Type: n}, nil
+		}
+		if s, ok := names[fullName(n, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := names[n]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("parsing schema: unknown type %q", n)
+	case []any:
+		s := &Schema{Type: "union", Branches: make([]*Schema, 0, len(n))}
+		for _, b := range n {
+			bs, err := parseNode(b, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, bs)
+		}
+		return s, nil
+	case map[string]any:
+		return parseComplex(n, namespace, names)
+	default:
+		return nil, fmt.Errorf("parsing schema: unexpected %T", v)
+	}
+}
+
+func parseComplex(m map[string]any, namespace string, names map[string]*Schema) (*Schema, error) {
+	t, ok := m["type"].(string)
+	if !ok {
+		// The type is itself a schema, e.g. {"type": {"type": "string"}}.
+		return parseNode(m["type"], namespace, names)
+	}
+	s := &Schema{Type: t, Props: make(map[string]any)}
+	for k, v := range m {
+		switch k {
+		case "type", "name", "namespace", "fields", "symbols", "items", "values", "size", "aliases", "doc":
+		default:
+			s.Props[k] = v
+		}
+	}
+	switch t {
+	case "record", "error", "enum", "fixed":
+		name, _ := m["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("parsing schema: %s without name", t)
+		}
+		if ns, ok := m["namespace"].(string); ok {
+			namespace = ns
+		}
+		s.Name = fullName(name, namespace)
+		if i := strings.LastIndexByte(s.Name, '.'); i >= 0 {
+			namespace = s.Name[:i]
+		}
+		// Register the name before parsing fields, which may refer to it.
+		names[s.Name] = s
+	}
+	switch t {
+	case "record", "error":
+		s.Type = "record"
+		fields, _ := m["fields"].([]any)
+		for _, f := range fields {
+			fm, ok := f.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("parsing schema: record %q: invalid field", s.Name)
+			}
+			fname, _ := fm["name"].(string)
+			ftype, err := parseNode(fm["type"], namespace, names)
+			if err != nil {
+				return nil, fmt.Errorf("record %q: field %q: %w", s.Name, fname, err)
+			}
+			s.Fields = append(s.Fields, Field{Name: fname, Type: ftype})
+		}
+	case "enum":
+		symbols, _ := m["symbols"].([]any)
+		for _, sym := range symbols {
+			str, _ := sym.(string)
+			s.Symbols = append(s.Symbols, str)
+		}
+	case "array":
+		items, err := parseNode(m["items"], namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	case "map":
+		values, err := parseNode(m["values"], namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		s.Values = values
+	case "fixed":
+		size, _ := m["size"].(float64)
+		s.Size = int(size)
+	default:
+		if !isPrimitive(t) {
+			return parseNode(t, namespace, names)
+		}
+	}
+	return s, nil
+}
+
+func fullName(name, namespace string) string {
+	if strings.ContainsRune(name, '.') || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
@@ -0,0 +1,62 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// initAuditColumns reads the list of tables that have the columns __op and
+// __source_position, which record how and where in the source each row was
+// ended.
+func (c *Catalog) initAuditColumns() error {
+	q := "SELECT m.schema_name, m.table_name " +
+		"FROM metadb.base_table AS m " +
+		"JOIN pg_class AS t ON m.table_name||'__' = t.relname " +
+		"JOIN pg_namespace AS ns ON m.schema_name = ns.nspname AND t.relnamespace = ns.oid " +
+		"JOIN pg_attribute AS a ON t.oid = a.attrelid " +
+		"WHERE t.relkind IN ('r', 'p') AND a.attname = '__op' AND NOT a.attisdropped"
+	rows, err := c.dp.Query(context.TODO(), q)
+	if err != nil {
+		return fmt.Errorf("selecting audit columns: %w", err)
+	}
+	defer rows.Close()
+	auditColumns := make(map[dbx.Table]struct{})
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			return fmt.Errorf("reading audit columns: %w", err)
+		}
+		auditColumns[dbx.Table{Schema: schema, Table: table}] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading audit columns: %w", err)
+	}
+	c.auditColumns = auditColumns
+	return nil
+}
+
+// AuditColumns returns true if the table has the columns __op and
+// __source_position.
+func (c *Catalog) AuditColumns(table *dbx.Table) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.auditColumns[*table]
+	return ok
+}
+
+// AddAuditColumns adds the columns __op and __source_position to a table.
+func (c *Catalog) AddAuditColumns(tx *Tx, table *dbx.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := "ALTER TABLE " + table.MainSQL() + " ADD COLUMN IF NOT EXISTS __op varchar(8), " +
+		"ADD COLUMN IF NOT EXISTS __source_position text"
+	if _, err := c.queryable(tx).Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("adding audit columns to table %q: %w", table.Main(), err)
+	}
+	t := *table
+	c.auditColumns[t] = struct{}{}
+	tx.onRollback(func() { delete(c.auditColumns, t) })
+	return nil
+}
@@ -0,0 +1,41 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeadLetter is a change event that could not be parsed.
+type DeadLetter struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Error     string
+}
+
+// WriteDeadLetter stores a change event in the dead-letter table.  It returns
+// false if the event had already been stored.
+func (c *Catalog) WriteDeadLetter(source string, d *DeadLetter) (bool, error) {
+	q := "INSERT INTO " + catalogSchema + ".dead_letter" +
+		"(source_name,topic,partition,\"offset\",key,value,error)" +
+		"VALUES($1,$2,$3,$4,$5,$6,$7)" +
+		"ON CONFLICT (source_name,topic,partition,\"offset\") DO NOTHING"
+	tag, err := c.dp.Exec(context.TODO(), q, source, d.Topic, d.Partition, d.Offset, d.Key, d.Value, d.Error)
+	if err != nil {
+		return false, fmt.Errorf("writing to "+catalogSchema+".dead_letter: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CountDeadLetters returns the number of change events for a source in the
+// dead-letter table.
+func (c *Catalog) CountDeadLetters(source string) (int64, error) {
+	var n int64
+	q := "SELECT count(*) FROM " + catalogSchema + ".dead_letter WHERE source_name=$1"
+	if err := c.dp.QueryRow(context.TODO(), q, source).Scan(&n); err != nil {
+		return 0, fmt.Errorf("reading from "+catalogSchema+".dead_letter: %w", err)
+	}
+	return n, nil
+}
@@ -93,19 +93,21 @@ SELECT table_schema, table_name, column_name
 	return nil
 }
 
-func (c *Catalog) AddIndex(column *dbx.Column) error {
+func (c *Catalog) AddIndex(tx *Tx, column *dbx.Column) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.addIndex(column)
+	return c.addIndex(tx, column)
 }
 
-func (c *Catalog) addIndex(column *dbx.Column) error {
+func (c *Catalog) addIndex(tx *Tx, column *dbx.Column) error {
 	// Create index.
 	q := "CREATE INDEX ON \"" + column.Schema + "\".\"" + column.Table + "__\" (\"" + column.Column + "\")"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := c.queryable(tx).Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating index: %w", err)
 	}
-	c.indexes[*column] = struct{}{}
+	col := *column
+	c.indexes[col] = struct{}{}
+	tx.onRollback(func() { delete(c.indexes, col) })
 	return nil
 }
 
@@ -25,7 +25,9 @@ type Catalog struct {
 	users              map[string]*util.RegexList
 	columns            map[dbx.Column]string
 	indexes            map[dbx.Column]struct{}
-	lastSnapshotRecord time.Time
+	auditColumns       map[dbx.Table]struct{}
+	lastSnapshotRecord map[string]time.Time
+	snapshotInit       time.Time
 	dp                 *pgxpool.Pool
 	lz4                bool
 }
@@ -66,6 +68,9 @@ func Initialize(db *dbx.DB, dp *pgxpool.Pool) (*Catalog, error) {
 	if err := c.initIndexes(); err != nil {
 		return nil, err
 	}
+	if err := c.initAuditColumns(); err != nil {
+		return nil, err
+	}
 	c.initSnapshot()
 	c.lz4 = isLZ4Available(c.dp)
 
@@ -138,6 +143,9 @@ var systemTables = []systemTableDef{
 	{table: dbx.Table{Schema: catalogSchema, Table: "source"}, create: createTableSource},
 	{table: dbx.Table{Schema: catalogSchema, Table: "table_update"}, create: createTableUpdate},
 	{table: dbx.Table{Schema: catalogSchema, Table: "base_table"}, create: createTableBaseTable},
+	{table: dbx.Table{Schema: catalogSchema, Table: "dead_letter"}, create: CreateTableDeadLetter},
+	{table: dbx.Table{Schema: catalogSchema, Table: "kafka_offset"}, create: CreateTableKafkaOffset},
+	{table: dbx.Table{Schema: catalogSchema, Table: "pg_snapshot"}, create: CreateTablePGSnapshot},
 }
 
 //func SystemTables() []dbx.Table {
@@ -214,16 +222,11 @@ func createTableLog(tx pgx.Tx) error {
 
 func createTableMaintenance(tx pgx.Tx) error {
 	q := "CREATE TABLE " + catalogSchema + ".maintenance (" +
+		"source_name varchar(63) PRIMARY KEY, " +
 		"next_maintenance_time timestamptz)"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return err
 	}
-	q = "INSERT INTO " + catalogSchema + ".maintenance " +
-		"(next_maintenance_time) VALUES " +
-		"(CURRENT_DATE::timestamptz + INTERVAL '1 day' + INTERVAL '3 hours')"
-	if _, err := tx.Exec(context.TODO(), q); err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -250,6 +253,33 @@ func createTableSource(tx pgx.Tx) error {
 		"trimschemaprefix text, " +
 		"addschemaprefix text, " +
 		"module text, " +
+		"format text, " +
+		"schemaregistry text, " +
+		"concurrency integer, " +
+		"syncconcurrency integer, " +
+		"saslmechanism text, " +
+		"saslusername text, " +
+		"saslpassword text, " +
+		"sslca text, " +
+		"sslcert text, " +
+		"sslkey text, " +
+		"deadletter boolean, " +
+		"transactions boolean, " +
+		"type text, " +
+		"connection text, " +
+		"publication text, " +
+		"slot text, " +
+		"schemarename text, " +
+		"tablerename text, " +
+		"renamepreset text, " +
+		"columnrules text, " +
+		"columnhashkey text, " +
+		"rowfilters text, " +
+		"tablekeys text, " +
+		"fullrowkey boolean, " +
+		"auditcolumns boolean, " +
+		"retention text, " +
+		"retentionarchive boolean, " +
 		"sync smallint NOT NULL DEFAULT 1)"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating table "+catalogSchema+".source: %w", err)
@@ -285,6 +315,53 @@ func createTableBaseTable(tx pgx.Tx) error {
 	return nil
 }
 
+// CreateTableDeadLetter creates the table used to store change events that
+// could not be parsed.
+func CreateTableDeadLetter(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".dead_letter (" +
+		"source_name varchar(63) NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"\"offset\" bigint NOT NULL, " +
+		"PRIMARY KEY (source_name, topic, partition, \"offset\"), " +
+		"key bytea, " +
+		"value bytea, " +
+		"error text NOT NULL, " +
+		"received timestamptz NOT NULL DEFAULT now())"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".dead_letter: %w", err)
+	}
+	return nil
+}
+
+// CreateTableKafkaOffset creates the table used to store the Kafka offsets of
+// change events that have been written to the database.
+func CreateTableKafkaOffset(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".kafka_offset (" +
+		"source_name varchar(63) NOT NULL, " +
+		"consumer_group text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"PRIMARY KEY (source_name, consumer_group, topic, partition), " +
+		"\"offset\" bigint NOT NULL)"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".kafka_offset: %w", err)
+	}
+	return nil
+}
+
+// CreateTablePGSnapshot creates the table used to record that the initial
+// snapshot of a PostgreSQL data source has been written.
+func CreateTablePGSnapshot(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".pg_snapshot (" +
+		"source_name varchar(63) PRIMARY KEY, " +
+		"slot_name text NOT NULL)"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".pg_snapshot: %w", err)
+	}
+	return nil
+}
+
 func (c *Catalog) TableUpdatedNow(table dbx.Table, elapsedTime time.Duration) error {
 	realtime := float32(math.Round(elapsedTime.Seconds()*10000) / 10000)
 	u := catalogSchema + ".table_update"
@@ -0,0 +1,19 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+)
+
+// InitMaintenance schedules maintenance for a data source, if it has not
+// already been scheduled.  Maintenance is first scheduled for 03:00 on the
+// following day.
+func (c *Catalog) InitMaintenance(source string) error {
+	q := "INSERT INTO " + catalogSchema + ".maintenance (source_name, next_maintenance_time) " +
+		"VALUES ($1, CURRENT_DATE::timestamptz + INTERVAL '1 day' + INTERVAL '3 hours') " +
+		"ON CONFLICT (source_name) DO NOTHING"
+	if _, err := c.dp.Exec(context.TODO(), q, source); err != nil {
+		return fmt.Errorf("scheduling maintenance for source %q: %w", source, err)
+	}
+	return nil
+}
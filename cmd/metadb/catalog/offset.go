@@ -0,0 +1,69 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TopicPartition identifies a Kafka partition.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// WriteKafkaOffsets stores the offsets of the next change events to be read
+// from Kafka partitions, as part of the transaction tx that writes the
+// preceding change events.  An offset is not replaced by a lower offset, which
+// may be written by a consumer that has lost its partitions in a rebalance.
+func WriteKafkaOffsets(ctx context.Context, tx pgx.Tx, source, group string, offsets map[TopicPartition]int64) error {
+	q := "INSERT INTO " + catalogSchema + ".kafka_offset" +
+		"(source_name,consumer_group,topic,partition,\"offset\")" +
+		"VALUES($1,$2,$3,$4,$5)" +
+		"ON CONFLICT (source_name,consumer_group,topic,partition) DO UPDATE " +
+		"SET \"offset\"=greatest(" + catalogSchema + ".kafka_offset.\"offset\",excluded.\"offset\")"
+	// Write in a fixed order to prevent deadlock between consumers.
+	tps := make([]TopicPartition, 0, len(offsets))
+	for tp := range offsets {
+		tps = append(tps, tp)
+	}
+	sort.Slice(tps, func(i, j int) bool {
+		if tps[i].Topic != tps[j].Topic {
+			return tps[i].Topic < tps[j].Topic
+		}
+		return tps[i].Partition < tps[j].Partition
+	})
+	for _, tp := range tps {
+		if _, err := tx.Exec(ctx, q, source, group, tp.Topic, tp.Partition, offsets[tp]); err != nil {
+			return fmt.Errorf("writing to "+catalogSchema+".kafka_offset: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadKafkaOffsets returns the stored offsets of the next change events to be
+// read by a data source and consumer group.
+func (c *Catalog) ReadKafkaOffsets(source, group string) (map[TopicPartition]int64, error) {
+	q := "SELECT topic,partition,\"offset\" FROM " + catalogSchema + ".kafka_offset " +
+		"WHERE source_name=$1 AND consumer_group=$2"
+	rows, err := c.dp.Query(context.TODO(), q, source, group)
+	if err != nil {
+		return nil, fmt.Errorf("reading from "+catalogSchema+".kafka_offset: %w", err)
+	}
+	defer rows.Close()
+	offsets := make(map[TopicPartition]int64)
+	for rows.Next() {
+		var tp TopicPartition
+		var offset int64
+		if err := rows.Scan(&tp.Topic, &tp.Partition, &offset); err != nil {
+			return nil, fmt.Errorf("reading from "+catalogSchema+".kafka_offset: %w", err)
+		}
+		offsets[tp] = offset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading from "+catalogSchema+".kafka_offset: %w", err)
+	}
+	return offsets, nil
+}
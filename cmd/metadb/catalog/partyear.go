@@ -3,9 +3,17 @@ package catalog
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 )
 
+// removePartLockTimeout limits the time spent waiting for other sessions,
+// such as user queries, in order to detach a history partition.
+const removePartLockTimeout = "10s"
+
 func (c *Catalog) initPartYears() error {
 	q := "SELECT t.schema_name||'.'||t.table_name currenttable," +
 		"i.inhrelid::regclass yeartable " +
@@ -45,7 +53,7 @@ func (c *Catalog) initPartYears() error {
 	return nil
 }
 
-func (c *Catalog) AddPartYear(schema, table string, year int) error {
+func (c *Catalog) AddPartYear(tx *Tx, schema, table string, year int) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	// Add partition in database.
@@ -56,7 +64,7 @@ func (c *Catalog) AddPartYear(schema, table string, year int) error {
 	q := "CREATE TABLE " + nctableYear +
 		" PARTITION OF " + nctable +
 		" FOR VALUES FROM ('" + yearStr + "-01-01') TO ('" + nextYearStr + "-01-01')"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := c.queryable(tx).Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating partition: %w", err)
 	}
 	// Update the cache.
@@ -67,6 +75,7 @@ func (c *Catalog) AddPartYear(schema, table string, year int) error {
 		c.partYears[schemaTable] = p
 	}
 	p[year] = struct{}{}
+	tx.onRollback(func() { delete(p, year) })
 	return nil
 }
 
@@ -84,3 +93,108 @@ func (c *Catalog) partYearExists(schema, table string, year int) bool {
 	_, ok := p[year]
 	return ok
 }
+
+// PartYears returns the years of the history partitions of a table, in
+// ascending order.
+func (c *Catalog) PartYears(schema, table string) []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var years []int
+	for y := range c.partYears[schema+"."+table] {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	return years
+}
+
+// RemovePartYear detaches the history partition of a table for a year,
+// provided that all of its rows ended before cutoff and no current row
+// started in or before that year, and reports whether it was removed.  A
+// current row is moved into the history partition for the year in which it
+// started when it is ended, and so that partition must remain.  The partition is then dropped or, if archive is set, retained
+// as a separate table with the suffix "_archive", followed by a number if
+// that name is already in use.  The catalog is not locked while the partition
+// is detached, and waiting for locks held by other sessions is limited by
+// removePartLockTimeout.
+func (c *Catalog) RemovePartYear(schema, table string, year int, cutoff time.Time, archive bool) (bool, error) {
+	yearStr := strconv.Itoa(year)
+	nctable := "\"" + schema + "\".\"zzz___" + table + "___\""
+	nctableYear := "\"" + schema + "\".\"zzz___" + table + "___" + yearStr + "\""
+	tx, err := c.dp.Begin(context.TODO())
+	if err != nil {
+		return false, fmt.Errorf("removing partition: %w", err)
+	}
+	defer dbx.Rollback(tx)
+	if _, err = tx.Exec(context.TODO(), "SET LOCAL lock_timeout='"+removePartLockTimeout+"'"); err != nil {
+		return false, fmt.Errorf("removing partition: %w", err)
+	}
+	// Current rows are locked against changes until the partition has
+	// been removed.
+	currentTable := "\"" + schema + "\".\"" + table + "\""
+	if _, err = tx.Exec(context.TODO(), "LOCK TABLE "+currentTable+" IN SHARE MODE"); err != nil {
+		return false, fmt.Errorf("locking table: %w", err)
+	}
+	var current bool
+	q := "SELECT EXISTS (SELECT FROM " + currentTable + " WHERE __start<'" + strconv.Itoa(year+1) + "-01-01')"
+	if err = tx.QueryRow(context.TODO(), q).Scan(&current); err != nil {
+		return false, fmt.Errorf("reading current rows: %w", err)
+	}
+	if current {
+		return false, nil
+	}
+	q = "ALTER TABLE " + nctable + " DETACH PARTITION " + nctableYear
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return false, fmt.Errorf("detaching partition: %w", err)
+	}
+	// Rows are partitioned by __start, but a row may have ended in a
+	// later year.  The check is made after the partition has been
+	// detached, so that no rows can be changed concurrently.
+	var end *time.Time
+	q = "SELECT max(__end) FROM " + nctableYear
+	if err = tx.QueryRow(context.TODO(), q).Scan(&end); err != nil {
+		return false, fmt.Errorf("reading partition: %w", err)
+	}
+	if end != nil && !end.Before(cutoff) {
+		return false, nil
+	}
+	if archive {
+		name, err := archiveTableName(tx, schema, "zzz___"+table+"___"+yearStr+"_archive")
+		if err != nil {
+			return false, fmt.Errorf("archiving partition: %w", err)
+		}
+		q = "ALTER TABLE " + nctableYear + " RENAME TO \"" + name + "\""
+	} else {
+		q = "DROP TABLE " + nctableYear
+	}
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return false, fmt.Errorf("removing partition: %w", err)
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return false, fmt.Errorf("removing partition: %w", err)
+	}
+	// Update the cache.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.partYears[schema+"."+table], year)
+	return true, nil
+}
+
+// archiveTableName returns name, or if a table with that name exists in the
+// schema, name followed by the first number that is not in use.
+func archiveTableName(dq dbx.Queryable, schema, name string) (string, error) {
+	q := "SELECT EXISTS (SELECT FROM pg_class c JOIN pg_namespace n ON c.relnamespace=n.oid " +
+		"WHERE n.nspname=$1 AND c.relname=$2)"
+	for i := 1; ; i++ {
+		n := name
+		if i > 1 {
+			n = name + "_" + strconv.Itoa(i)
+		}
+		var exists bool
+		if err := dq.QueryRow(context.TODO(), q, schema, n).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// TestRemovePartYearCurrentRow requires a PostgreSQL database, which is given
+// by the connection string in the environment variable
+// METADB_TEST_DATABASE.  The schema metadb_test_partyear is created and
+// dropped.
+func TestRemovePartYearCurrentRow(t *testing.T) {
+	connString := os.Getenv("METADB_TEST_DATABASE")
+	if connString == "" {
+		t.Skip("METADB_TEST_DATABASE not set")
+	}
+	ctx := context.TODO()
+	dp, err := dbx.NewPool(ctx, connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dp.Close()
+	const schema = "metadb_test_partyear"
+	exec := func(q string) {
+		t.Helper()
+		if _, err := dp.Exec(ctx, q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+	exec("CREATE SCHEMA " + schema)
+	defer func() {
+		_, _ = dp.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+	}()
+	exec("CREATE TABLE " + schema + ".t__ (__id bigint GENERATED BY DEFAULT AS IDENTITY, " +
+		"__start timestamptz NOT NULL, __end timestamptz NOT NULL, __current boolean NOT NULL, " +
+		"__origin varchar(63) NOT NULL DEFAULT '', id integer) PARTITION BY LIST (__current)")
+	exec("CREATE TABLE " + schema + ".t PARTITION OF " + schema + ".t__ FOR VALUES IN (TRUE)")
+	exec("CREATE TABLE " + schema + ".zzz___t___ PARTITION OF " + schema + ".t__ FOR VALUES IN (FALSE) " +
+		"PARTITION BY RANGE (__start)")
+	c := &Catalog{dp: dp, partYears: make(map[string]map[int]struct{})}
+	if err = c.AddPartYear(nil, schema, "t", 2018); err != nil {
+		t.Fatal(err)
+	}
+	exec("INSERT INTO " + schema + ".t__ (__start, __end, __current, id) VALUES " +
+		"('2018-01-01', '2018-02-01', FALSE, 1), ('2018-02-01', '9999-12-31', TRUE, 1)")
+
+	// All history in 2018 ended before the cutoff, but the current row
+	// started in 2018.
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	removed, err := c.RemovePartYear(schema, "t", 2018, cutoff, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed {
+		t.Fatal("partition with current row: got removed; want kept")
+	}
+	// Ending the current row moves it into the partition for 2018.
+	exec("UPDATE " + schema + ".t__ SET __end='2024-06-01', __current=FALSE WHERE __current AND id=1")
+
+	if removed, err = c.RemovePartYear(schema, "t", 2018, cutoff, false); err != nil {
+		t.Fatal(err)
+	}
+	if !removed {
+		t.Error("partition without current rows: got kept; want removed")
+	}
+	if c.PartYearExists(schema, "t", 2018) {
+		t.Error("removed partition still in catalog")
+	}
+}
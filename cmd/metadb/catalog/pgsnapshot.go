@@ -0,0 +1,48 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WriteSnapshotComplete records that the initial snapshot read from the
+// replication slot of a PostgreSQL data source has been written, as part of
+// the transaction tx that writes the last rows of the snapshot.
+func WriteSnapshotComplete(ctx context.Context, tx pgx.Tx, source, slot string) error {
+	q := "INSERT INTO " + catalogSchema + ".pg_snapshot(source_name,slot_name)VALUES($1,$2)" +
+		"ON CONFLICT (source_name) DO UPDATE SET slot_name=excluded.slot_name"
+	if _, err := tx.Exec(ctx, q, source, slot); err != nil {
+		return fmt.Errorf("writing to "+catalogSchema+".pg_snapshot: %w", err)
+	}
+	return nil
+}
+
+// SnapshotComplete returns true if the initial snapshot read from a
+// replication slot has been written.
+func (c *Catalog) SnapshotComplete(source, slot string) (bool, error) {
+	q := "SELECT 1 FROM " + catalogSchema + ".pg_snapshot WHERE source_name=$1 AND slot_name=$2"
+	var i int
+	err := c.dp.QueryRow(context.TODO(), q, source, slot).Scan(&i)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("reading from "+catalogSchema+".pg_snapshot: %w", err)
+	default:
+		return true, nil
+	}
+}
+
+// ClearSnapshotComplete removes the record that the initial snapshot of a
+// data source has been written.  It is called before a new replication slot
+// is created.
+func (c *Catalog) ClearSnapshotComplete(source string) error {
+	q := "DELETE FROM " + catalogSchema + ".pg_snapshot WHERE source_name=$1"
+	if _, err := c.dp.Exec(context.TODO(), q, source); err != nil {
+		return fmt.Errorf("deleting from "+catalogSchema+".pg_snapshot: %w", err)
+	}
+	return nil
+}
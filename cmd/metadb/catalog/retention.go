@@ -0,0 +1,81 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+)
+
+// RetentionRule defines the number of years of history to keep for tables
+// whose schema-qualified names match Table, or for all tables if Table is
+// nil.
+type RetentionRule struct {
+	Table *regexp.Regexp
+	Years int
+}
+
+// ParseRetentionRules compiles a list of retention rules, each in the form
+// "table_regexp years" or "years".
+func ParseRetentionRules(rules []string) ([]RetentionRule, error) {
+	var rr []RetentionRule
+	for _, r := range rules {
+		f := strings.Fields(r)
+		var years int
+		var err error
+		if len(f) == 1 || len(f) == 2 {
+			years, err = strconv.Atoi(f[len(f)-1])
+		}
+		if len(f) < 1 || len(f) > 2 || err != nil || years < 1 {
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid retention rule %q", r),
+				Hint: "A retention rule has the form 'table_regexp years' or 'years', where years is a positive integer.",
+			}
+		}
+		var re *regexp.Regexp
+		if len(f) == 2 {
+			if re, err = regexp.Compile(f[0]); err != nil {
+				return nil, fmt.Errorf("invalid retention rule %q: %w", r, err)
+			}
+		}
+		rr = append(rr, RetentionRule{Table: re, Years: years})
+	}
+	return rr, nil
+}
+
+// MatchRetention returns the number of years of history to keep for a table,
+// as defined by the first matching rule, or 0 if there is none, in which case
+// the history is kept indefinitely.
+func MatchRetention(rules []RetentionRule, schema, table string) int {
+	name := schema + "." + table
+	for _, r := range rules {
+		if r.Table == nil || r.Table.MatchString(name) {
+			return r.Years
+		}
+	}
+	return 0
+}
+
+// RetentionCutoff returns the beginning of a retention period of a number of
+// years ending at now.  History that ended before the cutoff may be removed.
+func RetentionCutoff(now time.Time, years int) time.Time {
+	return now.UTC().AddDate(-years, 0, 0)
+}
+
+// PrunableYears returns the years, from an ascending list of history
+// partition years, whose partitions contain only rows that started before
+// cutoff.  Such a partition can be removed if all of its rows also ended
+// before cutoff.
+func PrunableYears(years []int, cutoff time.Time) []int {
+	var p []int
+	for _, y := range years {
+		if time.Date(y+1, 1, 1, 0, 0, 0, 0, time.UTC).After(cutoff) {
+			break
+		}
+		p = append(p, y)
+	}
+	return p
+}
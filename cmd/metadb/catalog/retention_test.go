@@ -0,0 +1,50 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrunableYears(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	cutoff := RetentionCutoff(now, 5)
+	if want := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC); !cutoff.Equal(want) {
+		t.Errorf("cutoff: got %v; want %v", cutoff, want)
+	}
+	// The partition for 2020 may still contain rows that ended after
+	// the cutoff, but it is a candidate; the partition for 2021 contains
+	// rows that started after the cutoff.
+	got := PrunableYears([]int{2018, 2019, 2020, 2021, 2022}, cutoff)
+	if want := []int{2018, 2019, 2020}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	got = PrunableYears([]int{2020}, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	if want := []int{2020}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cutoff at year boundary: got %v; want %v", got, want)
+	}
+	if got = PrunableYears([]int{2021, 2022}, cutoff); got != nil {
+		t.Errorf("got %v; want none", got)
+	}
+}
+
+func TestMatchRetention(t *testing.T) {
+	rules, err := ParseRetentionRules([]string{`^folio_circulation\.loan 10`, `5`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MatchRetention(rules, "folio_circulation", "loan__t"); got != 10 {
+		t.Errorf("got %d; want 10", got)
+	}
+	if got := MatchRetention(rules, "folio_users", "users"); got != 5 {
+		t.Errorf("got %d; want 5", got)
+	}
+	if got := MatchRetention(rules[:1], "folio_users", "users"); got != 0 {
+		t.Errorf("got %d; want 0", got)
+	}
+	for _, r := range []string{"", "0", "five", "a b c", "( 5"} {
+		if _, err := ParseRetentionRules([]string{r}); err == nil {
+			t.Errorf("expected error for retention rule %q", r)
+		}
+	}
+}
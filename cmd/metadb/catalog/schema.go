@@ -41,11 +41,14 @@ func (c *Catalog) initSchema() error {
 func getColumnSchemas(dp *pgxpool.Pool) ([]*sqlx.ColumnSchema, error) {
 	cs := make([]*sqlx.ColumnSchema, 0)
 	rows, err := dp.Query(context.TODO(), ""+
-		"SELECT table_schema, left(table_name, -2) table_name, column_name, data_type, character_maximum_length "+
+		"SELECT table_schema, left(table_name, -2) table_name, column_name, "+
+		"CASE WHEN data_type = 'ARRAY' THEN substr(udt_name, 2) || '[]' ELSE data_type END data_type, "+
+		"character_maximum_length "+
 		"FROM information_schema.columns "+
 		"WHERE lower(table_schema) NOT IN ('information_schema', 'pg_catalog')"+
 		" AND right(table_name, 2) = '__'"+
-		" AND lower(column_name) NOT IN ('__id', '__start', '__end', '__current', '__origin');")
+		" AND lower(column_name) NOT IN ('__id', '__start', '__end', '__current', '__origin', '__op',"+
+		" '__source_position');")
 	if err != nil {
 		return nil, fmt.Errorf("querying database schema: %s", err)
 	}
@@ -78,14 +81,23 @@ func getColumnSchemas(dp *pgxpool.Pool) ([]*sqlx.ColumnSchema, error) {
 	return cs, nil
 }
 
-func (c *Catalog) UpdateColumn(column *dbx.Column, dataType string) {
+func (c *Catalog) UpdateColumn(tx *Tx, column *dbx.Column, dataType string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	updateColumn(c, column, dataType)
+	updateColumn(c, tx, column, dataType)
 }
 
-func updateColumn(cat *Catalog, column *dbx.Column, dataType string) {
-	cat.columns[*column] = dataType
+func updateColumn(cat *Catalog, tx *Tx, column *dbx.Column, dataType string) {
+	col := *column
+	old, ok := cat.columns[col]
+	tx.onRollback(func() {
+		if ok {
+			cat.columns[col] = old
+		} else {
+			delete(cat.columns, col)
+		}
+	})
+	cat.columns[col] = dataType
 }
 
 func (c *Catalog) DeleteColumn(column *dbx.Column) {
@@ -128,28 +140,28 @@ func (c *Catalog) Column(column *dbx.Column) *string {
 	return nil
 }
 
-func (c *Catalog) AddColumn(table *dbx.Table, columnName string, newType command.DataType, newTypeSize int64) error {
+func (c *Catalog) AddColumn(tx *Tx, table *dbx.Table, columnName string, newType command.DataType, newTypeSize int64) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	// Alter table schema in database.
 	dataTypeSQL := command.DataTypeToSQL(newType, newTypeSize)
 	q := "ALTER TABLE " + table.MainSQL() + " ADD COLUMN \"" + columnName + "\" " + dataTypeSQL
-	if c.lz4 && (newType == command.TextType || newType == command.JSONType) {
+	if c.lz4 && (newType == command.TextType || newType == command.JSONType || newType == command.ByteaType) {
 		q = q + " COMPRESSION lz4"
 	}
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := c.queryable(tx).Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("adding column %q in table %q: alter table: %v", columnName, table, err)
 	}
 	// Create index if type is uuid.
 	if newType == command.UUIDType {
 		column := &dbx.Column{Schema: table.Schema, Table: table.Table, Column: columnName}
 		if !c.indexExists(column) {
-			if err := c.addIndex(column); err != nil {
+			if err := c.addIndex(tx, column); err != nil {
 				return err
 			}
 		}
 	}
 	// Update schema.
-	updateColumn(c, &dbx.Column{Schema: table.Schema, Table: table.Table, Column: columnName}, dataTypeSQL)
+	updateColumn(c, tx, &dbx.Column{Schema: table.Schema, Table: table.Table, Column: columnName}, dataTypeSQL)
 	return nil
 }
@@ -5,21 +5,27 @@ import (
 )
 
 func (c *Catalog) initSnapshot() {
-	c.reset()
+	c.snapshotInit = time.Now()
+	c.lastSnapshotRecord = make(map[string]time.Time)
 }
 
-func (c *Catalog) ResetLastSnapshotRecord() {
+// ResetLastSnapshotRecord records that a snapshot record has been read from
+// a data source.
+func (c *Catalog) ResetLastSnapshotRecord(source string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.reset()
+	c.lastSnapshotRecord[source] = time.Now()
 }
 
-func (c *Catalog) reset() {
-	c.lastSnapshotRecord = time.Now()
-}
-
-func (c *Catalog) HoursSinceLastSnapshotRecord() float64 {
+// HoursSinceLastSnapshotRecord returns the time elapsed since a snapshot
+// record was last read from a data source, or since the catalog was
+// initialized if no snapshot record has been read.
+func (c *Catalog) HoursSinceLastSnapshotRecord(source string) float64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return time.Since(c.lastSnapshotRecord).Hours()
+	t, ok := c.lastSnapshotRecord[source]
+	if !ok {
+		t = c.snapshotInit
+	}
+	return time.Since(t).Hours()
 }
@@ -0,0 +1,47 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// CreateTableFunctions creates or replaces the point-in-time query functions
+// of a table:  table__asof(t) returns the rows that were current at time t,
+// and table__changes(t1, t2) returns the row versions that started or ended
+// at or after t1 and before t2.  Access to the functions is revoked from
+// PUBLIC, so that they can be granted together with the table.  The functions
+// are not created if the table name is too long for the function names (see
+// dbx.Table.HasFuncs), which callers are expected to report.
+func CreateTableFunctions(dq dbx.Queryable, table *dbx.Table) error {
+	if !table.HasFuncs() {
+		return nil
+	}
+	for _, q := range tableFunctionsSQL(table) {
+		if _, err := dq.Exec(context.TODO(), q); err != nil {
+			return fmt.Errorf("creating point-in-time query functions of %q: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// tableFunctionsSQL returns the statements that create the point-in-time
+// query functions of a table.
+func tableFunctionsSQL(table *dbx.Table) []string {
+	mainTable := table.MainSQL()
+	asof := table.AsOfFuncSQL()
+	changes := table.ChangesFuncSQL()
+	// Parameters are referred to by position, because a parameter name could
+	// be hidden by a column of the same name.
+	return []string{
+		"CREATE OR REPLACE FUNCTION " + asof + " RETURNS SETOF " + mainTable +
+			" AS $$ SELECT * FROM " + mainTable + " WHERE __start<=$1 AND __end>$1 $$" +
+			" LANGUAGE SQL STABLE",
+		"CREATE OR REPLACE FUNCTION " + changes + " RETURNS SETOF " + mainTable +
+			" AS $$ SELECT * FROM " + mainTable +
+			" WHERE (__start>=$1 AND __start<$2) OR (__end>=$1 AND __end<$2) ORDER BY __start, __id $$" +
+			" LANGUAGE SQL STABLE",
+		table.RevokeFuncsSQL("PUBLIC"),
+	}
+}
@@ -0,0 +1,40 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestTableFunctionsSQL(t *testing.T) {
+	table := &dbx.Table{Schema: "sensor", Table: "air_temp"}
+	want := []string{
+		`CREATE OR REPLACE FUNCTION "sensor"."air_temp__asof"(timestamptz) RETURNS SETOF "sensor"."air_temp__"` +
+			` AS $$ SELECT * FROM "sensor"."air_temp__" WHERE __start<=$1 AND __end>$1 $$ LANGUAGE SQL STABLE`,
+		`CREATE OR REPLACE FUNCTION "sensor"."air_temp__changes"(timestamptz, timestamptz) RETURNS SETOF` +
+			` "sensor"."air_temp__" AS $$ SELECT * FROM "sensor"."air_temp__"` +
+			` WHERE (__start>=$1 AND __start<$2) OR (__end>=$1 AND __end<$2) ORDER BY __start, __id $$` +
+			` LANGUAGE SQL STABLE`,
+		`REVOKE EXECUTE ON FUNCTION "sensor"."air_temp__asof"(timestamptz),` +
+			` "sensor"."air_temp__changes"(timestamptz, timestamptz) FROM PUBLIC`,
+	}
+	got := tableFunctionsSQL(table)
+	if len(got) != len(want) {
+		t.Fatalf("got %d statements; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %s; want %s", got[i], want[i])
+		}
+	}
+}
+
+func TestCreateTableFunctionsLongName(t *testing.T) {
+	// The functions are skipped without using the connection, which is
+	// nil.
+	table := &dbx.Table{Schema: "sensor", Table: strings.Repeat("t", 55)}
+	if err := CreateTableFunctions(nil, table); err != nil {
+		t.Errorf("got %v; want nil", err)
+	}
+}
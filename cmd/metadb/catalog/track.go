@@ -70,28 +70,36 @@ func tableExists(c *Catalog, table *dbx.Table) bool {
 //	return addTableEntry(c, true, table, transformed, parentTable)
 //}
 
-func addTableEntry(c *Catalog, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
-	c.updateCacheTableEntry(table, transformed, parentTable)
-	if err := insertIntoTableTrack(c, table, transformed, parentTable, source); err != nil {
+func addTableEntry(c *Catalog, tx *Tx, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
+	c.updateCacheTableEntry(tx, table, transformed, parentTable, source)
+	if err := insertIntoTableTrack(c, tx, table, transformed, parentTable, source); err != nil {
 		return fmt.Errorf("updating catalog in database for table %q: %v", table, err)
 	}
 	return nil
 }
 
-func insertIntoTableTrack(c *Catalog, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
+func insertIntoTableTrack(c *Catalog, tx *Tx, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
 	q := "INSERT INTO " + catalogSchema +
 		".base_table(schema_name,table_name,source_name,transformed,parent_schema_name,parent_table_name)VALUES($1,$2,$3,$4,$5,$6)"
-	_, err := c.dp.Exec(context.TODO(), q, table.Schema, table.Table, source, transformed, parentTable.Schema, parentTable.Table)
+	_, err := c.queryable(tx).Exec(context.TODO(), q, table.Schema, table.Table, source, transformed, parentTable.Schema, parentTable.Table)
 	if err != nil {
 		return fmt.Errorf("inserting catalog entry for table: %q: %s", table, err)
 	}
 	return nil
 }
 
-func (c *Catalog) updateCacheTableEntry(table *dbx.Table, transformed bool, parentTable *dbx.Table) {
+func (c *Catalog) updateCacheTableEntry(tx *Tx, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) {
 	// If table exists, retain its children map.
 	var children map[dbx.Table]struct{}
 	t, ok := c.tableDir[*table]
+	tbl := *table
+	tx.onRollback(func() {
+		if ok {
+			c.tableDir[tbl] = t
+		} else {
+			delete(c.tableDir, tbl)
+		}
+	})
 	if ok {
 		children = t.children
 	} else {
@@ -101,15 +109,26 @@ func (c *Catalog) updateCacheTableEntry(table *dbx.Table, transformed bool, pare
 		transformed: transformed,
 		parentTable: *parentTable,
 		children:    children,
+		source:      source,
 	}
 	if parentTable.Schema != "" && parentTable.Table != "" {
 		// In case the parent table entry has not yet been created, we create a stub where we can store
 		// the children map.
-		_, ok := c.tableDir[*parentTable]
+		parent := *parentTable
+		p, ok := c.tableDir[parent]
 		if !ok {
-			c.tableDir[*parentTable] = tableEntry{children: make(map[dbx.Table]struct{})}
+			p = tableEntry{children: make(map[dbx.Table]struct{})}
+			c.tableDir[parent] = p
 		}
-		c.tableDir[*parentTable].children[*table] = struct{}{}
+		_, child := p.children[tbl]
+		tx.onRollback(func() {
+			if !ok {
+				delete(c.tableDir, parent)
+			} else if !child {
+				delete(p.children, tbl)
+			}
+		})
+		p.children[tbl] = struct{}{}
 	}
 }
 
@@ -163,16 +182,20 @@ func findDescendantTables(tableDir map[dbx.Table]tableEntry, table dbx.Table, de
 }
 */
 
-func (c *Catalog) CreateNewTable(table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
+// CreateNewTable creates a table within the transaction tx, or outside of a
+// transaction if tx is nil.  The schema, if it is created, is committed
+// immediately, so that it can be shared by tables created in concurrent
+// transactions.
+func (c *Catalog) CreateNewTable(tx *Tx, table *dbx.Table, transformed bool, parentTable *dbx.Table, source string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if err := createSchemaIfNotExists(c, table); err != nil {
 		return fmt.Errorf("creating new table %q: %v", table, err)
 	}
-	if err := createMainTableIfNotExists(c, table); err != nil {
+	if err := createMainTableIfNotExists(c, tx, table); err != nil {
 		return fmt.Errorf("creating new table %q: %v", table, err)
 	}
-	if err := addTableEntry(c, table, transformed, parentTable, source); err != nil {
+	if err := addTableEntry(c, tx, table, transformed, parentTable, source); err != nil {
 		return fmt.Errorf("creating new table %q: %v", table, err)
 	}
 	return nil
@@ -192,7 +215,8 @@ func createSchemaIfNotExists(c *Catalog, table *dbx.Table) error {
 	return nil
 }
 
-func createMainTableIfNotExists(c *Catalog, table *dbx.Table) error {
+func createMainTableIfNotExists(c *Catalog, tx *Tx, table *dbx.Table) error {
+	dq := c.queryable(tx)
 	q := "CREATE TABLE IF NOT EXISTS " + table.MainSQL() + " (" +
 		"__id bigint GENERATED BY DEFAULT AS IDENTITY, " +
 		"__start timestamp with time zone NOT NULL, " +
@@ -200,37 +224,50 @@ func createMainTableIfNotExists(c *Catalog, table *dbx.Table) error {
 		"__current boolean NOT NULL, " +
 		"__origin varchar(63) NOT NULL DEFAULT ''" +
 		") PARTITION BY LIST (__current)"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating partitioned table %q: %v", table.Main(), err)
 	}
 	q = "CREATE TABLE IF NOT EXISTS " + table.SQL() + " PARTITION OF " + table.MainSQL() + " FOR VALUES IN (TRUE)"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating partition %q: %v", table, err)
 	}
 	partition := "zzz___" + table.Table + "___"
 	nctable := "\"" + table.Schema + "\".\"" + partition + "\""
 	q = "CREATE TABLE IF NOT EXISTS " + nctable + " PARTITION OF " + table.MainSQL() + " FOR VALUES IN (FALSE) " +
 		"PARTITION BY RANGE (__start)"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating partition %q: %v", table.Schema+"."+partition, err)
 	}
+	if table.HasFuncs() {
+		if err := CreateTableFunctions(dq, table); err != nil {
+			return err
+		}
+	} else {
+		log.Warning("table name %q too long for point-in-time query functions; skipping functions", table)
+	}
 	// Grant permissions on new tables.
 	for _, u := range usersWithPerm(c, table) {
-		if _, err := c.dp.Exec(context.TODO(), "GRANT SELECT ON "+table.MainSQL()+" TO "+u+""); err != nil {
+		if _, err := dq.Exec(context.TODO(), "GRANT SELECT ON "+table.MainSQL()+" TO "+u+""); err != nil {
 			return fmt.Errorf("granting select privilege on %q to %q: %v", table.Main(), u, err)
 		}
-		if _, err := c.dp.Exec(context.TODO(), "GRANT SELECT ON "+table.SQL()+" TO "+u+""); err != nil {
+		if _, err := dq.Exec(context.TODO(), "GRANT SELECT ON "+table.SQL()+" TO "+u+""); err != nil {
 			return fmt.Errorf("granting select privilege on %q to %q: %v", table, u, err)
 		}
+		if !table.HasFuncs() {
+			continue
+		}
+		if _, err := dq.Exec(context.TODO(), table.GrantFuncsSQL(u)); err != nil {
+			return fmt.Errorf("granting execute privilege on functions of %q to %q: %v", table, u, err)
+		}
 	}
 	q = "CREATE INDEX ON " + table.MainSQL() + " (__id)"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating index on table %q column \"__id\": %v", table.Main(), err)
 	}
 	// Create sync table.
 	synctsql := SyncTable(table).SQL()
 	q = "CREATE TABLE " + synctsql + " (__id bigint)"
-	if _, err := c.dp.Exec(context.TODO(), q); err != nil {
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating sync table for %q: %v", table, err)
 	}
 	return nil
@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// Tx is a database transaction in which data and schema changes are written
+// together.  Changes to the catalog made within the transaction are reverted
+// if it is rolled back, so that the catalog continues to match the database.
+type Tx struct {
+	pgx.Tx
+	c    *Catalog
+	undo []func()
+}
+
+// Begin starts a transaction.
+func (c *Catalog) Begin(ctx context.Context) (*Tx, error) {
+	tx, err := c.dp.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, c: c}, nil
+}
+
+// Commit commits the transaction.  If the commit fails, changes to the
+// catalog are reverted.
+func (t *Tx) Commit(ctx context.Context) error {
+	if err := t.Tx.Commit(ctx); err != nil {
+		t.revert()
+		return err
+	}
+	t.undo = nil
+	return nil
+}
+
+// Rollback rolls back the transaction and reverts changes to the catalog.  It
+// has no effect if the transaction has already been committed.
+func (t *Tx) Rollback(ctx context.Context) error {
+	err := t.Tx.Rollback(ctx)
+	t.revert()
+	return err
+}
+
+func (t *Tx) revert() {
+	if len(t.undo) == 0 {
+		return
+	}
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
+// onRollback registers a function that reverts a change to the catalog.  It
+// is called with c.mu held.  If t is nil, the change was written outside of
+// a transaction and is not reverted.
+func (t *Tx) onRollback(f func()) {
+	if t != nil {
+		t.undo = append(t.undo, f)
+	}
+}
+
+// queryable returns the transaction tx, or the connection pool if tx is nil.
+func (c *Catalog) queryable(tx *Tx) dbx.Queryable {
+	if tx == nil {
+		return c.dp
+	}
+	return tx
+}
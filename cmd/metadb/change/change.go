@@ -1,39 +1,118 @@
 package change
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
 type Event struct {
-	Key   *EventKey
-	Value *EventValue
-	Topic *string
+	Key       *EventKey
+	Value     *EventValue
+	Topic     *string
+	Partition int32
+	Offset    int64
+	// Transaction is set if the event is a BEGIN or END record from the
+	// Debezium transaction metadata topic.
+	Transaction *TransactionMetadata
+	// Schemaless is set if the event was decoded by SchemalessDecoder,
+	// i.e. the data source has the format json-schemaless.
+	Schemaless bool
 }
 
-func NewEvent(msg *kafka.Message) (*Event, error) {
+// TransactionMetadata is a record of the beginning or end of a source
+// transaction.  EventCount, the number of change events in the transaction,
+// is provided only at the end.
+type TransactionMetadata struct {
+	Status     string `json:"status"`
+	ID         string `json:"id"`
+	EventCount *int64 `json:"event_count"`
+}
+
+// Decoder converts the key or value of a Kafka message to the JSON format
+// produced by the Kafka Connect JSON converter with schemas enabled.
+type Decoder interface {
+	Decode(data []byte) ([]byte, error)
+}
+
+// SchemalessDecoder decodes messages written by the Kafka Connect JSON
+// converter with schemas disabled.  The message is wrapped as the payload of
+// an event that has no schema.
+type SchemalessDecoder struct{}
+
+func (SchemalessDecoder) Decode(data []byte) ([]byte, error) {
+	b := make([]byte, 0, len(data)+12)
+	b = append(b, `{"payload":`...)
+	b = append(b, data...)
+	return append(b, '}'), nil
+}
+
+// NewEvent creates a change event from a Kafka message.  If decoder is nil,
+// the message key and value are expected to be in JSON format.
+func NewEvent(msg *kafka.Message, decoder Decoder) (*Event, error) {
 	if msg == nil {
 		return nil, fmt.Errorf("creating change event: message is nil")
 	}
 	var ce = new(Event)
 	var err error
+	_, ce.Schemaless = decoder.(SchemalessDecoder)
 	if msg.Key != nil && len(msg.Key) > 0 {
-		if err = json.Unmarshal(msg.Key, &(ce.Key)); err != nil {
+		key := msg.Key
+		if decoder != nil {
+			if key, err = decoder.Decode(key); err != nil {
+				return nil, fmt.Errorf("change event key: %w\n%s", err, util.KafkaMessageString(msg))
+			}
+		}
+		if err = json.Unmarshal(key, &(ce.Key)); err != nil {
 			return nil, fmt.Errorf("change event key: %s\n%s", err, util.KafkaMessageString(msg))
 		}
 	}
 	if msg.Value != nil && len(msg.Value) > 0 {
-		if err = json.Unmarshal(msg.Value, &(ce.Value)); err != nil {
+		value := msg.Value
+		if decoder != nil {
+			if value, err = decoder.Decode(value); err != nil {
+				return nil, fmt.Errorf("change event value: %w\n%s", err, util.KafkaMessageString(msg))
+			}
+		}
+		if err = Unmarshal(value, &(ce.Value)); err != nil {
 			return nil, fmt.Errorf("change event value: %s\n%s", err, util.KafkaMessageString(msg))
 		}
+		// Transaction metadata records have no op.
+		if ce.Value != nil && ce.Value.Payload != nil && ce.Value.Payload.Op == nil {
+			var v struct {
+				Payload *TransactionMetadata `json:"payload"`
+			}
+			if err = json.Unmarshal(value, &v); err == nil && v.Payload != nil &&
+				(v.Payload.Status == "BEGIN" || v.Payload.Status == "END") {
+				ce.Transaction = v.Payload
+			}
+		}
 	}
 	ce.Topic = msg.TopicPartition.Topic
+	ce.Partition = msg.TopicPartition.Partition
+	ce.Offset = int64(msg.TopicPartition.Offset)
 	return ce, nil
 }
 
+// Unmarshal parses JSON data in the same way as json.Unmarshal, except that
+// numbers are decoded as json.Number rather than float64.  This preserves
+// the precision of large integers such as timestamps in nanoseconds.
+func Unmarshal(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after top-level value")
+	}
+	return nil
+}
+
 func (e Event) String() string {
 	var key, value, message string
 	if e.Key != nil {
@@ -94,6 +173,7 @@ type EventPayloadSource struct {
 	DB        *string  `json:"db"`
 	Schema    *string  `json:"schema"`
 	Table     *string  `json:"table"`
+	LSN       *int64   `json:"lsn"`
 }
 
 type EventValueSchema struct {
@@ -112,6 +192,22 @@ type EventValuePayload struct {
 	Transaction *json.RawMessage       `json:"transaction"`
 }
 
+// TransactionID returns the identifier of the source transaction that
+// generated the change event, or "" if transaction metadata are not
+// provided.
+func (p *EventValuePayload) TransactionID() string {
+	if p.Transaction == nil {
+		return ""
+	}
+	var t struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(*p.Transaction, &t); err != nil {
+		return ""
+	}
+	return t.ID
+}
+
 type EventValue struct {
 	Schema  *EventValueSchema  `json:"schema"`
 	Payload *EventValuePayload `json:"payload"`
@@ -0,0 +1,237 @@
+package command
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+)
+
+// ColumnAction is the action taken by a column rule.
+type ColumnAction int
+
+const (
+	ColumnDrop ColumnAction = iota
+	ColumnNull
+	ColumnHash
+)
+
+func (a ColumnAction) String() string {
+	switch a {
+	case ColumnDrop:
+		return "drop"
+	case ColumnNull:
+		return "null"
+	case ColumnHash:
+		return "hash"
+	default:
+		return "(unknown)"
+	}
+}
+
+// ColumnRule removes or masks the columns matching Column, in tables whose
+// schema-qualified names match Table.
+type ColumnRule struct {
+	Action ColumnAction
+	Table  *regexp.Regexp
+	Column *regexp.Regexp
+}
+
+// ParseColumnRules compiles a list of column rules, each in the form
+// "action table_regexp column_regexp", where action is "drop", "null", or
+// "hash".  A hash key is required if any rule uses "hash".
+func ParseColumnRules(rules []string, hashKey string) ([]ColumnRule, error) {
+	var cr []ColumnRule
+	for _, r := range rules {
+		f := strings.Fields(r)
+		if len(f) != 3 {
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid column rule %q", r),
+				Hint: "A column rule has the form 'action table_regexp column_regexp'.",
+			}
+		}
+		var rule ColumnRule
+		switch strings.ToLower(f[0]) {
+		case "drop":
+			rule.Action = ColumnDrop
+		case "null":
+			rule.Action = ColumnNull
+		case "hash":
+			if hashKey == "" {
+				return nil, fmt.Errorf("column rule %q requires option \"columnhashkey\"", r)
+			}
+			rule.Action = ColumnHash
+		default:
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid column rule action %q", f[0]),
+				Hint: "Valid actions are: drop, null, hash",
+			}
+		}
+		var err error
+		if rule.Table, err = regexp.Compile(f[1]); err != nil {
+			return nil, fmt.Errorf("invalid column rule %q: %w", r, err)
+		}
+		if rule.Column, err = regexp.Compile(f[2]); err != nil {
+			return nil, fmt.Errorf("invalid column rule %q: %w", r, err)
+		}
+		cr = append(cr, rule)
+	}
+	return cr, nil
+}
+
+// ApplyColumnRules removes or masks columns of a command.  The first rule
+// that matches a column is applied.  Properties of objects within JSON
+// columns are matched as columns named by their path, e.g.
+// "jsonb.personal.dateOfBirth", so that they are also removed or masked
+// before the JSON data are transformed.  Primary key columns can only be
+// hashed, unless rows are identified by all of their columns.
+func ApplyColumnRules(cmd *Command, rules []ColumnRule, hashKey string) error {
+	table := cmd.SchemaName + "." + cmd.TableName
+	var match []ColumnRule
+	for _, r := range rules {
+		if r.Table.MatchString(table) {
+			match = append(match, r)
+		}
+	}
+	if len(match) == 0 {
+		return nil
+	}
+	m := &columnMask{rules: match, hashKey: []byte(hashKey)}
+	cols := make([]CommandColumn, 0, len(cmd.Column))
+	for _, col := range cmd.Column {
+		if r := m.match(col.Name); r != nil {
+			if col.PrimaryKey != 0 && r.Action != ColumnHash && !cmd.FullRowKey {
+				return fmt.Errorf("column rule: cannot %s primary key column %q in table %s", r.Action, col.Name,
+					table)
+			}
+			switch r.Action {
+			case ColumnDrop:
+				continue
+			case ColumnNull:
+				col.Data = nil
+				col.SQLData = nil
+			case ColumnHash:
+				if col.SQLData != nil {
+					h := m.hash(*col.SQLData)
+					col.Data = h
+					col.SQLData = &h
+				}
+				col.DType = TextType
+				col.DTypeSize = 0
+			}
+		} else if col.DType == JSONType && col.SQLData != nil {
+			if err := m.maskJSONColumn(&col); err != nil {
+				return fmt.Errorf("column rule: %s.%s: %w", table, col.Name, err)
+			}
+		}
+		cols = append(cols, col)
+	}
+	cmd.Column = cols
+	return nil
+}
+
+type columnMask struct {
+	rules   []ColumnRule
+	hashKey []byte
+}
+
+func (m *columnMask) match(name string) *ColumnRule {
+	for i := range m.rules {
+		if m.rules[i].Column.MatchString(name) {
+			return &m.rules[i]
+		}
+	}
+	return nil
+}
+
+// hash returns a keyed hash of s (HMAC-SHA256) in hexadecimal.
+func (m *columnMask) hash(s string) string {
+	mac := hmac.New(sha256.New, m.hashKey)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *columnMask) maskJSONColumn(col *CommandColumn) error {
+	d := json.NewDecoder(strings.NewReader(*col.SQLData))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		// Data that are not valid JSON are left unchanged.
+		return nil
+	}
+	v, changed, err := m.maskJSON(col.Name, v)
+	if err != nil || !changed {
+		return err
+	}
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err = e.Encode(v); err != nil {
+		return err
+	}
+	s := strings.TrimSuffix(b.String(), "\n")
+	col.Data = s
+	col.SQLData = &s
+	return nil
+}
+
+// maskJSON applies the rules to the properties of objects within v, which are
+// named by appending the property name to path.  Objects within arrays are
+// named by the path of the array.
+func (m *columnMask) maskJSON(path string, v any) (any, bool, error) {
+	var changed bool
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			p := path + "." + k
+			if r := m.match(p); r != nil {
+				switch r.Action {
+				case ColumnDrop:
+					delete(v, k)
+				case ColumnNull:
+					v[k] = nil
+				case ColumnHash:
+					if e != nil {
+						s, ok := e.(string)
+						if !ok {
+							b, err := json.Marshal(e)
+							if err != nil {
+								return nil, false, err
+							}
+							s = string(b)
+						}
+						v[k] = m.hash(s)
+					}
+				}
+				changed = true
+				continue
+			}
+			e, c, err := m.maskJSON(p, e)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[k] = e
+				changed = true
+			}
+		}
+	case []any:
+		for i, e := range v {
+			e, c, err := m.maskJSON(path, e)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				v[i] = e
+				changed = true
+			}
+		}
+	}
+	return v, changed, nil
+}
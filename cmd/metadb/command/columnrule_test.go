@@ -0,0 +1,46 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestApplyColumnRules(t *testing.T) {
+	rules, err := ParseColumnRules([]string{
+		`drop ^folio_users\.users$ ^birth_date$`,
+		`null ^folio_users\.users$ ^jsonb\.personal\.addresses$`,
+		`hash ^folio_users\.users$ ^(barcode|jsonb\.barcode)$`,
+	}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	cmd := &Command{
+		SchemaName: "folio_users",
+		TableName:  "users",
+		Column: []CommandColumn{
+			{Name: "id", DType: IntegerType, SQLData: str("1"), PrimaryKey: 1},
+			{Name: "birth_date", DType: DateType, SQLData: str("2000-01-01")},
+			{Name: "barcode", DType: IntegerType, SQLData: str("123")},
+			{Name: "jsonb", DType: JSONType, SQLData: str(`{"barcode":"123","personal":{"addresses":[{"city":"x"}],"lastName":"y"}}`)},
+		},
+	}
+	if err = ApplyColumnRules(cmd, rules, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.Column) != 3 {
+		t.Fatalf("got %d columns; want 3", len(cmd.Column))
+	}
+	h := "77de38e4b50e618a0ebb95db61e2f42697391659d82c064a5f81b9f48d85ccd5"
+	if got := *cmd.Column[1].SQLData; got != h || cmd.Column[1].DType != TextType {
+		t.Errorf("got %v (%v); want %v", got, cmd.Column[1].DType, h)
+	}
+	want := `{"barcode":"` + h + `","personal":{"addresses":null,"lastName":"y"}}`
+	if got := *cmd.Column[2].SQLData; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	rules, _ = ParseColumnRules([]string{`drop . ^id$`}, "")
+	if err = ApplyColumnRules(cmd, rules, ""); err == nil {
+		t.Error("expected error for dropping primary key column")
+	}
+}
@@ -3,6 +3,8 @@ package command
 import (
 	"container/list"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
@@ -56,6 +58,15 @@ const (
 	TimetzType      = 10
 	UUIDType        = 11
 	TextType        = 12
+	ByteaType       = 13
+	IntervalType    = 14
+	// Arrays of scalar types
+	BooleanArrayType = 15
+	IntegerArrayType = 16
+	FloatArrayType   = 17
+	NumericArrayType = 18
+	TextArrayType    = 19
+	UUIDArrayType    = 20
 )
 
 func (d DataType) String() string {
@@ -84,6 +95,22 @@ func (d DataType) String() string {
 		return "UUIDType"
 	case TextType:
 		return "TextType"
+	case ByteaType:
+		return "ByteaType"
+	case IntervalType:
+		return "IntervalType"
+	case BooleanArrayType:
+		return "BooleanArrayType"
+	case IntegerArrayType:
+		return "IntegerArrayType"
+	case FloatArrayType:
+		return "FloatArrayType"
+	case NumericArrayType:
+		return "NumericArrayType"
+	case TextArrayType:
+		return "TextArrayType"
+	case UUIDArrayType:
+		return "UUIDArrayType"
 	default:
 		log.Error("data type to string: unknown data type: %d", d)
 		return "(unknown type)"
@@ -91,6 +118,9 @@ func (d DataType) String() string {
 }
 
 func MakeDataType(dataType string) (DataType, int64) {
+	if elem, ok := strings.CutSuffix(dataType, "[]"); ok {
+		return makeArrayDataType(elem)
+	}
 	switch strings.ToLower(dataType) {
 	case "text", "varchar", "character varying":
 		return TextType, 0
@@ -122,6 +152,10 @@ func MakeDataType(dataType string) (DataType, int64) {
 		return UUIDType, 0
 	case "jsonb":
 		return JSONType, 0
+	case "bytea":
+		return ByteaType, 0
+	case "interval":
+		return IntervalType, 0
 	default:
 		log.Error("make data type new: unknown data type: %s", dataType)
 		return UnknownType, 0
@@ -171,6 +205,12 @@ func DataTypeToSQL(dtype DataType, typeSize int64) string {
 		return "uuid"
 	case JSONType:
 		return "jsonb"
+	case ByteaType:
+		return "bytea"
+	case IntervalType:
+		return "interval"
+	case BooleanArrayType, IntegerArrayType, FloatArrayType, NumericArrayType, TextArrayType, UUIDArrayType:
+		return DataTypeToSQL(elementType(dtype), typeSize) + "[]"
 	default:
 		return "(unknown)"
 	}
@@ -193,7 +233,47 @@ type Command struct {
 	Origin          string
 	Column          []CommandColumn
 	SourceTimestamp string
-	Subcommands     *list.List
+	// SourcePosition is the position of the change event in the source.
+	SourcePosition Position
+	// FullRowKey is set if the table has no key, and rows are identified
+	// by the values of all of their columns.
+	FullRowKey bool
+	// Replaces is a delete command for the previous version of an updated
+	// row, if the row is identified by values that have changed.
+	Replaces *Command
+	// RequireCurrent is set if a row filter column has an unavailable
+	// value, which means that the value has not changed, and neither has
+	// whether the row satisfies the filter.  The merge is then applied
+	// only if the row is current in the table.
+	RequireCurrent bool
+	Subcommands    *list.List
+}
+
+// Position identifies a change event within a Kafka topic partition.
+type Position struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	// LSN is the log sequence number of the change in a PostgreSQL
+	// source database, if known.
+	LSN uint64
+}
+
+// String returns the position in the form "topic[partition]@offset", followed
+// by "lsn X/X" if the log sequence number is known.  If neither is known, ""
+// is returned.
+func (p Position) String() string {
+	var s string
+	if p.Topic != "" {
+		s = fmt.Sprintf("%s[%d]@%d", p.Topic, p.Partition, p.Offset)
+	}
+	if p.LSN != 0 {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("lsn %X/%X", uint32(p.LSN>>32), uint32(p.LSN))
+	}
+	return s
 }
 
 func (c *Command) AddChild(child *Command) {
@@ -236,7 +316,7 @@ type CommandColumn struct {
 
 func convertTypeSize(coltype string, datatype DataType) (int64, error) {
 	switch datatype {
-	case IntegerType:
+	case IntegerType, IntegerArrayType:
 		switch coltype {
 		case "int8":
 			return 1, nil
@@ -251,7 +331,7 @@ func convertTypeSize(coltype string, datatype DataType) (int64, error) {
 		}
 	case TextType:
 		return 0, nil
-	case FloatType:
+	case FloatType, FloatArrayType:
 		switch coltype {
 		case "float", "float32":
 			return 4, nil
@@ -278,6 +358,10 @@ func convertTypeSize(coltype string, datatype DataType) (int64, error) {
 		return 0, nil
 	case JSONType:
 		return 0, nil
+	case ByteaType, IntervalType:
+		return 0, nil
+	case BooleanArrayType, NumericArrayType, TextArrayType, UUIDArrayType:
+		return 0, nil
 	default:
 		return 0, fmt.Errorf("convert type size: unknown data type: %s", datatype)
 	}
@@ -313,19 +397,78 @@ func extractPrimaryKey(dedup *log.MessageSet, ce *change.Event) (map[string]int,
 	return primaryKey, nil
 }
 
-func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, error) {
-	var err error
-	var ok bool
-	// Extract field data from payload
+// rowKey describes the key columns of a table, which are given by position,
+// or are all of the columns if fullRow is set.
+type rowKey struct {
+	position map[string]int
+	fullRow  bool
+}
+
+// eventKey returns the key columns of the table of a change event.  Key
+// columns defined by tableKey, if any, take the place of the primary key.  If
+// the table has no primary key and fullRow is set, rows are identified by all
+// of their columns.  Otherwise nil is returned for a table with no key.
+func eventKey(dedup *log.MessageSet, ce *change.Event, tableKey []string, fullRow bool) (*rowKey, error) {
+	switch {
+	case tableKey != nil:
+		return &rowKey{position: keyPositions(tableKey)}, nil
+	case ce.Key != nil && isSchemaless(ce) && len(ce.Key.Payload) != 0:
+		return &rowKey{position: keyPositions(schemalessPrimaryKey(ce))}, nil
+	case ce.Key != nil && !isSchemaless(ce):
+		primaryKey, err := extractPrimaryKey(dedup, ce)
+		if err != nil {
+			return nil, err
+		}
+		return &rowKey{position: primaryKey}, nil
+	case fullRow:
+		return &rowKey{fullRow: true}, nil
+	default:
+		primaryKeyNotDefined(dedup, ce.Topic)
+		return nil, nil
+	}
+}
+
+// extractColumns returns the columns of the row in the "after" field of a
+// change event.
+func extractColumns(ce *change.Event, key *rowKey) ([]CommandColumn, error) {
 	if ce.Value == nil || ce.Value.Payload == nil || ce.Value.Payload.After == nil {
 		return nil, fmt.Errorf("value: $.payload.after not found")
 	}
-	var fieldData map[string]interface{} = ce.Value.Payload.After
+	return extractRowColumns(ce, "after", ce.Value.Payload.After, key)
+}
+
+// extractBeforeColumns returns the key columns of the row in the "before"
+// field of a change event, which contains the previous values of an updated
+// or deleted row if they are provided by the source database.  Nil is
+// returned if the previous values are not available.
+func extractBeforeColumns(ce *change.Event, key *rowKey) ([]CommandColumn, error) {
+	if ce.Value == nil || ce.Value.Payload == nil || ce.Value.Payload.Before == nil {
+		return nil, nil
+	}
+	var before map[string]any
+	if err := change.Unmarshal(*ce.Value.Payload.Before, &before); err != nil {
+		return nil, fmt.Errorf("value: $.payload.before: %w", err)
+	}
+	if before == nil {
+		return nil, nil
+	}
+	column, err := extractRowColumns(ce, "before", before, key)
+	if err != nil {
+		return nil, err
+	}
+	return PrimaryKeyColumns(column), nil
+}
+
+// extractRowColumns returns the columns of a row in the field of a change
+// event named by section, which contains fieldData.
+func extractRowColumns(ce *change.Event, section string, fieldData map[string]any, key *rowKey) ([]CommandColumn, error) {
+	var err error
+	var ok bool
 	// Extract fields from schema
 	if ce.Value == nil || ce.Value.Schema == nil || ce.Value.Schema.Fields == nil {
 		return nil, fmt.Errorf("value: $.schema.fields not found")
 	}
-	var after map[string]interface{}
+	var rowSchema map[string]interface{}
 	var schemaField map[string]interface{}
 	for _, schemaField = range ce.Value.Schema.Fields {
 		var f interface{}
@@ -336,16 +479,16 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 		if fs, ok = f.(string); !ok {
 			continue
 		}
-		if fs == "after" {
-			after = schemaField
+		if fs == section {
+			rowSchema = schemaField
 			break
 		}
 	}
-	if after == nil {
-		return nil, fmt.Errorf("value: $.schema.fields: \"after\" not found")
+	if rowSchema == nil {
+		return nil, fmt.Errorf("value: $.schema.fields: %q not found", section)
 	}
 	var af interface{}
-	if af = after["fields"]; af == nil {
+	if af = rowSchema["fields"]; af == nil {
 		return nil, fmt.Errorf("value: $.schema.fields: \"fields\" not found")
 	}
 	// var afi []map[string]interface{}
@@ -353,16 +496,11 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 	if afi, ok = af.([]interface{}); !ok {
 		return nil, fmt.Errorf("value: $.schema.fields: \"fields\" not expected type")
 	}
-	var primaryKey map[string]int
-	if primaryKey, err = extractPrimaryKey(dedup, ce); err != nil {
-		return nil, err
-	}
-	if primaryKey == nil {
-		return nil, nil
-	}
 	var column []CommandColumn
+	var keys int
+	var x int
 	var i interface{}
-	for _, i = range afi {
+	for x, i = range afi {
 		var m map[string]interface{}
 		if m, ok = i.(map[string]interface{}); !ok {
 			return nil, fmt.Errorf("value: $.schema.fields: \"fields\" not expected type")
@@ -396,15 +534,27 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 
 		var col CommandColumn
 		col.Name = field
-		if col.DType, err = convertDataType(ftype, semtype); err != nil {
+		// For arrays, the type size and conversions are based on the element type.
+		var items map[string]any
+		sizetype := ftype
+		if ftype == "array" {
+			if items, err = arrayItems(m); err != nil {
+				return nil, fmt.Errorf("value: $.schema.fields: %q: %w", field, err)
+			}
+			sizetype, _ = items["type"].(string)
+			col.DType, err = convertArrayType(items)
+		} else {
+			col.DType, err = convertDataType(ftype, semtype)
+		}
+		if err != nil {
 			return nil, fmt.Errorf("value: $.schema.fields: \"type\": %s", err)
 		}
 		col.Data = fieldData[field]
-		if (col.DType == TextType || col.DType == JSONType) && col.Data != nil {
+		if col.Data != nil {
 			// Large values (typically above 8 kB) in PostgreSQL that have been stored using
 			// the "TOAST" method are not included in an UPDATE change event where those
 			// values were not modified.
-			if col.Data.(string) == "__debezium_unavailable_value" {
+			if isUnavailableValue(col.Data, col.DType) {
 				col.Data = nil
 				col.Unavailable = true
 			}
@@ -414,15 +564,30 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 				return nil, fmt.Errorf("decoding numeric bytes: %w", err)
 			}
 		}
+		if col.Data != nil {
+			if col.Data, err = convertStructuredData(m, items, col.Data, col.DType, semtype); err != nil {
+				return nil, fmt.Errorf("value: $.payload.%s: %q: %w", section, field, err)
+			}
+		}
 		if col.SQLData, err = DataToSQLData(col.Data, col.DType, semtype); err != nil {
-			return nil, fmt.Errorf("value: $.payload.after: \"%s\": unknown type: %v", field, err)
+			return nil, fmt.Errorf("value: $.payload.%s: \"%s\": unknown type: %v", section, field, err)
 		}
-		if col.DTypeSize, err = convertTypeSize(ftype, col.DType); err != nil {
-			return nil, fmt.Errorf("value: $.payload.after: \"%s\": unknown type size: %v", field, err)
+		if col.DTypeSize, err = convertTypeSize(sizetype, col.DType); err != nil {
+			return nil, fmt.Errorf("value: $.payload.%s: \"%s\": unknown type size: %v", section, field, err)
+		}
+		if key.fullRow {
+			col.PrimaryKey = x + 1
+		} else {
+			col.PrimaryKey = key.position[field]
+		}
+		if col.PrimaryKey != 0 {
+			keys++
 		}
-		col.PrimaryKey = primaryKey[field]
 		column = append(column, col)
 	}
+	if !key.fullRow && keys != len(key.position) {
+		return nil, fmt.Errorf("value: $.payload.%s: key columns not found", section)
+	}
 	return column, nil
 }
 
@@ -540,7 +705,7 @@ func structScale(data any) (int32, string, error) {
 		return 0, "", fmt.Errorf("scale not found in payload after: %v", obj)
 	}
 	var scalef float64
-	if scalef, ok = si.(float64); !ok {
+	if scalef, ok = floatData(si); !ok {
 		return 0, "", fmt.Errorf("unexpected data type in scale: %T: %v", si, obj)
 	}
 	var scale = int32(scalef)
@@ -572,10 +737,27 @@ func structScale(data any) (int32, string, error) {
 // }
 
 // var FolioTenant string
-var ReshareTenants []string
 
-func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schemaStopFilter,
-	tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix string) (*Command, bool, error) {
+// SourceOptions are the options of a data source that determine which change
+// events are written and how they are identified, renamed, and filtered.
+type SourceOptions struct {
+	SchemaPassFilter []*regexp.Regexp
+	SchemaStopFilter []*regexp.Regexp
+	TableStopFilter  []*regexp.Regexp
+	TrimSchemaPrefix string
+	AddSchemaPrefix  string
+	SchemaRename     []RenameRule
+	TableRename      []RenameRule
+	RowFilters       []RowFilter
+	TableKeys        []TableKey
+	// FullRowKey is set if rows of tables without a key are identified by
+	// the values of all of their columns.
+	FullRowKey bool
+	// Origins are the schema prefixes that identify data origins.
+	Origins []string
+}
+
+func NewCommand(dedup *log.MessageSet, ce *change.Event, opts *SourceOptions, cat ColumnCatalog) (*Command, bool, error) {
 	snapshot := false
 	// Note: this function returns nil, nil in some cases.
 	if ce == nil {
@@ -583,11 +765,16 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 	}
 	var err error
 	var c = new(Command)
+	if ce.Topic != nil {
+		c.SourcePosition = Position{Topic: *ce.Topic, Partition: ce.Partition, Offset: ce.Offset}
+	}
 	if ce.Value == nil || ce.Value.Payload == nil {
 		var name string
 		var key interface{}
 		if ce != nil && ce.Key != nil {
-			name = *ce.Key.Schema.Name
+			if ce.Key.Schema != nil && ce.Key.Schema.Name != nil {
+				name = *ce.Key.Schema.Name
+			}
 			key = ce.Key.Payload
 		}
 		log.Trace("possible tombstone event: missing value payload in change event: schema=%q, key=%v", name, key)
@@ -618,54 +805,68 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 	}
 	// convert ts_ms to string
 	i, f := math.Modf(*ce.Value.Payload.Source.TsMs / 1000)
-	c.SourceTimestamp = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
-	if ce.Value.Payload.Source.Schema != nil {
-		schema := *ce.Value.Payload.Source.Schema
-		if len(schemaPassFilter) > 0 && !util.MatchRegexps(schemaPassFilter, schema) {
-			log.Trace("filter: reject: %s", schema)
-			return nil, false, nil
-		}
-		if len(schemaStopFilter) > 0 && util.MatchRegexps(schemaStopFilter, schema) {
-			log.Trace("filter: reject: %s", schema)
+	c.SourceTimestamp = FormatSourceTimestamp(time.Unix(int64(i), int64(f*1000000000)))
+	if ce.Value.Payload.Source.LSN != nil {
+		c.SourcePosition.LSN = uint64(*ce.Value.Payload.Source.LSN)
+	}
+	schema, tableName := sourceSchemaTable(ce.Value.Payload.Source)
+	if schema != "" {
+		var ok bool
+		c.Origin, c.SchemaName, ok = SourceSchema(schema, opts.SchemaPassFilter, opts.SchemaStopFilter,
+			opts.TrimSchemaPrefix, opts.AddSchemaPrefix, opts.SchemaRename, opts.Origins)
+		if !ok {
 			return nil, false, nil
 		}
-		// Rewrite schema name
-		if trimSchemaPrefix != "" {
-			schema = strings.TrimPrefix(schema, trimSchemaPrefix)
-		}
-		schema = strings.TrimPrefix(schema, "uchicago_")
-		schema = strings.TrimPrefix(schema, "lu_")
-		schema = strings.TrimPrefix(schema, "dbz_")
-		schema = strings.TrimPrefix(schema, "reports_dev_")
-		schema = strings.TrimPrefix(schema, "mod_")
-		schema = strings.TrimSuffix(schema, "_storage")
-		schema = strings.Replace(schema, "_mod_", "_", 1)
-		var origin string
-		origin, schema = extractOrigin(ReshareTenants, schema)
-		c.Origin = origin
-		schema = addSchemaPrefix + schema
-		c.SchemaName = schema
-	}
-	if ce.Value.Payload.Source.Table != nil {
-		table := *ce.Value.Payload.Source.Table
-		schemaTable := *ce.Value.Payload.Source.Schema + "." + table
-		if len(tableStopFilter) > 0 && util.MatchRegexps(tableStopFilter, schemaTable) {
-			log.Trace("filter: reject: %s", table)
+	}
+	if tableName != "" {
+		schemaTable := schema + "." + tableName
+		if len(opts.TableStopFilter) > 0 && util.MatchRegexps(opts.TableStopFilter, schemaTable) {
+			log.Trace("filter: reject: %s", tableName)
 			return nil, false, nil
 		}
-		c.TableName = table
+		c.TableName = Rename(opts.TableRename, tableName)
 	}
-	if *ce.Value.Payload.Source.Snapshot == "true" {
-		snapshot = true
+	if ce.Value.Payload.Source.Snapshot != nil {
+		switch *ce.Value.Payload.Source.Snapshot {
+		// Values other than "true" are used by some connectors to mark the
+		// first and last records of a snapshot.
+		case "true", "first", "first_in_data_collection", "last_in_data_collection", "last":
+			snapshot = true
+		}
 	}
 	if c.Op == TruncateOp {
 		return c, snapshot, nil
 	}
+	table := &dbx.Table{Schema: c.SchemaName, Table: c.TableName}
+	tableKey := MatchTableKey(opts.TableKeys, c.SchemaName, c.TableName)
+	key, err := eventKey(dedup, ce, tableKey, opts.FullRowKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if key == nil {
+		return nil, false, nil
+	}
+	c.FullRowKey = key.fullRow
+	// Unless the primary key in the event key is used, key values of a
+	// deleted or updated row are read from the previous values of the row.
+	previousKey := tableKey != nil || key.fullRow
+	if c.Op == DeleteOp && previousKey {
+		if c.Column, err = previousKeyColumns(dedup, ce, cat, table, key, false); err != nil {
+			return nil, false, err
+		}
+		if c.Column == nil {
+			return nil, false, nil
+		}
+		return c, snapshot, nil
+	}
+	if c.Op == DeleteOp && isSchemaless(ce) {
+		if c.Column, err = schemalessKeyColumns(ce, cat, table); err != nil {
+			return nil, false, err
+		}
+		return c, snapshot, nil
+	}
 	if c.Op == DeleteOp {
 		switch {
-		case ce.Key == nil:
-			primaryKeyNotDefined(dedup, ce.Topic)
-			return nil, false, nil
 		case ce.Key.Schema == nil:
 			return nil, false, fmt.Errorf("delete: missing event key schema: %v", ce.Key)
 		case ce.Key.Schema.Fields == nil:
@@ -732,15 +933,141 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 		}
 		return c, snapshot, nil
 	}
-	if c.Column, err = extractColumns(dedup, ce); err != nil {
+	if isSchemaless(ce) {
+		c.Column, err = extractSchemalessColumns(ce, cat, table, key)
+	} else {
+		c.Column, err = extractColumns(ce, key)
+	}
+	if err != nil {
 		return nil, false, err
 	}
-	if c.Column == nil {
-		return nil, false, nil
+	if previousKey && *ce.Value.Payload.Op == "u" {
+		// If the key values have changed, the previous version of the
+		// row is deleted.
+		var old []CommandColumn
+		if old, err = previousKeyColumns(dedup, ce, cat, table, key, true); err != nil {
+			return nil, false, err
+		}
+		if old != nil {
+			d := &Command{
+				Op:              DeleteOp,
+				SchemaName:      c.SchemaName,
+				TableName:       c.TableName,
+				Origin:          c.Origin,
+				Column:          old,
+				SourceTimestamp: c.SourceTimestamp,
+				SourcePosition:  c.SourcePosition,
+				FullRowKey:      c.FullRowKey,
+			}
+			if KeyChanged(d, c) {
+				c.Replaces = d
+			}
+		}
+	}
+	if len(opts.RowFilters) != 0 {
+		if f := FilterRow(dedup, opts.RowFilters, c, snapshot); f != c {
+			return f, snapshot, nil
+		}
 	}
 	return c, snapshot, nil
 }
 
+// FormatSourceTimestamp formats the time of a change in the source database,
+// for use as Command.SourceTimestamp.
+func FormatSourceTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+}
+
+// sourceSchemaTable returns the schema and table names of a change event in
+// the source database, which depend on the Debezium connector.  MySQL
+// databases are equivalent to schemas, and so the database name is used as
+// the schema name.  SQL Server schemas such as "dbo" are commonly repeated in
+// each database, and the schema name is prefixed with the database name, for
+// example "erp_dbo".  Other connectors provide the schema name directly.
+func sourceSchemaTable(source *change.EventPayloadSource) (string, string) {
+	var connector, db, schema, table string
+	if source.Connector != nil {
+		connector = *source.Connector
+	}
+	if source.DB != nil {
+		db = *source.DB
+	}
+	if source.Schema != nil {
+		schema = *source.Schema
+	}
+	if source.Table != nil {
+		table = *source.Table
+	}
+	switch connector {
+	case "mysql":
+		return db, table
+	case "sqlserver":
+		if db != "" && schema != "" {
+			return db + "_" + schema, table
+		}
+	}
+	if schema == "" {
+		schema = db
+	}
+	return schema, table
+}
+
+// SourceSchema applies the schema filters to a schema name in the source
+// database and rewrites it to the schema name used in the database.  The
+// origin, if any, and new schema name are returned, or false if the schema is
+// filtered out.  The origin is extracted from the schema name if it has one
+// of the prefixes in origins.
+func SourceSchema(schema string, schemaPassFilter, schemaStopFilter []*regexp.Regexp, trimSchemaPrefix,
+	addSchemaPrefix string, schemaRename []RenameRule, origins []string) (string, string, bool) {
+	if len(schemaPassFilter) > 0 && !util.MatchRegexps(schemaPassFilter, schema) {
+		log.Trace("filter: reject: %s", schema)
+		return "", "", false
+	}
+	if len(schemaStopFilter) > 0 && util.MatchRegexps(schemaStopFilter, schema) {
+		log.Trace("filter: reject: %s", schema)
+		return "", "", false
+	}
+	// Rewrite schema name
+	if trimSchemaPrefix != "" {
+		schema = strings.TrimPrefix(schema, trimSchemaPrefix)
+	}
+	schema = Rename(schemaRename, schema)
+	var origin string
+	origin, schema = extractOrigin(origins, schema)
+	return origin, addSchemaPrefix + schema, true
+}
+
+// previousKeyColumns returns the key columns of a deleted or updated row from
+// the previous values of the row, or nil if they are not available.  For an
+// update of a row identified by all of its columns, the previous version of
+// the row then remains current, and a warning is logged every time.
+func previousKeyColumns(dedup *log.MessageSet, ce *change.Event, cat ColumnCatalog, table *dbx.Table, key *rowKey, update bool) ([]CommandColumn, error) {
+	var column []CommandColumn
+	var err error
+	if isSchemaless(ce) {
+		column, err = schemalessBeforeColumns(ce, cat, table, key)
+	} else {
+		column, err = extractBeforeColumns(ce, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if column == nil {
+		topic := ""
+		if ce.Topic != nil {
+			topic = *ce.Topic
+		}
+		msg := fmt.Sprintf("previous values of row not available: %s", topic)
+		switch {
+		case update && key.fullRow:
+			log.Warning("%s: previous version of updated row remains current", msg)
+		case dedup.Insert(msg):
+			log.Warning("%s", msg)
+		}
+	}
+	return column, nil
+}
+
 func primaryKeyNotDefined(dedup *log.MessageSet, topicPtr *string) {
 	topic := ""
 	if topicPtr != nil {
@@ -774,18 +1101,27 @@ func convertDataType(coltype, semtype string) (DataType, error) {
 	case "int8", "int16":
 		return IntegerType, nil
 	case "int32":
-		if strings.HasSuffix(semtype, ".time.Date") {
+		// Connectors configured with time.precision.mode=connect use the
+		// Kafka Connect logical types.
+		if strings.HasSuffix(semtype, ".time.Date") || semtype == "org.apache.kafka.connect.data.Date" {
 			return DateType, nil
 		}
-		if strings.HasSuffix(semtype, ".time.Time") {
+		if strings.HasSuffix(semtype, ".time.Time") || semtype == "org.apache.kafka.connect.data.Time" {
 			return TimeType, nil
 		}
+		// MySQL YEAR (io.debezium.time.Year) is stored as an integer.
 		return IntegerType, nil
 	case "int64":
-		if strings.HasSuffix(semtype, ".time.MicroTime") {
+		// SQL Server and Oracle use nanosecond precision for time(7),
+		// datetime2(7), and timestamp(7) through timestamp(9).
+		if strings.HasSuffix(semtype, ".time.MicroTime") || strings.HasSuffix(semtype, ".time.NanoTime") {
 			return TimeType, nil
 		}
-		if strings.HasSuffix(semtype, ".time.Timestamp") || strings.HasSuffix(semtype, ".time.MicroTimestamp") {
+		if strings.HasSuffix(semtype, ".time.MicroDuration") {
+			return IntervalType, nil
+		}
+		if strings.HasSuffix(semtype, ".time.Timestamp") || strings.HasSuffix(semtype, ".time.MicroTimestamp") ||
+			strings.HasSuffix(semtype, ".time.NanoTimestamp") || semtype == "org.apache.kafka.connect.data.Timestamp" {
 			return TimestampType, nil
 		}
 		return IntegerType, nil
@@ -804,20 +1140,32 @@ func convertDataType(coltype, semtype string) (DataType, error) {
 		if strings.HasSuffix(semtype, ".time.ZonedTimestamp") {
 			return TimestamptzType, nil
 		}
+		if strings.HasSuffix(semtype, ".time.Interval") {
+			return IntervalType, nil
+		}
+		// Other semantic types including io.debezium.data.Enum and
+		// io.debezium.data.EnumSet are stored as text.
 		return TextType, nil
 	case "bytes":
-		// if strings.HasSuffix(semtype, ".data.Bits") {
-		// 	return , nil
-		// }
 		if semtype == "org.apache.kafka.connect.data.Decimal" {
 			return NumericType, nil
 		}
-		return 0, fmt.Errorf("convert data type: unhandled type: type=%s, semtype=%s", coltype, semtype)
+		// Bit strings are stored as text containing '0' and '1'.
+		if strings.HasSuffix(semtype, ".data.Bits") {
+			return TextType, nil
+		}
+		return ByteaType, nil
 	case "struct":
 		if semtype == "io.debezium.data.VariableScaleDecimal" {
 			return NumericType, nil
 		}
+		// Geometry types are stored as EWKB.
+		if strings.HasPrefix(semtype, "io.debezium.data.geometry.") {
+			return ByteaType, nil
+		}
 		return 0, fmt.Errorf("convert data type: unhandled type: type=%s, semtype=%s", coltype, semtype)
+	case "array":
+		return 0, fmt.Errorf("convert data type: array element type not specified")
 	default:
 		return 0, fmt.Errorf("convert data type: unknown data type: %s", coltype)
 	}
@@ -841,29 +1189,28 @@ func DataToSQLData(data any, datatype DataType, semtype string) (*string, error)
 		s := "false"
 		return &s, nil
 	case IntegerType:
-		v, ok := data.(float64)
+		i, ok := intData(data)
 		if !ok {
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
-		i := int64(v)
 		s := strconv.FormatInt(i, 10)
 		return &s, nil
 	case FloatType:
-		v, ok := data.(float64)
+		v, ok := floatData(data)
 		if !ok {
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
 		s := fmt.Sprintf("%g", v)
 		return &s, nil
 	case DateType:
-		v, ok := data.(float64)
+		v, ok := floatData(data)
 		if !ok {
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
 		s := time.Unix(int64(v*86400), int64(0)).UTC().Format("2006-01-02") + "T00:00:00Z"
 		return &s, nil
 	case TimeType:
-		v, ok := data.(float64)
+		v, ok := floatData(data)
 		if !ok {
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
@@ -878,14 +1225,26 @@ func DataToSQLData(data any, datatype DataType, semtype string) (*string, error)
 			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("15:04:05.000000")
 			s := fixupSQLTime(t)
 			return &s, nil
+		case strings.HasSuffix(semtype, ".time.NanoTime"):
+			// Read the integer value, which may not be exactly
+			// representable as a float64.
+			n, _ := intData(data)
+			var t string = time.Unix(0, n).UTC().Format("15:04:05.000000")
+			s := fixupSQLTime(t)
+			return &s, nil
+		case semtype == "org.apache.kafka.connect.data.Time":
+			var i, f float64 = math.Modf(v / 1000)
+			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("15:04:05.000000")
+			s := fixupSQLTime(t)
+			return &s, nil
 		}
 	case TimestampType:
-		v, ok := data.(float64)
+		v, ok := floatData(data)
 		if !ok {
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
 		switch {
-		case strings.HasSuffix(semtype, ".time.Timestamp"):
+		case strings.HasSuffix(semtype, ".time.Timestamp"), semtype == "org.apache.kafka.connect.data.Timestamp":
 			var i, f float64 = math.Modf(v / 1000)
 			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000")
 			s := fixupSQLTime(t)
@@ -895,6 +1254,11 @@ func DataToSQLData(data any, datatype DataType, semtype string) (*string, error)
 			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000")
 			s := fixupSQLTime(t)
 			return &s, nil
+		case strings.HasSuffix(semtype, ".time.NanoTimestamp"):
+			n, _ := intData(data)
+			var t string = time.Unix(0, n).UTC().Format("2006-01-02 15:04:05.000000")
+			s := fixupSQLTime(t)
+			return &s, nil
 		}
 	case TextType, NumericType, UUIDType, JSONType, TimetzType, TimestamptzType:
 		s, ok := data.(string)
@@ -902,10 +1266,63 @@ func DataToSQLData(data any, datatype DataType, semtype string) (*string, error)
 			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 		}
 		return &s, nil
+	case ByteaType:
+		v, ok := data.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s data \"%v\": %w", datatype, data, err)
+		}
+		s := `\x` + hex.EncodeToString(b)
+		return &s, nil
+	case IntervalType:
+		switch v := data.(type) {
+		case float64, json.Number: // io.debezium.time.MicroDuration
+			i, _ := intData(v)
+			s := strconv.FormatInt(i, 10) + " microseconds"
+			return &s, nil
+		case string: // io.debezium.time.Interval (ISO 8601)
+			return &v, nil
+		}
+	case BooleanArrayType, IntegerArrayType, FloatArrayType, NumericArrayType, TextArrayType, UUIDArrayType:
+		return arrayToSQLData(data, datatype)
 	}
 	return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 }
 
+// floatData returns the value of data decoded from a JSON number, which may
+// be a float64 or json.Number.
+func floatData(data any) (float64, bool) {
+	switch v := data.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// intData returns the value of data decoded from a JSON number as an
+// integer.  A json.Number is read exactly if it is an integer.
+func intData(data any) (int64, bool) {
+	switch v := data.(type) {
+	case float64:
+		return int64(v), true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		f, err := v.Float64()
+		return int64(f), err == nil
+	default:
+		return 0, false
+	}
+}
+
 // fixupSQLTime prepares a time or timestamp for subsequent SQL encoding.  Any
 // fractional trailing zeros are removed.  "T" is added between the date and
 // time of a timestamp.  "Z" is appended to specify UTC.  This function does
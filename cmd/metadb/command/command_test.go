@@ -1,7 +1,10 @@
 package command
 
 import (
+	"encoding/json"
 	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/change"
 )
 
 func TestTrimFractionalZerosInFraction(t *testing.T) {
@@ -117,3 +120,95 @@ func TestExtractOriginEmpty(t *testing.T) {
 		t.Errorf("got %v, %v; want %v, %v", gotOrigin, gotNewSchema, wantOrigin, wantNewSchema)
 	}
 }
+
+func TestByteaToSQLData(t *testing.T) {
+	got, err := DataToSQLData("3q2+7w==", ByteaType, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `\xdeadbeef`
+	if *got != want {
+		t.Errorf("got %v; want %v", *got, want)
+	}
+}
+
+func TestSourceSchemaTable(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		source change.EventPayloadSource
+		schema string
+		table  string
+	}{
+		{change.EventPayloadSource{Connector: str("postgresql"), DB: str("folio"), Schema: str("public"),
+			Table: str("item")}, "public", "item"},
+		{change.EventPayloadSource{Connector: str("mysql"), DB: str("inventory"), Table: str("item")},
+			"inventory", "item"},
+		{change.EventPayloadSource{Connector: str("sqlserver"), DB: str("erp"), Schema: str("dbo"),
+			Table: str("item")}, "erp_dbo", "item"},
+		{change.EventPayloadSource{Connector: str("oracle"), DB: str("ORCLPDB1"), Schema: str("ERP"),
+			Table: str("ITEM")}, "ERP", "ITEM"},
+	}
+	for _, tt := range tests {
+		schema, table := sourceSchemaTable(&tt.source)
+		if schema != tt.schema || table != tt.table {
+			t.Errorf("%s: got %s.%s; want %s.%s", *tt.source.Connector, schema, table, tt.schema, tt.table)
+		}
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos  Position
+		want string
+	}{
+		{Position{}, ""},
+		{Position{Topic: "sensor.public.item", Partition: 2, Offset: 123}, "sensor.public.item[2]@123"},
+		{Position{LSN: 0x16B374D848}, "lsn 16/B374D848"},
+		{Position{Topic: "sensor.public.item", Offset: 7, LSN: 0x1A0}, "sensor.public.item[0]@7 lsn 0/1A0"},
+	}
+	for _, tt := range tests {
+		if got := tt.pos.String(); got != tt.want {
+			t.Errorf("got %q; want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNanoTimestampToSQLData(t *testing.T) {
+	dtype, err := convertDataType("int64", "io.debezium.time.NanoTimestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DataToSQLData(float64(1641910064400000000), dtype, "io.debezium.time.NanoTimestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2022-01-11T14:07:44.4Z"
+	if *got != want {
+		t.Errorf("got %v; want %v", *got, want)
+	}
+	// The value is not exactly representable as a float64, which would
+	// round it up to the next microsecond.
+	got, err = DataToSQLData(json.Number("1641910064123456999"), dtype, "io.debezium.time.NanoTimestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "2022-01-11T14:07:44.123456Z"
+	if *got != want {
+		t.Errorf("got %v; want %v", *got, want)
+	}
+}
+
+func TestNanoTimeToSQLData(t *testing.T) {
+	dtype, err := convertDataType("int64", "io.debezium.time.NanoTime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DataToSQLData(json.Number("50864123456999"), dtype, "io.debezium.time.NanoTime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "14:07:44.123456Z"
+	if *got != want {
+		t.Errorf("got %v; want %v", *got, want)
+	}
+}
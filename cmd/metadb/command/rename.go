@@ -0,0 +1,75 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+)
+
+// RenameRule rewrites the parts of a schema or table name that match a
+// regular expression.
+type RenameRule struct {
+	Regexp      *regexp.Regexp
+	Replacement string
+}
+
+// folioRenameRules are the schema rename rules of the "folio" preset, which
+// remove prefixes and suffixes that are used in some FOLIO installations.
+var folioRenameRules = []RenameRule{
+	{regexp.MustCompile("^uchicago_"), ""},
+	{regexp.MustCompile("^lu_"), ""},
+	{regexp.MustCompile("^dbz_"), ""},
+	{regexp.MustCompile("^reports_dev_"), ""},
+	{regexp.MustCompile("^mod_"), ""},
+	{regexp.MustCompile("_storage$"), ""},
+	{regexp.MustCompile("^(.*?)_mod_"), "${1}_"},
+}
+
+// ParseRenameRules compiles a list of rename rules, each in the form
+// "regexp=replacement".  The rule is split at the first "=", and so an "="
+// in the regular expression must be written as "\x3d".  The replacement may
+// refer to submatches, e.g. "${1}".
+func ParseRenameRules(rules []string) ([]RenameRule, error) {
+	var rr []RenameRule
+	for _, r := range rules {
+		expr, repl, ok := strings.Cut(r, "=")
+		if !ok {
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid rename rule %q", r),
+				Hint: "A rename rule has the form 'regexp=replacement'.",
+			}
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename rule %q: %w", r, err)
+		}
+		rr = append(rr, RenameRule{Regexp: re, Replacement: repl})
+	}
+	return rr, nil
+}
+
+// RenamePreset returns the schema rename rules of a named preset.  The name
+// "" selects no rules.
+func RenamePreset(name string) ([]RenameRule, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "folio":
+		return folioRenameRules, nil
+	default:
+		return nil, &dberr.Error{
+			Err:  fmt.Errorf("invalid rename preset %q", name),
+			Hint: "Valid rename presets are: folio",
+		}
+	}
+}
+
+// Rename applies rename rules in order to a schema or table name.
+func Rename(rules []RenameRule, name string) string {
+	for _, r := range rules {
+		name = r.Regexp.ReplaceAllString(name, r.Replacement)
+	}
+	return name
+}
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestRenameFolioPreset(t *testing.T) {
+	rules, err := RenamePreset("folio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"uchicago_mod_inventory_storage": "inventory",
+		"diku_mod_inventory_storage":     "diku_inventory",
+		"diku_mod_users_mod_x":           "diku_users_mod_x",
+		"public":                         "public",
+	}
+	for name, want := range tests {
+		if got := Rename(rules, name); got != want {
+			t.Errorf("%s: got %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseRenameRules(t *testing.T) {
+	rules, err := ParseRenameRules([]string{`^erp_dbo$=erp`, `^(\w+)_v(\d+)$=${1}${2}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Rename(rules, "erp_dbo"); got != "erp" {
+		t.Errorf("got %v; want %v", got, "erp")
+	}
+	if got := Rename(rules, "item_v2"); got != "item2" {
+		t.Errorf("got %v; want %v", got, "item2")
+	}
+	if _, err = ParseRenameRules([]string{"^erp_"}); err == nil {
+		t.Error("expected error for rule without replacement")
+	}
+}
@@ -0,0 +1,121 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// RowFilter is a condition that rows of tables whose schema-qualified names
+// match Table must satisfy in order to be written: the value of Column must
+// be equal to Value or, if Equal is false, not equal to it.  A NULL value is
+// not equal to any value.
+type RowFilter struct {
+	Table  *regexp.Regexp
+	Column string
+	Equal  bool
+	Value  string
+}
+
+var rowFilterSyntax = regexp.MustCompile(`^(\S+)\s+([^\s=!<>]+)\s*(=|!=|<>)\s*(.*)$`)
+
+// ParseRowFilters compiles a list of row filters, each in the form
+// "table_regexp column = value" or "table_regexp column != value".  The value
+// may be enclosed in single quotes.
+func ParseRowFilters(filters []string) ([]RowFilter, error) {
+	var rf []RowFilter
+	for _, f := range filters {
+		m := rowFilterSyntax.FindStringSubmatch(strings.TrimSpace(f))
+		if m == nil {
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid row filter %q", f),
+				Hint: "A row filter has the form 'table_regexp column = value' or 'table_regexp column != value'.",
+			}
+		}
+		re, err := regexp.Compile(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid row filter %q: %w", f, err)
+		}
+		value := m[4]
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+		rf = append(rf, RowFilter{Table: re, Column: m[2], Equal: m[3] == "=", Value: value})
+	}
+	return rf, nil
+}
+
+// MatchRowFilters returns true if the columns of a command satisfy all of the
+// filters that apply to its table.  A filter on a column that is missing is
+// not satisfied, and a warning is logged.  A filter on a column whose value is
+// unavailable, because it was not changed, cannot be checked; it is skipped,
+// and unknown is returned as true.
+func MatchRowFilters(dedup *log.MessageSet, filters []RowFilter, cmd *Command) (match, unknown bool) {
+	table := cmd.SchemaName + "." + cmd.TableName
+	for _, f := range filters {
+		if !f.Table.MatchString(table) {
+			continue
+		}
+		var col *CommandColumn
+		for i := range cmd.Column {
+			if cmd.Column[i].Name == f.Column {
+				col = &cmd.Column[i]
+				break
+			}
+		}
+		if col == nil {
+			msg := fmt.Sprintf("row filter column %q not found in table %s: rows not written", f.Column, table)
+			if dedup.Insert(msg) {
+				log.Warning("%s", msg)
+			}
+			return false, false
+		}
+		if col.Unavailable {
+			unknown = true
+			continue
+		}
+		equal := col.SQLData != nil && *col.SQLData == f.Value
+		if equal != f.Equal {
+			return false, false
+		}
+	}
+	return true, unknown
+}
+
+// FilterRow applies row filters to a merge command, and returns c if the row
+// satisfies them.  Otherwise a snapshot record is skipped by returning nil,
+// and for a change to the row, a delete command is returned so that the row
+// is removed in case it was written before it was changed.  If a filter
+// column is unavailable, c is returned with RequireCurrent set, so that the
+// row is written only if it was written before.
+func FilterRow(dedup *log.MessageSet, filters []RowFilter, c *Command, snapshot bool) *Command {
+	if c.Op != MergeOp {
+		return c
+	}
+	match, unknown := MatchRowFilters(dedup, filters, c)
+	if match {
+		c.RequireCurrent = unknown
+		return c
+	}
+	if snapshot {
+		return nil
+	}
+	key := PrimaryKeyColumns(c.Column)
+	if len(key) == 0 {
+		return nil
+	}
+	return &Command{
+		Op:              DeleteOp,
+		SchemaName:      c.SchemaName,
+		TableName:       c.TableName,
+		Origin:          c.Origin,
+		Column:          key,
+		SourceTimestamp: c.SourceTimestamp,
+		SourcePosition:  c.SourcePosition,
+		FullRowKey:      c.FullRowKey,
+		Replaces:        c.Replaces,
+	}
+}
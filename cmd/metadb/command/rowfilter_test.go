@@ -0,0 +1,86 @@
+package command
+
+import (
+	"io"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+func TestFilterRow(t *testing.T) {
+	filters, err := ParseRowFilters([]string{`^folio_users\. tenant_id = diku`, `^folio_users\.users$ status != 'test'`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	row := func(tenant, status *string) *Command {
+		return &Command{
+			Op:         MergeOp,
+			SchemaName: "folio_users",
+			TableName:  "users",
+			Column: []CommandColumn{
+				{Name: "id", DType: IntegerType, SQLData: str("1"), PrimaryKey: 1},
+				{Name: "tenant_id", DType: TextType, SQLData: tenant},
+				{Name: "status", DType: TextType, SQLData: status},
+			},
+		}
+	}
+	log.Init(io.Discard, false, false)
+	dedup := log.NewMessageSet()
+	c := row(str("diku"), nil)
+	if got := FilterRow(dedup, filters, c, false); got != c {
+		t.Errorf("row with null status: got %v; want unchanged", got)
+	}
+	if got := FilterRow(dedup, filters, row(str("diku"), str("test")), true); got != nil {
+		t.Errorf("snapshot row: got %v; want nil", got)
+	}
+	got := FilterRow(dedup, filters, row(str("other"), nil), false)
+	if got == nil || got.Op != DeleteOp || len(got.Column) != 1 || got.Column[0].Name != "id" {
+		t.Errorf("changed row: got %v; want delete", got)
+	}
+	c = row(str("diku"), nil)
+	c.Column = c.Column[:2]
+	if match, _ := MatchRowFilters(dedup, filters, c); match {
+		t.Error("row with missing filter column: got match; want no match")
+	}
+	c = row(nil, str("active"))
+	c.Column[1].Unavailable = true
+	if got := FilterRow(dedup, filters, c, false); got != c || !c.RequireCurrent {
+		t.Errorf("row with unavailable filter column: got %v; want unchanged, requiring current row", got)
+	}
+	c = row(nil, str("test"))
+	c.Column[1].Unavailable = true
+	if got := FilterRow(dedup, filters, c, false); got == nil || got.Op != DeleteOp {
+		t.Errorf("row with unavailable filter column not satisfying another filter: got %v; want delete", got)
+	}
+	if _, err = ParseRowFilters([]string{"^folio_users\\.users$ status"}); err == nil {
+		t.Error("expected error for filter without value")
+	}
+}
+
+func TestFilterRowUnavailableValue(t *testing.T) {
+	filters, err := ParseRowFilters([]string{`^s\.t$ status = active`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseTableKeys([]string{`^s\.t$ id`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := `{"op":"u","source":{"ts_ms":1700000000000,"schema":"s","table":"t"},` +
+		`"before":null,"after":{"id":1,"status":"__debezium_unavailable_value"}}`
+	ce, err := change.NewEvent(&kafka.Message{Value: []byte(value)}, change.SchemalessDecoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Init(io.Discard, false, false)
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{RowFilters: filters, TableKeys: keys}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != MergeOp || !c.RequireCurrent {
+		t.Errorf("got %v; want merge requiring current row", c)
+	}
+}
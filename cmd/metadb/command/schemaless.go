@@ -0,0 +1,256 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/internal/uuid"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// ColumnCatalog provides the database types of existing columns.  It is used
+// to interpret change events that do not include a schema.
+type ColumnCatalog interface {
+	// Column returns the data type of a column, or nil if the column
+	// does not exist.
+	Column(column *dbx.Column) *string
+}
+
+// isSchemaless returns true if the change event was read from a data source
+// configured with the format json-schemaless, i.e. it was written by the Kafka
+// Connect JSON converter with schemas disabled.  Other change events that
+// lack a schema are not treated as schemaless.
+func isSchemaless(ce *change.Event) bool {
+	return ce.Schemaless
+}
+
+// schemalessPrimaryKey returns the primary key columns of a schemaless change
+// event.  The field order of the key is not available, and so key columns are
+// numbered in order of their names.
+func schemalessPrimaryKey(ce *change.Event) []string {
+	key := make([]string, 0, len(ce.Key.Payload))
+	for k := range ce.Key.Payload {
+		key = append(key, k)
+	}
+	sort.Strings(key)
+	return key
+}
+
+// extractSchemalessColumns is the equivalent of extractColumns for change
+// events that do not include a schema.  Column types are inferred from the
+// data, and existing column types in the catalog are used where the data are
+// compatible with them.
+func extractSchemalessColumns(ce *change.Event, cat ColumnCatalog, table *dbx.Table, key *rowKey) ([]CommandColumn, error) {
+	if ce.Value == nil || ce.Value.Payload == nil || ce.Value.Payload.After == nil {
+		return nil, fmt.Errorf("value: $.payload.after not found")
+	}
+	return schemalessRowColumns("after", ce.Value.Payload.After, cat, table, key)
+}
+
+// schemalessBeforeColumns is the equivalent of extractBeforeColumns for
+// change events that do not include a schema.
+func schemalessBeforeColumns(ce *change.Event, cat ColumnCatalog, table *dbx.Table, key *rowKey) ([]CommandColumn, error) {
+	if ce.Value == nil || ce.Value.Payload == nil || ce.Value.Payload.Before == nil {
+		return nil, nil
+	}
+	var before map[string]any
+	if err := change.Unmarshal(*ce.Value.Payload.Before, &before); err != nil {
+		return nil, fmt.Errorf("value: $.payload.before: %w", err)
+	}
+	if before == nil {
+		return nil, nil
+	}
+	column, err := schemalessRowColumns("before", before, cat, table, key)
+	if err != nil {
+		return nil, err
+	}
+	return PrimaryKeyColumns(column), nil
+}
+
+// schemalessRowColumns returns the columns of a row in the field of a change
+// event named by section, which contains data.
+func schemalessRowColumns(section string, data map[string]any, cat ColumnCatalog, table *dbx.Table, key *rowKey) ([]CommandColumn, error) {
+	for k := range key.position {
+		if _, ok := data[k]; !ok {
+			return nil, fmt.Errorf("value: $.payload.%s: key field %q not found", section, k)
+		}
+	}
+	fields := make([]string, 0, len(data))
+	for f := range data {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	var column []CommandColumn
+	for i, f := range fields {
+		col, ok, err := inferColumn(f, data[f], columnType(cat, table, f))
+		if err != nil {
+			return nil, fmt.Errorf("value: $.payload.%s: %q: %w", section, f, err)
+		}
+		if !ok {
+			continue
+		}
+		if key.fullRow {
+			col.PrimaryKey = i + 1
+		} else {
+			col.PrimaryKey = key.position[f]
+		}
+		column = append(column, col)
+	}
+	return column, nil
+}
+
+// schemalessKeyColumns returns the primary key columns of a schemaless delete
+// event.
+func schemalessKeyColumns(ce *change.Event, cat ColumnCatalog, table *dbx.Table) ([]CommandColumn, error) {
+	key := schemalessPrimaryKey(ce)
+	var column []CommandColumn
+	for i, k := range key {
+		col, ok, err := inferColumn(k, ce.Key.Payload[k], columnType(cat, table, k))
+		if err != nil {
+			return nil, fmt.Errorf("delete: key: %q: %w", k, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("delete: key: %q: null value", k)
+		}
+		col.PrimaryKey = i + 1
+		column = append(column, col)
+	}
+	return column, nil
+}
+
+// keyPositions returns the position of each column in a key.
+func keyPositions(key []string) map[string]int {
+	position := make(map[string]int)
+	for i, k := range key {
+		position[k] = i + 1
+	}
+	return position
+}
+
+func columnType(cat ColumnCatalog, table *dbx.Table, column string) *string {
+	if cat == nil {
+		return nil
+	}
+	return cat.Column(&dbx.Column{Schema: table.Schema, Table: table.Table, Column: column})
+}
+
+// inferColumn creates a column from schemaless data.  If existing is not nil,
+// it is the database type of the column.  The returned bool is false if the
+// column type cannot be determined, i.e. the value is null and the column
+// does not exist.
+func inferColumn(name string, data any, existing *string) (CommandColumn, bool, error) {
+	col := CommandColumn{Name: name, Data: data}
+	var dtype DataType
+	var dtypeSize int64
+	if existing != nil {
+		dtype, dtypeSize = MakeDataType(*existing)
+	}
+	switch v := data.(type) {
+	case nil:
+		if existing == nil {
+			return col, false, nil
+		}
+		col.DType, col.DTypeSize = dtype, dtypeSize
+	case bool:
+		col.DType = BooleanType
+		col.SQLData, _ = DataToSQLData(v, BooleanType, "")
+	case float64:
+		inferNumber(&col, v, existing != nil, dtype, dtypeSize)
+	case json.Number:
+		f, _ := floatData(v)
+		inferNumber(&col, f, existing != nil, dtype, dtypeSize)
+	case string:
+		if v == unavailableValue {
+			col.Data = nil
+			col.Unavailable = true
+			if existing != nil {
+				col.DType, col.DTypeSize = dtype, dtypeSize
+			} else {
+				col.DType = TextType
+			}
+			break
+		}
+		col.DType = inferTypeFromSchemalessString(v)
+		if existing != nil {
+			switch {
+			case dtype == UUIDType && uuid.IsUUID(v):
+				col.DType = UUIDType
+			case dtype == JSONType && json.Valid([]byte(v)):
+				col.DType = JSONType
+			case dtype == TextType:
+				col.DType = TextType
+			}
+		}
+		s := v
+		col.SQLData = &s
+	case map[string]any, []any:
+		j, err := json.Marshal(v)
+		if err != nil {
+			return col, false, err
+		}
+		col.DType = JSONType
+		if existing != nil && dtype == TextType {
+			col.DType = TextType
+		}
+		s := string(j)
+		col.Data = s
+		col.SQLData = &s
+	default:
+		return col, false, fmt.Errorf("unexpected type %T", data)
+	}
+	return col, true, nil
+}
+
+// inferNumber sets the type and data of a column from a JSON number.  Integral
+// values are stored as integers unless the column already has a floating-point
+// or numeric type.
+func inferNumber(col *CommandColumn, v float64, exists bool, dtype DataType, dtypeSize int64) {
+	integral := v == math.Trunc(v) && math.Abs(v) < 1<<53
+	var s string
+	if integral {
+		s = strconv.FormatInt(int64(v), 10)
+	} else {
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	col.SQLData = &s
+	switch {
+	case exists && (dtype == FloatType || dtype == NumericType):
+		col.DType, col.DTypeSize = dtype, dtypeSize
+	case integral:
+		col.DType = IntegerType
+		col.DTypeSize = 8
+		if exists && dtype == IntegerType {
+			col.DTypeSize = max(dtypeSize, integerSize(int64(v)))
+		}
+	default:
+		col.DType = NumericType
+	}
+}
+
+func integerSize(i int64) int64 {
+	switch {
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return 2
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// inferTypeFromSchemalessString extends InferTypeFromString to recognize UUID
+// and JSON values, which schemaless change events encode as strings.
+func inferTypeFromSchemalessString(data string) DataType {
+	if len(data) == 36 && uuid.IsUUID(data) {
+		return UUIDType
+	}
+	if t := strings.TrimSpace(data); (strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[")) && json.Valid([]byte(t)) {
+		return JSONType
+	}
+	return InferTypeFromString(data)
+}
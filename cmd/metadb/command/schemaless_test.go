@@ -0,0 +1,40 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestInferColumnInteger(t *testing.T) {
+	col, ok, err := inferColumn("n", float64(42), nil)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v; want true, nil", ok, err)
+	}
+	if col.DType != IntegerType || col.DTypeSize != 8 || *col.SQLData != "42" {
+		t.Errorf("got %v(%d) %q; want IntegerType(8) \"42\"", col.DType, col.DTypeSize, *col.SQLData)
+	}
+}
+
+func TestInferColumnExistingNumeric(t *testing.T) {
+	existing := "numeric"
+	col, ok, err := inferColumn("n", float64(42), &existing)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v; want true, nil", ok, err)
+	}
+	if col.DType != NumericType || *col.SQLData != "42" {
+		t.Errorf("got %v %q; want NumericType \"42\"", col.DType, *col.SQLData)
+	}
+}
+
+func TestInferColumnNullNotExisting(t *testing.T) {
+	_, ok, err := inferColumn("n", nil, nil)
+	if err != nil || ok {
+		t.Errorf("got %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestInferColumnTimestamptz(t *testing.T) {
+	col, _, _ := inferColumn("t", "2022-01-11T14:07:44.4Z", nil)
+	if col.DType != TimestamptzType {
+		t.Errorf("got %v; want TimestamptzType", col.DType)
+	}
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+)
+
+// TableKey defines the key columns of tables whose schema-qualified names
+// match Table, in place of the primary key in the source database.
+type TableKey struct {
+	Table   *regexp.Regexp
+	Columns []string
+}
+
+// ParseTableKeys compiles a list of table keys, each in the form
+// "table_regexp column1 column2 ...".
+func ParseTableKeys(keys []string) ([]TableKey, error) {
+	var tk []TableKey
+	for _, k := range keys {
+		f := strings.Fields(k)
+		if len(f) < 2 {
+			return nil, &dberr.Error{
+				Err:  fmt.Errorf("invalid table key %q", k),
+				Hint: "A table key has the form 'table_regexp column1 column2 ...'.",
+			}
+		}
+		re, err := regexp.Compile(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid table key %q: %w", k, err)
+		}
+		tk = append(tk, TableKey{Table: re, Columns: f[1:]})
+	}
+	return tk, nil
+}
+
+// MatchTableKey returns the key columns defined for a table by the first
+// matching table key, or nil if there is none.
+func MatchTableKey(keys []TableKey, schema, table string) []string {
+	name := schema + "." + table
+	for _, k := range keys {
+		if k.Table.MatchString(name) {
+			return k.Columns
+		}
+	}
+	return nil
+}
+
+// KeyChanged returns true if the key values of old, a command containing the
+// previous values of a row, differ from those of c.  Unavailable values are
+// assumed to be unchanged.
+func KeyChanged(old, c *Command) bool {
+	key := PrimaryKeyColumns(c.Column)
+	oldKey := PrimaryKeyColumns(old.Column)
+	if len(key) != len(oldKey) {
+		return true
+	}
+	for i := range key {
+		if key[i].Name != oldKey[i].Name {
+			return true
+		}
+		if key[i].Unavailable || oldKey[i].Unavailable {
+			continue
+		}
+		a, b := key[i].SQLData, oldKey[i].SQLData
+		if (a == nil) != (b == nil) || (a != nil && *a != *b) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"io"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+func TestNewCommandWithoutPrimaryKey(t *testing.T) {
+	value := func(op string) []byte {
+		return []byte(`{"op":"` + op + `","source":{"ts_ms":1700000000000,"schema":"s","table":"t"},` +
+			`"before":{"a":1,"b":"x"},"after":{"a":1,"b":"y"}}`)
+	}
+	event := func(op string) *change.Event {
+		ce, err := change.NewEvent(&kafka.Message{Value: value(op)}, change.SchemalessDecoder{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ce
+	}
+	log.Init(io.Discard, false, false)
+	dedup := log.NewMessageSet()
+	c, _, err := NewCommand(dedup, event("u"), &SourceOptions{}, nil)
+	if err != nil || c != nil {
+		t.Errorf("no key: got %v, %v; want nil", c, err)
+	}
+
+	// A change event without a schema is not schemaless unless the data
+	// source has that format.
+	ce, err := change.NewEvent(&kafka.Message{Value: []byte(`{"payload":` + string(value("u")) + `}`)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = NewCommand(dedup, ce, &SourceOptions{FullRowKey: true}, nil); err == nil {
+		t.Error("event without schema from json source: got no error; want error")
+	}
+
+	c, _, err = NewCommand(dedup, event("u"), &SourceOptions{FullRowKey: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.FullRowKey || len(PrimaryKeyColumns(c.Column)) != 2 {
+		t.Errorf("full row: got key %v; want all columns", PrimaryKeyColumns(c.Column))
+	}
+	if c.Replaces == nil || c.Replaces.Op != DeleteOp || *c.Replaces.Column[1].SQLData != "x" {
+		t.Errorf("full row: got replaced row %v; want delete of previous row", c.Replaces)
+	}
+
+	keys, err := ParseTableKeys([]string{`^s\.t$ a`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err = NewCommand(dedup, event("u"), &SourceOptions{TableKeys: keys, FullRowKey: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := PrimaryKeyColumns(c.Column); c.FullRowKey || len(key) != 1 || key[0].Name != "a" {
+		t.Errorf("table key: got key %v; want a", key)
+	}
+	if c.Replaces != nil {
+		t.Errorf("table key: got replaced row %v; want nil", c.Replaces)
+	}
+
+	c, _, err = NewCommand(dedup, event("d"), &SourceOptions{TableKeys: keys}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Op != DeleteOp || len(c.Column) != 1 || *c.Column[0].SQLData != "1" {
+		t.Errorf("table key: got %v; want delete of a=1", c)
+	}
+	if _, err = ParseTableKeys([]string{`^s\.t$`}); err == nil {
+		t.Error("expected error for table key without columns")
+	}
+}
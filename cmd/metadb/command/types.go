@@ -0,0 +1,274 @@
+package command
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// unavailableValue is the placeholder that Debezium writes in place of TOAST
+// values that were not modified.
+const unavailableValue = "__debezium_unavailable_value"
+
+// isUnavailableValue returns true if data is the Debezium placeholder for an
+// unavailable value of the specified type.
+func isUnavailableValue(data any, datatype DataType) bool {
+	switch datatype {
+	case TextType, JSONType:
+		s, ok := data.(string)
+		return ok && s == unavailableValue
+	case ByteaType:
+		s, ok := data.(string)
+		if !ok {
+			return false
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		return err == nil && string(b) == unavailableValue
+	case BooleanArrayType, IntegerArrayType, FloatArrayType, NumericArrayType, TextArrayType, UUIDArrayType:
+		a, ok := data.([]any)
+		if !ok || len(a) != 1 {
+			return false
+		}
+		s, ok := a[0].(string)
+		return ok && s == unavailableValue
+	default:
+		return false
+	}
+}
+
+// elementType returns the element type of an array type.
+func elementType(datatype DataType) DataType {
+	switch datatype {
+	case BooleanArrayType:
+		return BooleanType
+	case IntegerArrayType:
+		return IntegerType
+	case FloatArrayType:
+		return FloatType
+	case NumericArrayType:
+		return NumericType
+	case TextArrayType:
+		return TextType
+	case UUIDArrayType:
+		return UUIDType
+	default:
+		return UnknownType
+	}
+}
+
+// arrayType returns the array type that has the specified element type.
+func arrayType(elemType DataType) DataType {
+	switch elemType {
+	case BooleanType:
+		return BooleanArrayType
+	case IntegerType:
+		return IntegerArrayType
+	case FloatType:
+		return FloatArrayType
+	case NumericType:
+		return NumericArrayType
+	case TextType:
+		return TextArrayType
+	case UUIDType:
+		return UUIDArrayType
+	default:
+		return UnknownType
+	}
+}
+
+// makeArrayDataType is the equivalent of MakeDataType for an array type, given
+// the database type of its elements.  Element types read from the database
+// catalog use internal names such as "int4".
+func makeArrayDataType(elem string) (DataType, int64) {
+	switch strings.ToLower(elem) {
+	case "bool":
+		elem = "boolean"
+	case "int2":
+		elem = "smallint"
+	case "int4":
+		elem = "integer"
+	case "int8":
+		elem = "bigint"
+	case "float4":
+		elem = "real"
+	case "float8":
+		elem = "double precision"
+	}
+	et, size := MakeDataType(elem)
+	dtype := arrayType(et)
+	if dtype == UnknownType {
+		log.Error("make data type new: unknown array element type: %s", elem)
+		return UnknownType, 0
+	}
+	return dtype, size
+}
+
+// arrayItems returns the schema of the elements of an array field.
+func arrayItems(fieldMap map[string]any) (map[string]any, error) {
+	items, ok := fieldMap["items"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("array \"items\" not found")
+	}
+	return items, nil
+}
+
+// convertArrayType converts the element schema of an array field to an array
+// type.  Arrays of elements that do not have a corresponding array type are
+// stored as JSON.
+func convertArrayType(items map[string]any) (DataType, error) {
+	itype, ok := items["type"].(string)
+	if !ok {
+		return 0, fmt.Errorf("convert data type: array \"items\": \"type\" not found")
+	}
+	iname, _ := items["name"].(string)
+	et, err := convertDataType(itype, iname)
+	if err != nil {
+		return JSONType, nil
+	}
+	if dtype := arrayType(et); dtype != UnknownType {
+		return dtype, nil
+	}
+	return JSONType, nil
+}
+
+// convertStructuredData prepares data of types that require more than the
+// semantic type to be converted: arrays, bit strings, and geometries.
+// Decimal values are converted in advance by decodeNumericBytes.
+func convertStructuredData(fieldMap, items map[string]any, data any, datatype DataType, semtype string) (any, error) {
+	switch {
+	case items != nil && datatype == JSONType:
+		// Array of elements that are stored as JSON.
+		j, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return string(j), nil
+	case datatype == NumericArrayType:
+		a, ok := data.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
+		}
+		iname, _ := items["name"].(string)
+		n := make([]any, len(a))
+		for i := range a {
+			if a[i] == nil {
+				continue
+			}
+			s, err := decodeNumericBytes(items, a[i], iname)
+			if err != nil {
+				return nil, fmt.Errorf("decoding numeric bytes: %w", err)
+			}
+			n[i] = s
+		}
+		return n, nil
+	case strings.HasSuffix(semtype, ".data.Bits"):
+		return decodeBits(fieldMap, data)
+	case strings.HasPrefix(semtype, "io.debezium.data.geometry."):
+		return encodeEWKB(data)
+	default:
+		return data, nil
+	}
+}
+
+// decodeBits converts an io.debezium.data.Bits value to a string of '0' and
+// '1' characters.  The bytes contain the bits in little-endian order.
+func decodeBits(fieldMap map[string]any, data any) (string, error) {
+	s, ok := data.(string)
+	if !ok {
+		return "", fmt.Errorf("bits data \"%v\" has type %T", data, data)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode bits: %q", s)
+	}
+	length := len(b) * 8
+	if p, ok := fieldMap["parameters"].(map[string]any); ok {
+		if l, ok := p["length"].(string); ok {
+			if length, err = strconv.Atoi(l); err != nil {
+				return "", fmt.Errorf("parse error: length parameter: %q", l)
+			}
+		}
+	}
+	var bits strings.Builder
+	for i := length - 1; i >= 0; i-- {
+		if i/8 < len(b) && b[i/8]&(1<<(i%8)) != 0 {
+			bits.WriteByte('1')
+		} else {
+			bits.WriteByte('0')
+		}
+	}
+	return bits.String(), nil
+}
+
+// encodeEWKB converts a Debezium geometry value, which consists of WKB data
+// and an SRID, to the EWKB format used by PostGIS.  The result is base64
+// encoded, in the same way as other binary data.
+func encodeEWKB(data any) (string, error) {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("geometry data \"%v\" has type %T", data, data)
+	}
+	s, ok := m["wkb"].(string)
+	if !ok {
+		return "", fmt.Errorf("geometry data: \"wkb\" not found")
+	}
+	srid, ok := floatData(m["srid"])
+	if !ok {
+		return s, nil
+	}
+	wkb, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(wkb) < 5 {
+		return "", fmt.Errorf("unable to decode geometry: %q", s)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if wkb[0] == 1 {
+		order = binary.LittleEndian
+	}
+	const sridFlag = 0x20000000
+	ewkb := make([]byte, 9, len(wkb)+4)
+	ewkb[0] = wkb[0]
+	order.PutUint32(ewkb[1:5], order.Uint32(wkb[1:5])|sridFlag)
+	order.PutUint32(ewkb[5:9], uint32(srid))
+	ewkb = append(ewkb, wkb[5:]...)
+	return base64.StdEncoding.EncodeToString(ewkb), nil
+}
+
+// arrayToSQLData converts an array to the text form of a PostgreSQL array.
+func arrayToSQLData(data any, datatype DataType) (*string, error) {
+	a, ok := data.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
+	}
+	et := elementType(datatype)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := range a {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		e, err := DataToSQLData(a[i], et, "")
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			b.WriteString("NULL")
+			continue
+		}
+		b.WriteByte('"')
+		for _, c := range *e {
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	s := b.String()
+	return &s, nil
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestArrayToSQLData(t *testing.T) {
+	data := []any{"a", nil, `b"c\d`}
+	want := `{"a",NULL,"b\"c\\d"}`
+	got, err := arrayToSQLData(data, TextArrayType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("got %v; want %v", *got, want)
+	}
+}
+
+func TestMakeArrayDataType(t *testing.T) {
+	dtype, size := MakeDataType("int4[]")
+	if dtype != IntegerArrayType || size != 4 {
+		t.Errorf("got %v, %v; want IntegerArrayType, 4", dtype, size)
+	}
+	if got := DataTypeToSQL(dtype, size); got != "integer[]" {
+		t.Errorf("got %v; want integer[]", got)
+	}
+}
+
+func TestDecodeBits(t *testing.T) {
+	fieldMap := map[string]any{"parameters": map[string]any{"length": "10"}}
+	// Bits 0 and 9 are set.
+	got, err := decodeBits(fieldMap, "AQI=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1000000001"
+	if got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package dberr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// FatalError is an error that is not expected to be resolved by retrying the
+// operation, such as a change event that cannot be parsed.
+type FatalError struct {
+	Err error
+}
+
+func (e *FatalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// TransientError is an error that is expected to be resolved by retrying the
+// operation, although it is not recognized as such from its type, such as a
+// failure to read from a schema registry.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient returns true if err is likely to have been caused by a
+// temporary condition, such as a network, Kafka, or PostgreSQL outage, so that
+// the operation may succeed if it is retried.  Errors that are not recognized
+// are not considered to be transient, and neither are errors that wrap a
+// FatalError.  Errors that wrap a TransientError are transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var fatal *FatalError
+	if errors.As(err, &fatal) {
+		return false
+	}
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var kerr kafka.Error
+	if errors.As(err, &kerr) {
+		return isTransientKafka(kerr)
+	}
+	var pgerr *pgconn.PgError
+	if errors.As(err, &pgerr) {
+		return isTransientSQLState(pgerr.Code)
+	}
+	var connerr *pgconn.ConnectError
+	if errors.As(err, &connerr) {
+		return true
+	}
+	if pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	var neterr net.Error
+	if errors.As(err, &neterr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func isTransientKafka(err kafka.Error) bool {
+	if err.IsFatal() {
+		return false
+	}
+	switch err.Code() {
+	case kafka.ErrInvalidArg, kafka.ErrTopicAuthorizationFailed,
+		kafka.ErrGroupAuthorizationFailed, kafka.ErrSaslAuthenticationFailed, kafka.ErrAuthentication:
+		return false
+	default:
+		return true
+	}
+}
+
+// isTransientSQLState returns true if a PostgreSQL error code indicates a
+// condition that may be temporary.
+func isTransientSQLState(code string) bool {
+	if len(code) < 2 {
+		return true
+	}
+	switch code[0:2] {
+	case "08", // Connection exception
+		"40", // Transaction rollback, e.g. deadlock or serialization failure
+		"53", // Insufficient resources
+		"57", // Operator intervention, e.g. server shutdown
+		"58": // System error
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+package dberr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransient(t *testing.T) {
+	pgerr := func(code string) error {
+		return &pgconn.PgError{Severity: "ERROR", Code: code}
+	}
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection failure", pgerr("08006"), true},
+		{"serialization failure", pgerr("40001"), true},
+		{"deadlock", pgerr("40P01"), true},
+		{"too many connections", pgerr("53300"), true},
+		{"admin shutdown", pgerr("57P01"), true},
+		{"io error", pgerr("58030"), true},
+		{"unique violation", pgerr("23505"), false},
+		{"not null violation", pgerr("23502"), false},
+		{"undefined table", pgerr("42P01"), false},
+		{"syntax error", pgerr("42601"), false},
+		{"insufficient privilege", pgerr("42501"), false},
+		{"wrapped connection failure", fmt.Errorf("exec: %w", fmt.Errorf("merge: %w", pgerr("08006"))), true},
+		{"wrapped unique violation", fmt.Errorf("exec: %w", pgerr("23505")), false},
+		{"fatal wrapping transient", &FatalError{Err: pgerr("08006")}, false},
+		{"wrapped fatal", fmt.Errorf("parser: %w", &FatalError{Err: io.EOF}), false},
+		{"transient wrapping fatal code", &TransientError{Err: pgerr("42P01")}, true},
+		{"wrapped transient", fmt.Errorf("parser: %w", &TransientError{Err: errors.New("registry")}), true},
+		{"kafka transport", kafka.NewError(kafka.ErrTransport, "broker down", false), true},
+		{"kafka fatal", kafka.NewError(kafka.ErrTransport, "fenced", true), false},
+		{"kafka authentication", kafka.NewError(kafka.ErrSaslAuthenticationFailed, "denied", false), false},
+		{"eof", fmt.Errorf("reading: %w", io.EOF), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{"other", errors.New("invalid data"), false},
+		{"string containing code", errors.New("ERROR: 08006"), false},
+	}
+	for _, c := range cases {
+		if got := IsTransient(c.err); got != c.want {
+			t.Errorf("%s: got %v; want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -54,6 +54,42 @@ func (t Table) MainSQL() string {
 	return "\"" + t.Schema + "\".\"" + t.Table + "__\""
 }
 
+// AsOfFuncSQL returns the signature of the function that selects the rows of
+// the table that were current at a point in time.
+func (t Table) AsOfFuncSQL() string {
+	return "\"" + t.Schema + "\".\"" + t.Table + "__asof\"(timestamptz)"
+}
+
+// ChangesFuncSQL returns the signature of the function that selects the row
+// versions of the table that started or ended within a time interval.
+func (t Table) ChangesFuncSQL() string {
+	return "\"" + t.Schema + "\".\"" + t.Table + "__changes\"(timestamptz, timestamptz)"
+}
+
+// MaxIdentifierLength is the maximum length in bytes of an identifier in
+// PostgreSQL.  Longer identifiers are truncated.
+const MaxIdentifierLength = 63
+
+// HasFuncs returns true if the names of the point-in-time query functions of
+// the table fit within MaxIdentifierLength.  The functions are not created
+// for a table having a longer name, because the truncated names could refer
+// to the functions of another table.
+func (t Table) HasFuncs() bool {
+	return len(t.Table)+len("__changes") <= MaxIdentifierLength
+}
+
+// GrantFuncsSQL returns a statement that grants a user access to the
+// point-in-time query functions of the table.
+func (t Table) GrantFuncsSQL(user string) string {
+	return "GRANT EXECUTE ON FUNCTION " + t.AsOfFuncSQL() + ", " + t.ChangesFuncSQL() + " TO " + user
+}
+
+// RevokeFuncsSQL returns a statement that revokes access by a user to the
+// point-in-time query functions of the table.
+func (t Table) RevokeFuncsSQL(user string) string {
+	return "REVOKE EXECUTE ON FUNCTION " + t.AsOfFuncSQL() + ", " + t.ChangesFuncSQL() + " FROM " + user
+}
+
 type Column struct {
 	Schema string
 	Table  string
@@ -155,7 +155,13 @@ func EndSync(opt *option.EndSync) error {
 			if _, err = dp.Exec(context.TODO(), q); err != nil {
 				return err
 			}
-			q = "UPDATE " + t.MainSQL() + " SET __end='" + now + "',__current='f' " +
+			// Rows ended here were not deleted in the source
+			// by a known change event.
+			var audit string
+			if cat.AuditColumns(&t) {
+				audit = ",__op='endsync',__source_position=NULL"
+			}
+			q = "UPDATE " + t.MainSQL() + " SET __end='" + now + "',__current='f'" + audit + " " +
 				"WHERE __current AND" +
 				" NOT EXISTS (SELECT __id FROM " + synctsql + " s WHERE " + t.MainSQL() + ".__id=s.__id)"
 			if _, err = dp.Exec(context.TODO(), q); err != nil {
@@ -203,8 +209,9 @@ func EndSync(opt *option.EndSync) error {
 	// Sync marctab for full update and schedule maintenance.
 	q := "UPDATE marctab.metadata SET version = 0"
 	_, _ = dp.Exec(context.TODO(), q)
-	q = "UPDATE metadb.maintenance SET next_maintenance_time = next_maintenance_time - interval '1 day'"
-	if _, err = dp.Exec(context.TODO(), q); err != nil {
+	q = "UPDATE metadb.maintenance SET next_maintenance_time = next_maintenance_time - interval '1 day'" +
+		" WHERE source_name=$1"
+	if _, err = dp.Exec(context.TODO(), q, opt.Source); err != nil {
 		return err
 	}
 	//log.Init(ioutil.Discard, false, false)
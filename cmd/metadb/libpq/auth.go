@@ -0,0 +1,272 @@
+package libpq
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+const scramSHA256 = "SCRAM-SHA-256"
+
+// authenticate performs password authentication of the user named in the
+// startup message.  Only the Metadb system user and the database superuser
+// are permitted to connect.  The password is verified against the secret
+// stored for the role in pg_authid, using SCRAM-SHA-256 or MD5 depending on
+// how the secret was encrypted.
+func authenticate(backend *pgproto3.Backend, username string, db *dbx.DB) error {
+	if username == "" {
+		return fmt.Errorf("no user name specified")
+	}
+	if username != db.User && username != db.SuperUser {
+		return fmt.Errorf("role %q is not permitted to connect", username)
+	}
+	secret, err := readRolePassword(db, username)
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(secret, scramSHA256+"$"):
+		err = authenticateSCRAM(backend, secret)
+	case strings.HasPrefix(secret, "md5"):
+		err = authenticateMD5(backend, secret)
+	default:
+		err = errors.New("unsupported password encryption")
+	}
+	if err != nil {
+		return fmt.Errorf("password authentication failed for user %q", username)
+	}
+	return nil
+}
+
+// CheckAuth verifies that the passwords of clients can be checked, which
+// requires reading pg_authid as the database superuser.  It is called when
+// the server starts, so that a superuser without that privilege, as in some
+// managed database services, is reported clearly.
+func CheckAuth(db *dbx.DB) error {
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dcsuper)
+	q := "SELECT 1 FROM pg_catalog.pg_authid LIMIT 0"
+	if _, err = dcsuper.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("client authentication requires %q to be a superuser able to read pg_authid: %w",
+			db.SuperUser, err)
+	}
+	return nil
+}
+
+// readRolePassword reads the password secret of a role from pg_authid, as
+// the database superuser.
+func readRolePassword(db *dbx.DB, username string) (string, error) {
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return "", err
+	}
+	defer dbx.Close(dcsuper)
+	var secret *string
+	q := "SELECT rolpassword FROM pg_catalog.pg_authid WHERE rolname=$1 AND rolcanlogin"
+	err = dcsuper.QueryRow(context.TODO(), q, username).Scan(&secret)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", fmt.Errorf("password authentication failed for user %q", username)
+	case err != nil:
+		return "", fmt.Errorf("reading password for user %q: %w", username, err)
+	case secret == nil:
+		return "", fmt.Errorf("password authentication failed for user %q", username)
+	default:
+		return *secret, nil
+	}
+}
+
+// authenticateMD5 checks an MD5 password response.  The stored secret has
+// the form "md5" || md5(password || username).
+func authenticateMD5(backend *pgproto3.Backend, secret string) error {
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return err
+	}
+	backend.Send(&pgproto3.AuthenticationMD5Password{Salt: salt})
+	if err := backend.Flush(); err != nil {
+		return err
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeMD5Password); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return err
+	}
+	pw, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message: %T", msg)
+	}
+	sum := md5.Sum(append([]byte(strings.TrimPrefix(secret, "md5")), salt[:]...))
+	expected := "md5" + hex.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(pw.Password), []byte(expected)) != 1 {
+		return errors.New("password does not match")
+	}
+	return nil
+}
+
+// authenticateSCRAM runs the server side of a SCRAM-SHA-256 exchange (RFC
+// 7677) using a secret in the PostgreSQL format:
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+func authenticateSCRAM(backend *pgproto3.Backend, secret string) error {
+	iterations, salt, storedKey, serverKey, err := parseSCRAMSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	// Receive client-first-message.
+	backend.Send(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{scramSHA256}})
+	if err = backend.Flush(); err != nil {
+		return err
+	}
+	if err = backend.SetAuthType(pgproto3.AuthTypeSASL); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return err
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok {
+		return fmt.Errorf("unexpected message: %T", msg)
+	}
+	if initial.AuthMechanism != scramSHA256 {
+		return fmt.Errorf("unsupported SASL mechanism %q", initial.AuthMechanism)
+	}
+	clientFirst := string(initial.Data)
+	if !strings.HasPrefix(clientFirst, "n,,") && !strings.HasPrefix(clientFirst, "y,,") {
+		return errors.New("channel binding not supported")
+	}
+	gs2Header, clientFirstBare := clientFirst[:3], clientFirst[3:]
+	clientNonce := scramAttribute(clientFirstBare, 'r')
+	if clientNonce == "" {
+		return errors.New("client nonce not found")
+	}
+
+	// Send server-first-message.
+	nonce := make([]byte, 18)
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	combinedNonce := clientNonce + base64.StdEncoding.EncodeToString(nonce)
+	serverFirst := "r=" + combinedNonce + ",s=" + base64.StdEncoding.EncodeToString(salt) +
+		",i=" + strconv.Itoa(iterations)
+	backend.Send(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)})
+	if err = backend.Flush(); err != nil {
+		return err
+	}
+
+	// Receive client-final-message and verify the proof.
+	if err = backend.SetAuthType(pgproto3.AuthTypeSASLContinue); err != nil {
+		return err
+	}
+	if msg, err = backend.Receive(); err != nil {
+		return err
+	}
+	response, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return fmt.Errorf("unexpected message: %T", msg)
+	}
+	clientFinal := string(response.Data)
+	i := strings.LastIndex(clientFinal, ",p=")
+	if i < 0 {
+		return errors.New("client proof not found")
+	}
+	clientFinalWithoutProof := clientFinal[:i]
+	// The channel binding attribute repeats the GS2 header of the
+	// client-first-message.
+	if scramAttribute(clientFinalWithoutProof, 'c') != base64.StdEncoding.EncodeToString([]byte(gs2Header)) {
+		return errors.New("channel binding does not match")
+	}
+	if scramAttribute(clientFinalWithoutProof, 'r') != combinedNonce {
+		return errors.New("nonce does not match")
+	}
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[i+3:])
+	if err != nil || len(proof) != sha256.Size {
+		return errors.New("invalid client proof")
+	}
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+	clientSignature := scramHMAC(storedKey, authMessage)
+	clientKey := make([]byte, sha256.Size)
+	for j := range clientKey {
+		clientKey[j] = proof[j] ^ clientSignature[j]
+	}
+	computedStoredKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(computedStoredKey[:], storedKey) != 1 {
+		return errors.New("password does not match")
+	}
+
+	// Send server-final-message.
+	serverSignature := scramHMAC(serverKey, authMessage)
+	backend.Send(&pgproto3.AuthenticationSASLFinal{
+		Data: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)),
+	})
+	if err = backend.Flush(); err != nil {
+		return err
+	}
+	return backend.SetAuthType(pgproto3.AuthTypeOk)
+}
+
+func parseSCRAMSecret(secret string) (int, []byte, []byte, []byte, error) {
+	invalid := errors.New("invalid SCRAM secret")
+	s := strings.Split(secret, "$")
+	if len(s) != 3 {
+		return 0, nil, nil, nil, invalid
+	}
+	iterSalt := strings.Split(s[1], ":")
+	keys := strings.Split(s[2], ":")
+	if len(iterSalt) != 2 || len(keys) != 2 {
+		return 0, nil, nil, nil, invalid
+	}
+	iterations, err := strconv.Atoi(iterSalt[0])
+	if err != nil {
+		return 0, nil, nil, nil, invalid
+	}
+	salt, err := base64.StdEncoding.DecodeString(iterSalt[1])
+	if err != nil {
+		return 0, nil, nil, nil, invalid
+	}
+	storedKey, err := base64.StdEncoding.DecodeString(keys[0])
+	if err != nil || len(storedKey) != sha256.Size {
+		return 0, nil, nil, nil, invalid
+	}
+	serverKey, err := base64.StdEncoding.DecodeString(keys[1])
+	if err != nil || len(serverKey) != sha256.Size {
+		return 0, nil, nil, nil, invalid
+	}
+	return iterations, salt, storedKey, serverKey, nil
+}
+
+// scramAttribute returns the value of a SCRAM attribute from a
+// comma-separated message, or "" if it is not present.
+func scramAttribute(message string, name byte) string {
+	for _, a := range strings.Split(message, ",") {
+		if len(a) >= 2 && a[0] == name && a[1] == '=' {
+			return a[2:]
+		}
+	}
+	return ""
+}
+
+func scramHMAC(key, message []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(message)
+	return h.Sum(nil)
+}
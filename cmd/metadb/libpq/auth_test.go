@@ -0,0 +1,203 @@
+package libpq
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// testSCRAMSecret is the pg_authid.rolpassword of a role with password
+// "secret", salt "0123456789abcdef", and 4096 iterations.
+const testSCRAMSecret = "SCRAM-SHA-256$4096:MDEyMzQ1Njc4OWFiY2RlZg==$" + testSCRAMKeys
+
+const testSCRAMKeys = "bpSY5Ze9NUH+I35LC3gVq+DpBfK46iXBxvhAKqVu9pE=:VpYlBuxyzeCI1KnctrefdljpB1mk3Gp7sBI/t11+NkQ="
+
+// testMD5Secret is the pg_authid.rolpassword of role "metadb" with password
+// "secret".
+const testMD5Secret = "md5a75c9b036b8c1b0ec1cba01a496518b8"
+
+func TestParseSCRAMSecret(t *testing.T) {
+	iterations, salt, storedKey, serverKey, err := parseSCRAMSecret(testSCRAMSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iterations != 4096 || string(salt) != "0123456789abcdef" ||
+		len(storedKey) != sha256.Size || len(serverKey) != sha256.Size {
+		t.Errorf("got %d, %q, %d-byte stored key, %d-byte server key", iterations, salt,
+			len(storedKey), len(serverKey))
+	}
+	invalid := []string{
+		"",
+		"SCRAM-SHA-256$4096:MDEyMzQ1Njc4OWFiY2RlZg==",
+		"SCRAM-SHA-256$x:MDEyMzQ1Njc4OWFiY2RlZg==$" + testSCRAMKeys,
+		"SCRAM-SHA-256$4096:MDEy!$" + testSCRAMKeys,
+		"SCRAM-SHA-256$4096:MDEyMzQ1Njc4OWFiY2RlZg==$YWJj:YWJj",
+		"SCRAM-SHA-256$4096$MDEyMzQ1Njc4OWFiY2RlZg==$a:b",
+	}
+	for _, secret := range invalid {
+		if _, _, _, _, err := parseSCRAMSecret(secret); err == nil {
+			t.Errorf("%q: expected error", secret)
+		}
+	}
+}
+
+func TestAuthenticateSCRAM(t *testing.T) {
+	cases := []struct {
+		name      string
+		password  string
+		gs2Header string
+		ok        bool
+	}{
+		{"valid", "secret", "n,,", true},
+		{"wrong password", "wrong", "n,,", false},
+		{"channel binding mismatch", "secret", "y,,", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			frontend, errc := startAuth(t, func(backend *pgproto3.Backend) error {
+				return authenticateSCRAM(backend, testSCRAMSecret)
+			})
+			scramClient(t, frontend, c.password, c.gs2Header, c.ok)
+			if err := <-errc; (err == nil) != c.ok {
+				t.Errorf("got %v; want ok=%v", err, c.ok)
+			}
+		})
+	}
+}
+
+func TestAuthenticateMD5(t *testing.T) {
+	for _, password := range []string{"secret", "wrong"} {
+		t.Run(password, func(t *testing.T) {
+			frontend, errc := startAuth(t, func(backend *pgproto3.Backend) error {
+				return authenticateMD5(backend, testMD5Secret)
+			})
+			msg, err := frontend.Receive()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, ok := msg.(*pgproto3.AuthenticationMD5Password)
+			if !ok {
+				t.Fatalf("unexpected message: %T", msg)
+			}
+			sum := md5.Sum([]byte(password + "metadb"))
+			sum = md5.Sum(append([]byte(hex.EncodeToString(sum[:])), req.Salt[:]...))
+			frontend.Send(&pgproto3.PasswordMessage{Password: "md5" + hex.EncodeToString(sum[:])})
+			if err = frontend.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err = <-errc; (err == nil) != (password == "secret") {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsRole(t *testing.T) {
+	db := &dbx.DB{User: "metadb", SuperUser: "postgres"}
+	for _, username := range []string{"", "alice", "Metadb"} {
+		if err := authenticate(nil, username, db); err == nil {
+			t.Errorf("%q: expected error", username)
+		}
+	}
+}
+
+// startAuth runs the server side of authentication over an in-memory
+// connection and returns the client side.  The result is sent on the
+// channel.
+func startAuth(t *testing.T, auth func(*pgproto3.Backend) error) (*pgproto3.Frontend, <-chan error) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- auth(pgproto3.NewBackend(server, server))
+	}()
+	return pgproto3.NewFrontend(client, client), errc
+}
+
+// scramClient runs the client side of a SCRAM-SHA-256 exchange.  The GS2
+// header is sent in the client-first-message as "n,," and repeated in the
+// client-final-message as gs2Header.
+func scramClient(t *testing.T, frontend *pgproto3.Frontend, password, gs2Header string, ok bool) {
+	t.Helper()
+	if _, err := frontend.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	clientFirstBare := "n=,r=clientnonce"
+	frontend.Send(&pgproto3.SASLInitialResponse{AuthMechanism: scramSHA256, Data: []byte("n,," + clientFirstBare)})
+	if err := frontend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := frontend.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, isCont := msg.(*pgproto3.AuthenticationSASLContinue)
+	if !isCont {
+		t.Fatalf("unexpected message: %T", msg)
+	}
+	serverFirst := string(cont.Data)
+	salt, err := base64.StdEncoding.DecodeString(scramAttribute(serverFirst, 's'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var iterations int
+	if _, err = fmt.Sscan(scramAttribute(serverFirst, 'i'), &iterations); err != nil {
+		t.Fatal(err)
+	}
+
+	saltedPassword := scramHi([]byte(password), salt, iterations)
+	clientKey := scramHMAC(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(gs2Header)) +
+		",r=" + scramAttribute(serverFirst, 'r')
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+	clientSignature := scramHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	clientFinal := clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)
+	frontend.Send(&pgproto3.SASLResponse{Data: []byte(clientFinal)})
+	if err = frontend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		return
+	}
+
+	if msg, err = frontend.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	final, isFinal := msg.(*pgproto3.AuthenticationSASLFinal)
+	if !isFinal {
+		t.Fatalf("unexpected message: %T", msg)
+	}
+	serverKey := scramHMAC(saltedPassword, []byte("Server Key"))
+	want := "v=" + base64.StdEncoding.EncodeToString(scramHMAC(serverKey, authMessage))
+	if string(final.Data) != want {
+		t.Errorf("server signature: got %q; want %q", final.Data, want)
+	}
+}
+
+// scramHi is the function Hi() of RFC 5802, i.e. PBKDF2 with HMAC-SHA-256.
+func scramHi(password, salt []byte, iterations int) []byte {
+	u := scramHMAC(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	hi := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		u = scramHMAC(password, u)
+		for j := range hi {
+			hi[j] ^= u[j]
+		}
+	}
+	return hi
+}
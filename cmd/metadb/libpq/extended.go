@@ -0,0 +1,340 @@
+package libpq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/parser"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// extendedQuery holds the state of the extended query protocol for one client
+// connection.  Statements passed through to the database are described and
+// executed using the unnamed statement of the connection pc, while
+// Metadb statements are executed by the same functions that handle simple
+// queries, with their output buffered so that it can be described before it is
+// sent to the client.
+type extendedQuery struct {
+	conn       io.Writer
+	db         *dbx.DB
+	dc         *pgx.Conn
+	pc         *pgx.Conn
+	sources    *[]*sysdb.SourceConnector
+	statements map[string]*preparedStatement
+	portals    map[string]*portal
+	// failed is set after an error, causing messages to be discarded until
+	// the next Sync.
+	failed bool
+}
+
+type preparedStatement struct {
+	query string
+	node  ast.Node
+	pass  bool
+	// txTag is the command tag of a transaction control statement.
+	txTag string
+	desc  *pgconn.StatementDescription
+}
+
+type portal struct {
+	stmt          *preparedStatement
+	params        [][]byte
+	paramFormats  []int16
+	resultFormats []int16
+	// output contains the buffered messages of an executed statement that
+	// have not yet been sent.
+	output   [][]byte
+	executed bool
+}
+
+func newExtendedQuery(conn io.Writer, db *dbx.DB, dc, pc *pgx.Conn, sources *[]*sysdb.SourceConnector) *extendedQuery {
+	return &extendedQuery{
+		conn:       conn,
+		db:         db,
+		dc:         dc,
+		pc:         pc,
+		sources:    sources,
+		statements: make(map[string]*preparedStatement),
+		portals:    make(map[string]*portal),
+	}
+}
+
+// process handles one message of the extended query protocol.  An error is
+// returned only if communication with the client fails.
+func (x *extendedQuery) process(msg pgproto3.FrontendMessage) error {
+	if s, ok := msg.(*pgproto3.Sync); ok {
+		return x.sync(s)
+	}
+	if x.failed {
+		return nil
+	}
+	var err error
+	switch m := msg.(type) {
+	case *pgproto3.Parse:
+		err = x.parse(m)
+	case *pgproto3.Bind:
+		err = x.bind(m)
+	case *pgproto3.Describe:
+		err = x.describe(m)
+	case *pgproto3.Execute:
+		err = x.execute(m)
+	case *pgproto3.Close:
+		err = x.close(m)
+	case *pgproto3.Flush:
+		return nil
+	default:
+		err = fmt.Errorf("unexpected message in extended query: %T", msg)
+	}
+	if err != nil {
+		return x.fail(err)
+	}
+	return nil
+}
+
+func (x *extendedQuery) fail(err error) error {
+	x.failed = true
+	return writeEncoded(x.conn, []pgproto3.Message{errorResponse(err)})
+}
+
+func (x *extendedQuery) sync(_ *pgproto3.Sync) error {
+	x.failed = false
+	delete(x.portals, "")
+	return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.ReadyForQuery{TxStatus: 'I'}})
+}
+
+func (x *extendedQuery) parse(m *pgproto3.Parse) error {
+	log.Trace("prepared statement: %s", m.Query)
+	if m.Name != "" {
+		if _, ok := x.statements[m.Name]; ok {
+			return fmt.Errorf("prepared statement %q already exists", m.Name)
+		}
+	}
+	node, err, pass := parser.Parse(m.Query)
+	stmt := &preparedStatement{query: m.Query, node: node, pass: pass}
+	switch {
+	case pass:
+		if stmt.txTag = transactionCommandTag(m.Query); stmt.txTag != "" {
+			break
+		}
+		if !isProxyAllowed(node, m.Query) {
+			return &pgconn.PgError{Severity: "ERROR", Code: "42601", Message: "syntax error"}
+		}
+		if stmt.desc, err = x.pc.PgConn().Prepare(context.TODO(), "", m.Query, m.ParameterOIDs); err != nil {
+			return err
+		}
+	case err != nil:
+		return &pgconn.PgError{Severity: "ERROR", Code: "42601", Message: err.Error()}
+	case node == nil:
+		return &pgconn.PgError{Severity: "ERROR", Code: "42601", Message: "syntax error"}
+	}
+	x.statements[m.Name] = stmt
+	return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.ParseComplete{}})
+}
+
+func (x *extendedQuery) bind(m *pgproto3.Bind) error {
+	stmt, ok := x.statements[m.PreparedStatement]
+	if !ok {
+		return fmt.Errorf("prepared statement %q does not exist", m.PreparedStatement)
+	}
+	if m.DestinationPortal != "" {
+		if _, ok = x.portals[m.DestinationPortal]; ok {
+			return fmt.Errorf("portal %q already exists", m.DestinationPortal)
+		}
+	}
+	if !stmt.pass && len(m.Parameters) != 0 {
+		return fmt.Errorf("bind message supplies %d parameters, but prepared statement %q requires 0",
+			len(m.Parameters), m.PreparedStatement)
+	}
+	// The message is reused by the backend, so its data are copied.
+	p := &portal{
+		stmt:          stmt,
+		params:        make([][]byte, len(m.Parameters)),
+		paramFormats:  append([]int16(nil), m.ParameterFormatCodes...),
+		resultFormats: append([]int16(nil), m.ResultFormatCodes...),
+	}
+	for i, v := range m.Parameters {
+		if v != nil {
+			p.params[i] = append([]byte{}, v...)
+		}
+	}
+	x.portals[m.DestinationPortal] = p
+	return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.BindComplete{}})
+}
+
+func (x *extendedQuery) describe(m *pgproto3.Describe) error {
+	switch m.ObjectType {
+	case 'S':
+		stmt, ok := x.statements[m.Name]
+		if !ok {
+			return fmt.Errorf("prepared statement %q does not exist", m.Name)
+		}
+		if stmt.desc != nil {
+			return writeEncoded(x.conn, []pgproto3.Message{
+				&pgproto3.ParameterDescription{ParameterOIDs: stmt.desc.ParamOIDs},
+				describeFields(stmt.desc.Fields, nil),
+			})
+		}
+		if err := writeEncoded(x.conn, []pgproto3.Message{&pgproto3.ParameterDescription{}}); err != nil {
+			return err
+		}
+		if n, ok := stmt.node.(*ast.ListStmt); ok {
+			return x.describeList(n)
+		}
+		return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.NoData{}})
+	case 'P':
+		p, ok := x.portals[m.Name]
+		if !ok {
+			return fmt.Errorf("portal %q does not exist", m.Name)
+		}
+		if p.stmt.desc != nil {
+			return writeEncoded(x.conn, []pgproto3.Message{describeFields(p.stmt.desc.Fields, p.resultFormats)})
+		}
+		if n, ok := p.stmt.node.(*ast.ListStmt); ok {
+			return x.describeList(n)
+		}
+		return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.NoData{}})
+	default:
+		return fmt.Errorf("invalid describe object type %q", m.ObjectType)
+	}
+}
+
+// describeList writes the row description of a LIST statement without
+// running it.
+func (x *extendedQuery) describeList(node *ast.ListStmt) error {
+	if q := listQuery(node.Name); q != "" {
+		desc, err := x.dc.PgConn().Prepare(context.TODO(), "", q, nil)
+		if err != nil {
+			return err
+		}
+		return writeEncoded(x.conn, []pgproto3.Message{describeFields(desc.Fields, nil)})
+	}
+	if strings.ToLower(node.Name) == "status" {
+		return writeEncoded(x.conn, []pgproto3.Message{listStatusDesc()})
+	}
+	return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.NoData{}})
+}
+
+// execute runs a portal.  The output of the statement is buffered, and if
+// MaxRows is greater than zero, the portal is suspended after that number of
+// rows, to be resumed by the next Execute.
+func (x *extendedQuery) execute(m *pgproto3.Execute) error {
+	p, ok := x.portals[m.Portal]
+	if !ok {
+		return fmt.Errorf("portal %q does not exist", m.Portal)
+	}
+	stmt := p.stmt
+	switch {
+	case stmt.txTag != "":
+		return writeEncoded(x.conn, []pgproto3.Message{
+			&pgproto3.CommandComplete{CommandTag: []byte(stmt.txTag)},
+		})
+	case p.executed:
+	case stmt.pass:
+		result := execReadOnly(x.pc, stmt.query, p.params, stmt.desc.ParamOIDs, p.paramFormats, p.resultFormats)
+		if result.Err != nil {
+			return result.Err
+		}
+		msgs := make([]pgproto3.Message, 0, len(result.Rows)+1)
+		for _, r := range result.Rows {
+			msgs = append(msgs, &pgproto3.DataRow{Values: r})
+		}
+		msgs = append(msgs, &pgproto3.CommandComplete{CommandTag: []byte(result.CommandTag.String())})
+		b, err := encode(nil, msgs)
+		if err != nil {
+			return err
+		}
+		p.executed = true
+		p.output = splitMessages(b)
+	default:
+		if err := x.run(p); err != nil {
+			return err
+		}
+	}
+	return x.sendOutput(p, m.MaxRows)
+}
+
+// sendOutput writes the buffered output of a portal.  If maxRows is greater
+// than zero and more rows remain after that number, the rest of the output is
+// retained and PortalSuspended is written.
+func (x *extendedQuery) sendOutput(p *portal, maxRows uint32) error {
+	var rows uint32
+	for len(p.output) != 0 {
+		b := p.output[0]
+		switch b[0] {
+		case 'D': // DataRow
+			if maxRows > 0 && rows == maxRows {
+				return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.PortalSuspended{}})
+			}
+			rows++
+		case 'E': // ErrorResponse
+			x.failed = true
+		}
+		if err := write(x.conn, b); err != nil {
+			return err
+		}
+		p.output = p.output[1:]
+	}
+	return nil
+}
+
+// run executes a Metadb statement, buffering its output in the portal.
+func (x *extendedQuery) run(p *portal) error {
+	var buf bytes.Buffer
+	if err := processQuery(&buf, p.stmt.query, x.db, x.dc, x.pc, x.sources); err != nil {
+		return err
+	}
+	p.executed = true
+	p.output = make([][]byte, 0)
+	for _, b := range splitMessages(buf.Bytes()) {
+		switch b[0] {
+		case 'T', 'Z': // RowDescription, ReadyForQuery
+		default:
+			p.output = append(p.output, b)
+		}
+	}
+	return nil
+}
+
+func (x *extendedQuery) close(m *pgproto3.Close) error {
+	switch m.ObjectType {
+	case 'S':
+		delete(x.statements, m.Name)
+	case 'P':
+		delete(x.portals, m.Name)
+	default:
+		return fmt.Errorf("invalid close object type %q", m.ObjectType)
+	}
+	return writeEncoded(x.conn, []pgproto3.Message{&pgproto3.CloseComplete{}})
+}
+
+func describeFields(fields []pgconn.FieldDescription, formats []int16) pgproto3.Message {
+	if len(fields) == 0 {
+		return &pgproto3.NoData{}
+	}
+	return rowDescription(fields, formats)
+}
+
+// splitMessages splits a buffer of encoded backend messages, each of which
+// consists of a type byte and a length that includes itself.
+func splitMessages(b []byte) [][]byte {
+	msgs := make([][]byte, 0)
+	for len(b) >= 5 {
+		n := 1 + int(binary.BigEndian.Uint32(b[1:5]))
+		if n > len(b) {
+			break
+		}
+		msgs = append(msgs, b[:n])
+		b = b[n:]
+	}
+	return msgs
+}
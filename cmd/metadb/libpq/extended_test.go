@@ -0,0 +1,136 @@
+package libpq
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+func encodeMessages(t *testing.T, msgs ...pgproto3.Message) []byte {
+	t.Helper()
+	b, err := encode(nil, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// messageTypes returns the type bytes of encoded messages.
+func messageTypes(b []byte) string {
+	var types []byte
+	for _, m := range splitMessages(b) {
+		types = append(types, m[0])
+	}
+	return string(types)
+}
+
+func TestSplitMessages(t *testing.T) {
+	b := encodeMessages(t,
+		&pgproto3.DataRow{Values: [][]byte{[]byte("a")}},
+		&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")},
+	)
+	first := len(encodeMessages(t, &pgproto3.DataRow{Values: [][]byte{[]byte("a")}}))
+	cases := []struct {
+		n    int
+		want string
+	}{
+		{len(b), "DC"},
+		{len(b) - 1, "D"},
+		{first + 5, "D"},
+		{first + 4, "D"},
+		{first, "D"},
+		{first - 1, ""},
+		{5, ""},
+		{4, ""},
+		{0, ""},
+	}
+	for _, c := range cases {
+		if got := messageTypes(b[:c.n]); got != c.want {
+			t.Errorf("%d bytes: got %q; want %q", c.n, got, c.want)
+		}
+	}
+	msgs := splitMessages(b)
+	if len(msgs) != 2 || !bytes.Equal(bytes.Join(msgs, nil), b) {
+		t.Errorf("got %q; want messages of %q", msgs, b)
+	}
+}
+
+func TestExtendedQueryDiscardsUntilSync(t *testing.T) {
+	var buf bytes.Buffer
+	x := newExtendedQuery(&buf, nil, nil, nil, nil)
+	msgs := []pgproto3.FrontendMessage{
+		&pgproto3.Bind{PreparedStatement: "s1"},
+		// Discarded; the connections are nil, so these would fail
+		// if processed.
+		&pgproto3.Parse{Query: "SELECT 1"},
+		&pgproto3.Bind{},
+		&pgproto3.Execute{},
+		&pgproto3.Sync{},
+		&pgproto3.Close{ObjectType: 'S', Name: "s1"},
+		&pgproto3.Execute{Portal: "p1"},
+		&pgproto3.Close{ObjectType: 'S', Name: "s1"},
+		&pgproto3.Sync{},
+		&pgproto3.Close{ObjectType: 'P', Name: "p1"},
+		&pgproto3.Sync{},
+	}
+	for _, m := range msgs {
+		if err := x.process(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := messageTypes(buf.Bytes()), "EZ3EZ3Z"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if x.failed {
+		t.Errorf("failed after Sync")
+	}
+}
+
+func TestExtendedQueryFailedOutput(t *testing.T) {
+	var buf bytes.Buffer
+	x := newExtendedQuery(&buf, nil, nil, nil, nil)
+	x.portals[""] = &portal{
+		stmt:     &preparedStatement{},
+		executed: true,
+		output: splitMessages(encodeMessages(t,
+			&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42P01", Message: "relation does not exist"},
+		)),
+	}
+	for _, m := range []pgproto3.FrontendMessage{&pgproto3.Execute{}, &pgproto3.Execute{}, &pgproto3.Sync{}} {
+		if err := x.process(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := messageTypes(buf.Bytes()), "EZ"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestExtendedQueryMaxRows(t *testing.T) {
+	var buf bytes.Buffer
+	x := newExtendedQuery(&buf, nil, nil, nil, nil)
+	row := &pgproto3.DataRow{Values: [][]byte{[]byte("a")}}
+	x.portals["p"] = &portal{
+		stmt:     &preparedStatement{},
+		executed: true,
+		output: splitMessages(encodeMessages(t,
+			row, row, row, &pgproto3.CommandComplete{CommandTag: []byte("SELECT 3")},
+		)),
+	}
+	for _, c := range []struct {
+		maxRows uint32
+		want    string
+	}{
+		{2, "DDs"},
+		{1, "DC"},
+	} {
+		buf.Reset()
+		if err := x.process(&pgproto3.Execute{Portal: "p", MaxRows: c.maxRows}); err != nil {
+			t.Fatal(err)
+		}
+		if got := messageTypes(buf.Bytes()); got != c.want {
+			t.Errorf("max rows %d: got %q; want %q", c.maxRows, got, c.want)
+		}
+	}
+}
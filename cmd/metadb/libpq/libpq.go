@@ -2,27 +2,33 @@ package libpq
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/metadb-project/metadb/cmd/metadb/tools"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dberr"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/parser"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
-func Listen(host string, port string, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
+// Listen accepts client connections on the specified host and port.  If
+// tlsConfig is not nil, clients are required to use TLS.
+func Listen(host string, port string, tlsConfig *tls.Config, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
 	// var h string
 	// if host == "" {
 	// 	h = "127.0.0.1"
@@ -55,22 +61,12 @@ func Listen(host string, port string, db *dbx.DB, sources *[]*sysdb.SourceConnec
 		backend = pgproto3.NewBackend(conn, conn)
 		//log.Trace("connection received: %s", conn.RemoteAddr().String())
 		log.Trace("connection received") // domain socket
-		go serve(conn, backend, db, sources)
+		go serve(conn, backend, tlsConfig, db, sources)
 	}
 }
 
-func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
-	dbconn, err := db.Connect()
-	if err != nil {
-		// TODO handle error
-		log.Info("%v", err)
-		return
-	}
-	defer dbx.Close(dbconn)
-	//log.Trace("connected to database")
-	// TODO Close
-
-	if err = startup(conn, backend); err != nil {
+func serve(conn net.Conn, backend *pgproto3.Backend, tlsConfig *tls.Config, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
+	reject := func(err error) {
 		// errw := write(conn, encode(nil, []pgproto3.Message{
 		// 	&pgproto3.ErrorResponse{Message: err.Error()},
 		// 	&pgproto3.ReadyForQuery{TxStatus: 'I'},
@@ -84,11 +80,39 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 		}
 		errw := write(conn, buffer)
 		log.Info("connection from address %q: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
 		if errw != nil {
 			log.Info("%v", errw)
 		}
+	}
+	var username string
+	var err error
+	if conn, backend, username, err = startup(conn, backend, tlsConfig, db); err != nil {
+		reject(err)
 		return
 	}
+	// The database is not connected to until the client has been
+	// authenticated.  Metadb statements are run as the Metadb system user,
+	// and statements passed through to the database as the client's role.
+	dbconn, err := db.Connect()
+	if err != nil {
+		reject(fmt.Errorf("startup: %v", err))
+		return
+	}
+	defer dbx.Close(dbconn)
+	pc := dbconn
+	if username != db.User {
+		if pc, err = db.ConnectSuper(); err != nil {
+			reject(fmt.Errorf("startup: %v", err))
+			return
+		}
+		defer dbx.Close(pc)
+	}
+	if err = startupComplete(conn, pc); err != nil {
+		reject(err)
+		return
+	}
+	x := newExtendedQuery(conn, db, dbconn, pc, sources)
 	for {
 		var msg pgproto3.FrontendMessage
 		if msg, err = backend.Receive(); err != nil {
@@ -99,20 +123,18 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 		log.Trace("*** %#v", msg)
 
 		switch m := msg.(type) {
-		case *pgproto3.Parse:
+		case *pgproto3.Parse, *pgproto3.Bind, *pgproto3.Describe, *pgproto3.Execute, *pgproto3.Close,
+			*pgproto3.Flush, *pgproto3.Sync:
 			// Extended query
-			if err = processParse(conn, backend, m, db, dbconn, sources); err != nil {
+			if err = x.process(m); err != nil {
 				log.Info("%v", err)
 				return
 			}
-			//log.Info("*pgproto3.Parse: not yet implemented")
 		case *pgproto3.Query:
-			if err = processQuery(conn, m.String, nil, db, dbconn, sources); err != nil {
+			if err = processQuery(conn, m.String, db, dbconn, pc, sources); err != nil {
 				log.Info("%v", err)
 				return
 			}
-		case *pgproto3.Sync:
-			continue
 		case *pgproto3.Terminate:
 			return
 		default:
@@ -124,123 +146,48 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 	}
 }
 
-func startup(conn net.Conn, backend *pgproto3.Backend) error {
+// startup receives the startup message and authenticates the client,
+// returning the name of the authenticated user.
+func startup(conn net.Conn, backend *pgproto3.Backend, tlsConfig *tls.Config, db *dbx.DB) (net.Conn, *pgproto3.Backend, string, error) {
 	var msg pgproto3.FrontendMessage
 	var err error
 	if msg, err = backend.ReceiveStartupMessage(); err != nil {
 		// TODO handle error
-		return err
+		return conn, backend, "", err
 	}
 	switch m := msg.(type) {
 	case *pgproto3.SSLRequest:
-		if _, err = conn.Write([]byte("N")); err != nil {
-			return err
+		if tlsConfig == nil {
+			if _, err = conn.Write([]byte("N")); err != nil {
+				return conn, backend, "", err
+			}
+			return startup(conn, backend, nil, db)
 		}
-		if err = startup(conn, backend); err != nil {
-			return err
+		if _, err = conn.Write([]byte("S")); err != nil {
+			return conn, backend, "", err
 		}
-		return nil
-	case *pgproto3.StartupMessage:
-		if err = handleStartup(conn, m); err != nil {
-			return err
+		tlsConn := tls.Server(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return conn, backend, "", fmt.Errorf("startup: TLS handshake: %v", err)
 		}
-		return nil
-	default:
-		return fmt.Errorf("unknown message: %v", msg)
-	}
-}
-
-func processParse(conn net.Conn, backend *pgproto3.Backend, parse *pgproto3.Parse, db *dbx.DB, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-	query := parse.Query
-	log.Trace("prepared statement: %s", query)
-
-	// Prepare the query.
-	stmt, err := dc.Prepare(context.TODO(), parse.Name, query)
-	if err != nil {
-		return fmt.Errorf("preparing extended query: %w", err)
-	}
-
-	//var rows pgx.Rows
-	//var cols []pgconn.FieldDescription
-	//var binds []interface{}
-	//exec := func() (err error) {
-	//	if rows != nil {
-	//		return nil
-	//	}
-	//	if rows, err = dc.Query(context.TODO(), binds...); err != nil {
-	//		return fmt.Errorf("query: %w", err)
-	//	}
-	//	cols = rows.FieldDescriptions()
-	//	return nil
-	//}
-
-	args := make([]any, 0)
-	_ = args
-	for {
-		msg, err := backend.Receive()
-		if err != nil {
-			return fmt.Errorf("unexpected message in extended query: %w", err)
+		// TLS has been established; no further SSLRequest is expected.
+		return startup(tlsConn, pgproto3.NewBackend(tlsConn, tlsConn), nil, db)
+	case *pgproto3.StartupMessage:
+		if tlsConfig != nil {
+			return conn, backend, "", fmt.Errorf("startup: TLS connection required")
 		}
-		log.Trace("*** %#v", msg)
-
-		_ = stmt
-		switch m := msg.(type) {
-		case *pgproto3.Bind:
-			args = make([]any, 0)
-			for _, p := range m.Parameters {
-				args = append(args, string(p))
-			}
-
-		case *pgproto3.Describe:
-			return fmt.Errorf("pgproto3.Describe not yet implemented")
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//if _, err := c.Write(toRowDescription(cols).Encode(nil)); err != nil {
-			//	return err
-			//}
-
-		case *pgproto3.Execute:
-			//func processQuery(conn net.Conn, query string, db *dbx.DB, dbconn *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-			err := processQuery(conn, query, args, db, dc, sources)
-			//err := proxySelect(conn, query, args, dc)
-			if err != nil {
-				return fmt.Errorf("executing prepared statement: %w", err)
-			}
-
-			//// TODO: Send pgproto3.ParseComplete?
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//
-			//var buf []byte
-			//for rows.Next() {
-			//	row, err := scanRow(rows, cols)
-			//	if err != nil {
-			//		return fmt.Errorf("scan: %w", err)
-			//	}
-			//	buf = row.Encode(buf)
-			//}
-			//if err := rows.Err(); err != nil {
-			//	return fmt.Errorf("rows: %w", err)
-			//}
-			//
-			//// Mark command complete and ready for next query.
-			//buf = (&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}).Encode(buf)
-			//buf = (&pgproto3.ReadyForQuery{TxStatus: 'I'}).Encode(buf)
-			//_, err := c.Write(buf)
-			//return err
-
-		case *pgproto3.Sync:
-			// NOP
-
-		default:
-			return fmt.Errorf("unexpected message during parse: %#v", msg)
+		if err = handleStartup(backend, m, db); err != nil {
+			return conn, backend, "", err
 		}
+		return conn, backend, m.Parameters["user"], nil
+	default:
+		return conn, backend, "", fmt.Errorf("unknown message: %v", msg)
 	}
 }
 
-func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
+// processQuery runs a simple query.  Statements passed through to the
+// database are run using the connection pc.
+func processQuery(conn io.Writer, query string, db *dbx.DB, dbconn, pc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
 	var e string
 	node, err, pass := parser.Parse(query)
 	if err != nil {
@@ -248,7 +195,7 @@ func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *p
 	}
 	log.Trace("query received: query=%q node=%#v err=%q pass=%v\n", query, node, e, pass)
 	if pass {
-		err = proxyQuery(conn, query, args, node, dbconn)
+		err = proxyQuery(conn, query, node, pc)
 		if err != nil {
 			buffer, erre := encode(nil, []pgproto3.Message{
 				&pgproto3.ErrorResponse{Message: "ERROR:  " + err.Error()},
@@ -330,154 +277,150 @@ func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *p
 	return nil
 }
 
-func handleStartup(conn net.Conn, msg *pgproto3.StartupMessage) error {
+func handleStartup(backend *pgproto3.Backend, msg *pgproto3.StartupMessage, db *dbx.DB) error {
 	if msg.ProtocolVersion != 0x30000 {
 		return fmt.Errorf("startup: unknown protocol version \"%#x\"", msg.ProtocolVersion)
 	}
-	if msg.Parameters["application_name"] != "psql" {
-		return fmt.Errorf("startup: unsupported application %q", msg.Parameters["application_name"])
-	}
 	if msg.Parameters["database"] != "metadb" {
 		return fmt.Errorf("startup: unsupported database name %q (use \"-d metadb\")", msg.Parameters["database"])
 	}
-	buffer, erre := encode(nil, []pgproto3.Message{
-		&pgproto3.AuthenticationOk{},
-		&pgproto3.ParameterStatus{Name: "server_version", Value: "15.3.0"},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+	if err := authenticate(backend, msg.Parameters["user"], db); err != nil {
+		return fmt.Errorf("startup: %v", err)
+	}
+	return nil
+}
+
+// startupComplete informs an authenticated client that the connection is
+// ready.
+func startupComplete(conn net.Conn, dc *pgx.Conn) error {
+	m := []pgproto3.Message{&pgproto3.AuthenticationOk{}}
+	// Report the parameters of the database connection, which clients
+	// use to determine the server version and how to encode data.
+	for _, name := range startupParameters {
+		if v := dc.PgConn().ParameterStatus(name); v != "" {
+			m = append(m, &pgproto3.ParameterStatus{Name: name, Value: v})
+		}
+	}
+	m = append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	buffer, erre := encode(nil, m)
 	if erre != nil {
 		return fmt.Errorf("startup: %v", erre)
 	}
 	return write(conn, buffer)
 }
 
-func encodeFieldDesc(buffer []byte, cols []pgconn.FieldDescription) ([]byte, error) {
-	var desc pgproto3.RowDescription
-	var col pgconn.FieldDescription
-	for _, col = range cols {
-		var f = pgproto3.FieldDescription{
-			Name:                 []byte(col.Name),
-			TableOID:             0,
-			TableAttributeNumber: 0,
-			DataTypeOID:          pgtype.TextOID,
-			DataTypeSize:         -1,
-			TypeModifier:         -1,
-			Format:               0,
-		}
-		desc.Fields = append(desc.Fields, f)
-	}
-	return desc.Encode(buffer)
+var startupParameters = []string{
+	"server_version",
+	"server_encoding",
+	"client_encoding",
+	"DateStyle",
+	"IntervalStyle",
+	"TimeZone",
+	"integer_datetimes",
+	"standard_conforming_strings",
 }
 
-func encodeRow(buffer []byte, rows pgx.Rows, cols []pgconn.FieldDescription) ([]byte, error) {
-	var err error
-	var numCols = len(cols)
-	var dest = make([]any, numCols)
-	var vals = make([]any, numCols)
-	var i int
-	for i = range dest {
-		dest[i] = &(vals[i])
-	}
-	if err = rows.Scan(dest...); err != nil {
-		return nil, err
+func list(conn io.Writer, node *ast.ListStmt, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
+	if q := listQuery(node.Name); q != "" {
+		return proxySelect(conn, q, nil, dc)
 	}
-	var row = pgproto3.DataRow{Values: make([][]byte, numCols)}
-	var a any
-	for i, a = range vals {
-		if a == nil {
-			row.Values[i] = []byte("")
-			continue
-		}
-		switch v := a.(type) {
-		case []byte:
-			row.Values[i] = v
-		default:
-			row.Values[i] = []byte(fmt.Sprintf("%v", v))
-		}
+	switch strings.ToLower(node.Name) {
+	case "status":
+		return listStatus(conn, sources)
+	default:
+		return fmt.Errorf("unrecognized parameter %q", node.Name)
 	}
-	return row.Encode(buffer)
 }
 
-func list(conn net.Conn, node *ast.ListStmt, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-	switch strings.ToLower(node.Name) {
+// listQuery returns the query that produces the list named in a LIST
+// statement, or "" if the list is not produced by a query.
+func listQuery(name string) string {
+	switch strings.ToLower(name) {
 	case "authorizations":
-		return proxySelect(conn, ""+
-			"SELECT username,"+
-			"       CASE WHEN (NOT dbupdated) THEN 'pending restart'"+
-			"            WHEN (tables='.*' AND dbupdated) THEN 'authorized'"+
-			"            ELSE 'not authorized'"+
-			"       END note"+
-			"    FROM metadb.auth", nil, dc)
+		return "" +
+			"SELECT username," +
+			"       CASE WHEN (NOT dbupdated) THEN 'pending restart'" +
+			"            WHEN (tables='.*' AND dbupdated) THEN 'authorized'" +
+			"            ELSE 'not authorized'" +
+			"       END note" +
+			"    FROM metadb.auth"
 	case "data_origins":
-		return proxySelect(conn, "SELECT name FROM metadb.origin", nil, dc)
+		return "SELECT name FROM metadb.origin"
 	case "data_sources":
-		return proxySelect(conn, ""+
-			"SELECT name,"+
-			"       brokers,"+
-			"       security,"+
-			"       topics,"+
-			"       consumergroup,"+
-			"       schemapassfilter,"+
-			"       schemastopfilter,"+
-			"       tablestopfilter,"+
-			"       trimschemaprefix,"+
-			"       addschemaprefix,"+
-			"       module"+
-			"    FROM metadb.source", nil, dc)
-	case "status":
-		return listStatus(conn, sources)
+		return "" +
+			"SELECT name," +
+			"       coalesce(type, 'kafka') type," +
+			"       brokers," +
+			"       security," +
+			"       topics," +
+			"       consumergroup," +
+			"       schemapassfilter," +
+			"       schemastopfilter," +
+			"       tablestopfilter," +
+			"       trimschemaprefix," +
+			"       addschemaprefix," +
+			"       module," +
+			"       coalesce(format, 'json') format," +
+			"       regexp_replace(schemaregistry, '//[^/@]*@', '//********@') schemaregistry," +
+			"       coalesce(concurrency, 1) concurrency," +
+			"       coalesce(syncconcurrency, 32) syncconcurrency," +
+			"       saslmechanism," +
+			"       saslusername," +
+			"       CASE WHEN saslpassword IS NULL THEN NULL ELSE '********' END saslpassword," +
+			"       sslca," +
+			"       sslcert," +
+			"       sslkey," +
+			"       coalesce(deadletter, false) deadletter," +
+			"       coalesce(transactions, false) transactions," +
+			"       regexp_replace(regexp_replace(connection, 'password\\s*=\\s*(''[^'']*''|\\S+)', 'password=********', 'g')," +
+			"                      '(//[^/:@]*):[^/@]*@', '\\1:********@') connection," +
+			"       publication," +
+			"       slot," +
+			"       schemarename," +
+			"       tablerename," +
+			"       renamepreset," +
+			"       columnrules," +
+			"       CASE WHEN columnhashkey IS NULL THEN NULL ELSE '********' END columnhashkey," +
+			"       rowfilters," +
+			"       tablekeys," +
+			"       coalesce(fullrowkey, false) fullrowkey," +
+			"       coalesce(auditcolumns, false) auditcolumns," +
+			"       retention," +
+			"       coalesce(retentionarchive, false) retentionarchive" +
+			"    FROM metadb.source"
 	default:
-		return fmt.Errorf("unrecognized parameter %q", node.Name)
+		return ""
 	}
 }
 
-func listStatus(conn net.Conn, sources *[]*sysdb.SourceConnector) error {
-	m := []pgproto3.Message{
-		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
-			{
-				Name:                 []byte("type"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("name"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("source_stream"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("source_sync"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-		}},
-	}
+func listStatus(conn io.Writer, sources *[]*sysdb.SourceConnector) error {
+	m := []pgproto3.Message{listStatusDesc()}
 	for _, s := range *sources {
+		var retry, lag, ts, lastErr []byte
+		if t := s.Status.NextRetry.Get(); !t.IsZero() {
+			retry = []byte(t.UTC().Format("2006-01-02 15:04:05Z"))
+		}
+		if n := s.Status.Progress.Lag(); n >= 0 {
+			lag = []byte(strconv.FormatInt(n, 10))
+		}
+		if t := s.Status.Progress.SourceTimestamp(); t != "" {
+			ts = []byte(t)
+		}
+		if e := s.Status.LastError.Get(); e != "" {
+			lastErr = []byte(e)
+		}
 		m = append(m, &pgproto3.DataRow{Values: [][]byte{
 			[]byte("data_source"),
 			[]byte(s.Name),
 			[]byte(s.Status.Stream.GetString()),
 			[]byte(s.Status.Sync.GetString()),
+			retry,
+			[]byte(strconv.FormatInt(s.Status.DeadLetters.Get(), 10)),
+			lag,
+			ts,
+			[]byte(strconv.FormatFloat(s.Status.Progress.EventsPerSecond(), 'f', 1, 64)),
+			[]byte(s.Status.Progress.PartitionsString()),
+			lastErr,
 		}})
 	}
 	ctag := fmt.Sprintf("SELECT %d", len(*sources))
@@ -486,7 +429,38 @@ func listStatus(conn net.Conn, sources *[]*sysdb.SourceConnector) error {
 	return writeEncoded(conn, m)
 }
 
-func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Conn) error {
+// listStatusDesc returns the row description of LIST status.
+func listStatusDesc() *pgproto3.RowDescription {
+	return &pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+		textField("type"),
+		textField("name"),
+		textField("source_stream"),
+		textField("source_sync"),
+		textField("next_retry"),
+		textField("dead_letters"),
+		textField("lag"),
+		textField("last_source_timestamp"),
+		textField("events_per_second"),
+		textField("partitions"),
+		textField("last_error"),
+	}}
+}
+
+// textField returns the description of a text column for a RowDescription
+// message.
+func textField(name string) pgproto3.FieldDescription {
+	return pgproto3.FieldDescription{
+		Name:                 []byte(name),
+		TableOID:             0,
+		TableAttributeNumber: 0,
+		DataTypeOID:          25,
+		DataTypeSize:         -1,
+		TypeModifier:         -1,
+		Format:               0,
+	}
+}
+
+func createDataSource(conn io.Writer, node *ast.CreateDataSourceStmt, dc *pgx.Conn) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %w", err)
@@ -495,19 +469,13 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 		return fmt.Errorf("data source %q already exists", node.DataSourceName)
 	}
 
-	var count int64
-	q := "SELECT count(*) FROM metadb.source"
-	err = dc.QueryRow(context.TODO(), q).Scan(&count)
-	if err != nil {
-		return fmt.Errorf("checking number of configured sources: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("multiple sources not currently supported")
-	}
-
 	name := node.DataSourceName
-	if node.TypeName != "kafka" {
-		return fmt.Errorf("invalid data source type %q", node.TypeName)
+	typeName := strings.ToLower(node.TypeName)
+	if typeName != "kafka" && typeName != "postgresql" {
+		return &dberr.Error{
+			Err:  fmt.Errorf("invalid data source type %q", node.TypeName),
+			Hint: "Valid types are: kafka, postgresql",
+		}
 	}
 	if node.Options == nil {
 		// return to client
@@ -516,15 +484,39 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 	if err != nil {
 		return err
 	}
+	if typeName == "postgresql" {
+		for _, opt := range node.Options {
+			if err = checkPostgresqlOption(opt.Name); err != nil {
+				return err
+			}
+		}
+		for _, o := range []struct{ name, val string }{
+			{"connection", src.Connection}, {"publication", src.Publication}, {"slot", src.Slot}} {
+			if o.val == "" {
+				return fmt.Errorf("option %q is required for data source type %q", o.name, typeName)
+			}
+		}
+	}
 
-	q = "INSERT INTO metadb.source" +
-		"(name,brokers,security,topics,consumergroup,schemapassfilter,schemastopfilter,tablestopfilter,trimschemaprefix,addschemaprefix,module,enable)" +
-		"VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)"
+	q := "INSERT INTO metadb.source" +
+		"(name,brokers,security,topics,consumergroup,schemapassfilter,schemastopfilter,tablestopfilter,trimschemaprefix,addschemaprefix,module,format,schemaregistry,concurrency,syncconcurrency," +
+		"saslmechanism,saslusername,saslpassword,sslca,sslcert,sslkey,deadletter,transactions,type,connection,publication,slot," +
+		"schemarename,tablerename,renamepreset,columnrules,columnhashkey,rowfilters,tablekeys,fullrowkey,auditcolumns," +
+		"retention,retentionarchive,enable)" +
+		"VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29," +
+		"$30,$31,$32,$33,$34,$35,$36,$37,$38,$39)"
 	_, err = dc.Exec(context.TODO(), q,
 		name, src.Brokers, src.Security, strings.Join(src.Topics, ","), src.Group,
 		strings.Join(src.SchemaPassFilter, ","), strings.Join(src.SchemaStopFilter, ","),
 		strings.Join(src.TableStopFilter, ","), src.TrimSchemaPrefix, src.AddSchemaPrefix, src.Module,
-		src.Enable)
+		src.Format, src.SchemaRegistry, src.Concurrency, src.SyncConcurrency,
+		nullString(src.SASLMechanism), nullString(src.SASLUsername), nullString(src.SASLPassword),
+		nullString(src.SSLCA), nullString(src.SSLCert), nullString(src.SSLKey), src.DeadLetter, src.Transactions,
+		typeName, nullString(src.Connection), nullString(src.Publication), nullString(src.Slot),
+		nullString(strings.Join(src.SchemaRename, ",")), nullString(strings.Join(src.TableRename, ",")),
+		nullString(src.RenamePreset), nullString(strings.Join(src.ColumnRules, ",")), nullString(src.ColumnHashKey),
+		nullString(strings.Join(src.RowFilters, ",")), nullString(strings.Join(src.TableKeys, ",")), src.FullRowKey,
+		src.AuditColumns, nullString(strings.Join(src.Retention, ",")), src.RetentionArchive, src.Enable)
 	if err != nil {
 		return fmt.Errorf("writing source configuration: %w", err)
 	}
@@ -534,7 +526,7 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 	})
 }
 
-func alterTable(conn net.Conn, node *ast.AlterTableStmt, dc *pgx.Conn) error {
+func alterTable(conn io.Writer, node *ast.AlterTableStmt, dc *pgx.Conn) error {
 	// The only type currently supported is uuid.
 	columnType := strings.ToLower(node.Cmd.ColumnType)
 	if columnType != "uuid" {
@@ -600,7 +592,7 @@ func alterTable(conn net.Conn, node *ast.AlterTableStmt, dc *pgx.Conn) error {
 	})
 }
 
-func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn) error {
+func alterDataSource(conn io.Writer, node *ast.AlterDataSourceStmt, dc *pgx.Conn) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %w", err)
@@ -624,7 +616,7 @@ func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn)
 	})
 }
 
-func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) error {
+func dropDataSource(conn io.Writer, node *ast.DropDataSourceStmt, dc *pgx.Conn) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %w", err)
@@ -638,6 +630,18 @@ func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) e
 	if err != nil {
 		return fmt.Errorf("deleting data source %q", node.DataSourceName)
 	}
+	q = "DELETE FROM metadb.maintenance WHERE source_name=$1"
+	if _, err = dc.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+		return fmt.Errorf("deleting maintenance schedule for data source %q", node.DataSourceName)
+	}
+	q = "DELETE FROM metadb.kafka_offset WHERE source_name=$1"
+	if _, err = dc.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+		return fmt.Errorf("deleting Kafka offsets for data source %q", node.DataSourceName)
+	}
+	q = "DELETE FROM metadb.pg_snapshot WHERE source_name=$1"
+	if _, err = dc.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+		return fmt.Errorf("deleting snapshot status for data source %q", node.DataSourceName)
+	}
 	return writeEncoded(conn, []pgproto3.Message{
 		&pgproto3.CommandComplete{CommandTag: []byte("DROP DATA SOURCE")},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
@@ -645,6 +649,17 @@ func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) e
 }
 
 func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
+	var typeName *string
+	q := "SELECT type FROM metadb.source WHERE name=$1"
+	if err := dc.QueryRow(context.TODO(), q, node.DataSourceName).Scan(&typeName); err != nil {
+		return fmt.Errorf("reading data source: %w", err)
+	}
+	if err := checkAlterColumnRules(dc, node); err != nil {
+		return err
+	}
+	if err := checkAlterFormat(dc, node); err != nil {
+		return err
+	}
 	for _, opt := range node.Options {
 		switch opt.Name {
 		case "brokers":
@@ -666,14 +681,119 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 		case "addschemaprefix":
 			fallthrough
 		case "module":
+			fallthrough
+		case "format":
+			fallthrough
+		case "schemaregistry":
+			fallthrough
+		case "concurrency":
+			fallthrough
+		case "syncconcurrency":
+			fallthrough
+		case "saslmechanism":
+			fallthrough
+		case "saslusername":
+			fallthrough
+		case "saslpassword":
+			fallthrough
+		case "sslca":
+			fallthrough
+		case "sslcert":
+			fallthrough
+		case "sslkey":
+			fallthrough
+		case "deadletter":
+			fallthrough
+		case "transactions":
+			fallthrough
+		case "connection":
+			fallthrough
+		case "publication":
+			fallthrough
+		case "slot":
+			fallthrough
+		case "schemarename":
+			fallthrough
+		case "tablerename":
+			fallthrough
+		case "renamepreset":
+			fallthrough
+		case "columnrules":
+			fallthrough
+		case "columnhashkey":
+			fallthrough
+		case "rowfilters":
+			fallthrough
+		case "tablekeys":
+			fallthrough
+		case "fullrowkey":
+			fallthrough
+		case "auditcolumns":
+			fallthrough
+		case "retention":
+			fallthrough
+		case "retentionarchive":
 			// NOP
 		default:
 			return &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module",
+					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module, format, schemaregistry, concurrency, syncconcurrency, saslmechanism, saslusername, saslpassword, sslca, sslcert, sslkey, deadletter, transactions, connection, publication, slot, schemarename, tablerename, renamepreset, columnrules, columnhashkey, rowfilters, tablekeys, fullrowkey, auditcolumns, retention, retentionarchive",
+			}
+		}
+		if typeName != nil && *typeName == "postgresql" && opt.Action != "DROP" {
+			if err := checkPostgresqlOption(opt.Name); err != nil {
+				return err
+			}
+		}
+		if opt.Name == "format" && opt.Action != "DROP" {
+			opt.Val = strings.ToLower(opt.Val)
+			if err := checkSourceFormat(opt.Val); err != nil {
+				return err
+			}
+		}
+		if (opt.Name == "concurrency" || opt.Name == "syncconcurrency") && opt.Action != "DROP" {
+			if _, err := parseSourceConcurrency(opt.Name, opt.Val); err != nil {
+				return err
+			}
+		}
+		if (opt.Name == "deadletter" || opt.Name == "transactions" || opt.Name == "fullrowkey" ||
+			opt.Name == "auditcolumns" || opt.Name == "retentionarchive") && opt.Action != "DROP" {
+			if _, err := parseBoolOption(opt.Name, opt.Val); err != nil {
+				return err
+			}
+		}
+		if (opt.Name == "schemarename" || opt.Name == "tablerename") && opt.Action != "DROP" {
+			if _, err := command.ParseRenameRules(util.SplitList(opt.Val)); err != nil {
+				return err
+			}
+		}
+		if opt.Name == "rowfilters" && opt.Action != "DROP" {
+			if _, err := command.ParseRowFilters(util.SplitList(opt.Val)); err != nil {
+				return err
 			}
 		}
+		if opt.Name == "tablekeys" && opt.Action != "DROP" {
+			if _, err := command.ParseTableKeys(util.SplitList(opt.Val)); err != nil {
+				return err
+			}
+		}
+		if opt.Name == "retention" && opt.Action != "DROP" {
+			if _, err := catalog.ParseRetentionRules(util.SplitList(opt.Val)); err != nil {
+				return err
+			}
+		}
+		if opt.Name == "renamepreset" && opt.Action != "DROP" {
+			if _, err := command.RenamePreset(opt.Val); err != nil {
+				return err
+			}
+		}
+		if opt.Name == "saslmechanism" && opt.Action != "DROP" {
+			if err := checkSASLMechanism(opt.Val); err != nil {
+				return err
+			}
+			opt.Val = strings.ToUpper(opt.Val)
+		}
 		isnull, err := isSourceOptionNull(dc, node.DataSourceName, opt.Name)
 		if err != nil {
 			return fmt.Errorf("reading source option: %w", err)
@@ -691,7 +811,7 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 			if isnull {
 				return fmt.Errorf("option %q not found", opt.Name)
 			}
-			err := updateSource(dc, node.DataSourceName, opt.Name, "'"+opt.Val+"'")
+			err := updateSource(dc, node.DataSourceName, opt.Name, encodeString(opt.Val))
 			if err != nil {
 				return fmt.Errorf("unable to set option %q", opt.Name)
 			}
@@ -700,7 +820,7 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 			if !isnull {
 				return fmt.Errorf("option %q provided more than once", opt.Name)
 			}
-			err := updateSource(dc, node.DataSourceName, opt.Name, "'"+opt.Val+"'")
+			err := updateSource(dc, node.DataSourceName, opt.Name, encodeString(opt.Val))
 			if err != nil {
 				return fmt.Errorf("unable to add option %q", opt.Name)
 			}
@@ -710,6 +830,84 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 	return nil
 }
 
+// alteredOptions returns the values that options of a data source will have
+// after they are altered, using the stored values of options that are not
+// altered.  A nil value means that the option is not set.  It also returns
+// true if any of the options are altered.
+func alteredOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt, names ...string) ([]*string, bool, error) {
+	vals := make([]*string, len(names))
+	dest := make([]any, len(names))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	q := "SELECT " + strings.Join(names, ",") + " FROM metadb.source WHERE name=$1"
+	if err := dc.QueryRow(context.TODO(), q, node.DataSourceName).Scan(dest...); err != nil {
+		return nil, false, fmt.Errorf("reading data source: %w", err)
+	}
+	var altered bool
+	for _, opt := range node.Options {
+		for i := range names {
+			if opt.Name != names[i] {
+				continue
+			}
+			altered = true
+			if opt.Action == "DROP" {
+				vals[i] = nil
+			} else {
+				val := opt.Val
+				vals[i] = &val
+			}
+		}
+	}
+	return vals, altered, nil
+}
+
+// checkAlterColumnRules checks the column rules of a data source as they will
+// be after the options are altered, using the stored column rules or hash key
+// if they are not altered.
+func checkAlterColumnRules(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
+	vals, altered, err := alteredOptions(dc, node, "columnrules", "columnhashkey")
+	if err != nil {
+		return err
+	}
+	rules, hashKey := vals[0], vals[1]
+	if !altered || rules == nil {
+		return nil
+	}
+	var key string
+	if hashKey != nil {
+		key = *hashKey
+	}
+	_, err = command.ParseColumnRules(util.SplitList(*rules), key)
+	return err
+}
+
+// checkAlterFormat checks that a schema registry is defined if the format of
+// a data source will be avro after the options are altered, as is required
+// when a data source is created.
+func checkAlterFormat(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
+	vals, altered, err := alteredOptions(dc, node, "format", "schemaregistry")
+	if err != nil {
+		return err
+	}
+	format, registry := vals[0], vals[1]
+	if altered && format != nil && strings.ToLower(*format) == "avro" && (registry == nil || *registry == "") {
+		return fmt.Errorf("option \"schemaregistry\" is required with format \"avro\"")
+	}
+	return nil
+}
+
+// checkPostgresqlOption returns an error if an option is not supported for
+// data sources of type postgresql, which are read one source transaction at a
+// time.
+func checkPostgresqlOption(name string) error {
+	switch name {
+	case "concurrency", "deadletter", "transactions":
+		return fmt.Errorf("option %q is not supported for data source type %q", name, "postgresql")
+	}
+	return nil
+}
+
 func isSourceOptionNull(dc *pgx.Conn, sourceName, optionName string) (bool, error) {
 	var val *string
 	q := "SELECT " + optionName + " FROM metadb.source WHERE name='" + sourceName + "'"
@@ -724,6 +922,12 @@ func isSourceOptionNull(dc *pgx.Conn, sourceName, optionName string) (bool, erro
 	}
 }
 
+func encodeString(s string) string {
+	var b strings.Builder
+	dbx.EncodeString(&b, s)
+	return b.String()
+}
+
 func updateSource(dc *pgx.Conn, sourceName, optionName, valueText string) error {
 	q := "UPDATE metadb.source SET " + optionName + "=" + valueText + " WHERE name='" + sourceName + "'"
 	_, err := dc.Exec(context.TODO(), q)
@@ -743,6 +947,9 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 		SchemaPassFilter: []string{},
 		SchemaStopFilter: []string{},
 		TableStopFilter:  []string{},
+		Format:           "json",
+		Concurrency:      1,
+		SyncConcurrency:  32,
 	}
 	for _, opt := range options {
 		switch strings.ToLower(opt.Name) {
@@ -768,17 +975,181 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 		//	s.Enable = (strings.ToLower(opt.Val) == "true")
 		case "module":
 			s.Module = opt.Val
+		case "format":
+			s.Format = strings.ToLower(opt.Val)
+		case "schemaregistry":
+			s.SchemaRegistry = opt.Val
+		case "concurrency":
+			if s.Concurrency, err = parseSourceConcurrency(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "syncconcurrency":
+			if s.SyncConcurrency, err = parseSourceConcurrency(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "saslmechanism":
+			if err = checkSASLMechanism(opt.Val); err != nil {
+				return nil, err
+			}
+			s.SASLMechanism = strings.ToUpper(opt.Val)
+		case "saslusername":
+			s.SASLUsername = opt.Val
+		case "saslpassword":
+			s.SASLPassword = opt.Val
+		case "sslca":
+			s.SSLCA = opt.Val
+		case "sslcert":
+			s.SSLCert = opt.Val
+		case "sslkey":
+			s.SSLKey = opt.Val
+		case "deadletter":
+			if s.DeadLetter, err = parseBoolOption(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "transactions":
+			if s.Transactions, err = parseBoolOption(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "connection":
+			s.Connection = opt.Val
+		case "publication":
+			s.Publication = opt.Val
+		case "slot":
+			s.Slot = opt.Val
+		case "schemarename":
+			s.SchemaRename = util.SplitList(opt.Val)
+			if _, err = command.ParseRenameRules(s.SchemaRename); err != nil {
+				return nil, err
+			}
+		case "tablerename":
+			s.TableRename = util.SplitList(opt.Val)
+			if _, err = command.ParseRenameRules(s.TableRename); err != nil {
+				return nil, err
+			}
+		case "renamepreset":
+			if _, err = command.RenamePreset(opt.Val); err != nil {
+				return nil, err
+			}
+			s.RenamePreset = opt.Val
+		case "columnrules":
+			s.ColumnRules = util.SplitList(opt.Val)
+		case "columnhashkey":
+			s.ColumnHashKey = opt.Val
+		case "rowfilters":
+			s.RowFilters = util.SplitList(opt.Val)
+			if _, err = command.ParseRowFilters(s.RowFilters); err != nil {
+				return nil, err
+			}
+		case "tablekeys":
+			s.TableKeys = util.SplitList(opt.Val)
+			if _, err = command.ParseTableKeys(s.TableKeys); err != nil {
+				return nil, err
+			}
+		case "fullrowkey":
+			if s.FullRowKey, err = parseBoolOption(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "auditcolumns":
+			if s.AuditColumns, err = parseBoolOption(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
+		case "retention":
+			s.Retention = util.SplitList(opt.Val)
+			if _, err = catalog.ParseRetentionRules(s.Retention); err != nil {
+				return nil, err
+			}
+		case "retentionarchive":
+			if s.RetentionArchive, err = parseBoolOption(opt.Name, opt.Val); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module",
+					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module, format, schemaregistry, concurrency, syncconcurrency, saslmechanism, saslusername, saslpassword, sslca, sslcert, sslkey, deadletter, transactions, connection, publication, slot, schemarename, tablerename, renamepreset, columnrules, columnhashkey, rowfilters, tablekeys, fullrowkey, auditcolumns, retention, retentionarchive",
 			}
 		}
 	}
+	if err = checkSourceFormat(s.Format); err != nil {
+		return nil, err
+	}
+	if _, err = command.ParseColumnRules(s.ColumnRules, s.ColumnHashKey); err != nil {
+		return nil, err
+	}
+	if s.Format == "avro" && s.SchemaRegistry == "" {
+		return nil, fmt.Errorf("option \"schemaregistry\" is required with format \"avro\"")
+	}
+	if s.SASLMechanism != "" && !strings.HasPrefix(strings.ToLower(s.Security), "sasl_") {
+		return nil, &dberr.Error{
+			Err:  fmt.Errorf("option \"saslmechanism\" requires a SASL security protocol"),
+			Hint: "Set option \"security\" to 'sasl_ssl' or 'sasl_plaintext'.",
+		}
+	}
 	return s, nil
 }
 
+func checkSourceFormat(format string) error {
+	switch format {
+	case "json", "json-schemaless", "avro":
+		return nil
+	default:
+		return &dberr.Error{
+			Err:  fmt.Errorf("invalid format %q", format),
+			Hint: "Valid formats are: json, json-schemaless, avro",
+		}
+	}
+}
+
+func parseBoolOption(name, val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, &dberr.Error{
+			Err:  fmt.Errorf("invalid value for option %q: %q", name, val),
+			Hint: "The value must be 'true' or 'false'.",
+		}
+	}
+}
+
+func checkSASLMechanism(mechanism string) error {
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		return nil
+	default:
+		return &dberr.Error{
+			Err:  fmt.Errorf("invalid SASL mechanism %q", mechanism),
+			Hint: "Valid SASL mechanisms are: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512",
+		}
+	}
+}
+
+// nullString returns nil for an empty string, so that an option that was not
+// specified is stored as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// maxSourceConcurrency is the maximum number of concurrent consumers for a
+// data source.
+const maxSourceConcurrency = 256
+
+func parseSourceConcurrency(name, val string) (int, error) {
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 || n > maxSourceConcurrency {
+		return 0, &dberr.Error{
+			Err:  fmt.Errorf("invalid value for option %q: %q", name, val),
+			Hint: fmt.Sprintf("The value must be an integer between 1 and %d.", maxSourceConcurrency),
+		}
+	}
+	return n, nil
+}
+
 func checkOptionDuplicates(options []ast.Option) error {
 	m := make(map[string]bool)
 	for _, opt := range options {
@@ -791,7 +1162,7 @@ func checkOptionDuplicates(options []ast.Option) error {
 	return nil
 }
 
-func createUser(conn net.Conn /*query string,*/, node *ast.CreateUserStmt, db *dbx.DB, dc *pgx.Conn) error {
+func createUser(conn io.Writer /*query string,*/, node *ast.CreateUserStmt, db *dbx.DB, dc *pgx.Conn) error {
 	if node.Options == nil {
 		// return to client
 	}
@@ -880,7 +1251,7 @@ type userOptions struct {
 	Comment  string
 }
 
-func authorize(conn net.Conn, node *ast.AuthorizeStmt, dc *pgx.Conn) error {
+func authorize(conn io.Writer, node *ast.AuthorizeStmt, dc *pgx.Conn) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %w", err)
@@ -942,7 +1313,7 @@ func userExists(dc *pgx.Conn, username string) (bool, error) {
 	}
 }
 
-func createDataOrigin(conn net.Conn, node *ast.CreateDataOriginStmt, dc *pgx.Conn) error {
+func createDataOrigin(conn io.Writer, node *ast.CreateDataOriginStmt, dc *pgx.Conn) error {
 	if len(node.OriginName) > 63 {
 		return fmt.Errorf("data origin name %q too long", node.OriginName)
 	}
@@ -985,7 +1356,7 @@ func originExists(dc *pgx.Conn, originName string) (bool, error) {
 	}
 }
 
-func refreshInferredColumnTypesStmt(conn net.Conn, dc *pgx.Conn) error {
+func refreshInferredColumnTypesStmt(conn io.Writer, dc *pgx.Conn) error {
 	err := tools.RefreshInferredColumnTypes(dc, func(msg string) {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
 			Message: msg},
@@ -1001,7 +1372,7 @@ func refreshInferredColumnTypesStmt(conn net.Conn, dc *pgx.Conn) error {
 	})
 }
 
-func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
+func verifyConsistencyStmt(conn io.Writer, dc *pgx.Conn) error {
 	err := tools.VerifyConsistency(dc, func(msg string) {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
 			Message: msg},
@@ -1017,7 +1388,7 @@ func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
 	})
 }
 
-//func version(conn net.Conn, query *pgproto3.Query, mdbVersion string) error {
+//func version(conn io.Writer, query *pgproto3.Query, mdbVersion string) error {
 //	var b []byte = encode(nil, []pgproto3.Message{
 //		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
 //			{
@@ -1037,7 +1408,7 @@ func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
 //	return write(conn, b)
 //}
 
-func writeEncoded(conn net.Conn, messages []pgproto3.Message) error {
+func writeEncoded(conn io.Writer, messages []pgproto3.Message) error {
 	buffer, erre := encode(nil, messages)
 	if erre != nil {
 		return erre
@@ -1064,7 +1435,7 @@ func encode(buffer []byte, messages []pgproto3.Message) ([]byte, error) {
 	return buffer, nil
 }
 
-func write(conn net.Conn, buffer []byte) error {
+func write(conn io.Writer, buffer []byte) error {
 	if buffer == nil || len(buffer) == 0 {
 		return nil
 	}
@@ -2,26 +2,31 @@ package libpq
 
 import (
 	"context"
-	"fmt"
-	"net"
+	"errors"
+	"io"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
-	"github.com/metadb-project/metadb/cmd/metadb/parser"
 )
 
-func proxyQuery(conn net.Conn, query string, args []any, node ast.Node, dc *pgx.Conn) error {
-	switch node.(type) {
-	case *ast.SelectStmt:
-		return proxySelect(conn, query, args, dc)
-		//case *ast.CreateUserStmt:
-		//	return createUser(conn, query, n, db)
+func proxyQuery(conn io.Writer, query string, node ast.Node, dc *pgx.Conn) error {
+	if tag := transactionCommandTag(query); tag != "" {
+		// Transaction control is accepted for the benefit of clients that
+		// issue it implicitly, but it has no effect.
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.CommandComplete{CommandTag: []byte(tag)},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
+	}
+	if isProxyAllowed(node, query) {
+		return proxySelect(conn, query, nil, dc)
 	}
 
 	return writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.ErrorResponse{Severity: "ERROR", Message: "syntax error"},
+		&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "syntax error"},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
 	})
 
@@ -36,41 +41,238 @@ func proxyQuery(conn net.Conn, query string, args []any, node ast.Node, dc *pgx.
 	//return write(conn, b)
 }
 
-func proxySelect(conn net.Conn, query string, args []any, dbconn *pgx.Conn) error {
-	var err error
-	var rows pgx.Rows
-	if rows, err = dbconn.Query(context.TODO(), query, args...); err != nil {
-		var ok bool
-		var e *pgconn.PgError
-		if e, ok = err.(*pgconn.PgError); !ok {
-			panic("passthroughQuery(): casting error to *pgconn.PgError")
+// isProxyAllowed reports whether a statement not recognized by Metadb may be
+// passed through to the database.  Only queries and session settings are
+// allowed.  Since the statement is run in a read-only transaction, a query
+// that attempts to modify data fails in any case.
+func isProxyAllowed(node ast.Node, query string) bool {
+	if _, ok := node.(*ast.SelectStmt); ok {
+		return true
+	}
+	switch firstKeyword(query) {
+	case "select", "values", "table", "show":
+		return true
+	case "with":
+		return !hasModifyingKeyword(query)
+	case "set", "reset":
+		return isSettingAllowed(query)
+	default:
+		return false
+	}
+}
+
+// proxySettings are the run-time parameters that clients may change with SET
+// or RESET.
+var proxySettings = map[string]bool{
+	"application_name":                    true,
+	"bytea_output":                        true,
+	"client_encoding":                     true,
+	"client_min_messages":                 true,
+	"datestyle":                           true,
+	"extra_float_digits":                  true,
+	"idle_in_transaction_session_timeout": true,
+	"intervalstyle":                       true,
+	"lc_monetary":                         true,
+	"lc_numeric":                          true,
+	"lc_time":                             true,
+	"lock_timeout":                        true,
+	"search_path":                         true,
+	"standard_conforming_strings":         true,
+	"statement_timeout":                   true,
+	"timezone":                            true,
+	"work_mem":                            true,
+}
+
+// isSettingAllowed reports whether a SET or RESET statement changes only a
+// parameter in proxySettings.  In particular, SET ROLE and SET SESSION
+// AUTHORIZATION are not allowed.
+func isSettingAllowed(query string) bool {
+	f := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ';' || r == '='
+	})
+	if len(f) < 2 {
+		return false
+	}
+	i := 1
+	if f[0] == "set" && (f[1] == "session" || f[1] == "local") {
+		i = 2
+	}
+	if i >= len(f) {
+		return false
+	}
+	name := strings.Trim(f[i], "\"")
+	switch {
+	case f[0] == "reset" && name == "all":
+		return len(f) == 2
+	case f[0] == "set" && name == "time" && i+1 < len(f) && f[i+1] == "zone":
+		return true
+	default:
+		return proxySettings[name]
+	}
+}
+
+// hasModifyingKeyword reports whether a query contains a keyword that begins
+// a data-modifying statement, such as in a WITH clause.  Quoted strings,
+// quoted identifiers, and comments are ignored.
+func hasModifyingKeyword(query string) bool {
+	q := strings.ToLower(query)
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(q[i+1:], c)
+			if j < 0 {
+				return false
+			}
+			i += j + 2
+		case strings.HasPrefix(q[i:], "--"):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return false
+			}
+			i += j + 1
+		case strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i:], "*/")
+			if j < 0 {
+				return false
+			}
+			i += j + 2
+		case isWordByte(c):
+			j := i
+			for j < len(q) && isWordByte(q[j]) {
+				j++
+			}
+			switch q[i:j] {
+			case "insert", "update", "delete", "merge":
+				return true
+			}
+			i = j
+		default:
+			i++
 		}
-		var s = e.Severity + ":  " + e.Message + "\n" + parser.WriteErrorContext(query, int(e.Position-1))
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+// transactionCommandTag returns the command tag for a transaction control
+// statement, or "" if the query is not one.
+func transactionCommandTag(query string) string {
+	switch firstKeyword(query) {
+	case "begin", "start":
+		return "BEGIN"
+	case "commit", "end":
+		return "COMMIT"
+	case "rollback", "abort":
+		return "ROLLBACK"
+	default:
+		return ""
+	}
+}
+
+func firstKeyword(query string) string {
+	f := strings.FieldsFunc(query, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ';' || r == '('
+	})
+	if len(f) == 0 {
+		return ""
+	}
+	return strings.ToLower(f[0])
+}
+
+// proxySelect runs a query in the database and writes the results to the
+// client.  Data are passed through in text format, together with the original
+// field descriptions.
+func proxySelect(conn io.Writer, query string, args [][]byte, dbconn *pgx.Conn) error {
+	result := execReadOnly(dbconn, query, args, nil, nil, nil)
+	if result.Err != nil {
 		return writeEncoded(conn, []pgproto3.Message{
-			&pgproto3.ErrorResponse{Message: s},
+			errorResponse(result.Err),
 			&pgproto3.ReadyForQuery{TxStatus: 'I'},
 		})
 	}
-	defer rows.Close()
-	var cols = rows.FieldDescriptions()
-	b, erre := encodeFieldDesc(nil, cols)
-	if erre != nil {
-		return fmt.Errorf("proxy select: field desc: %v", erre)
+	m := make([]pgproto3.Message, 0)
+	if result.FieldDescriptions != nil {
+		m = append(m, rowDescription(result.FieldDescriptions, nil))
 	}
-	for rows.Next() {
-		if b, err = encodeRow(b, rows, cols); err != nil {
-			return err
-		}
+	for _, r := range result.Rows {
+		m = append(m, &pgproto3.DataRow{Values: r})
 	}
-	if err = rows.Err(); err != nil {
-		return err
+	m = append(m, &pgproto3.CommandComplete{CommandTag: []byte(result.CommandTag.String())})
+	m = append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	return writeEncoded(conn, m)
+}
+
+// execReadOnly runs a single statement in a read-only transaction, so that it
+// cannot modify the database.  Session settings made by the statement remain in
+// effect after the transaction.
+func execReadOnly(dbconn *pgx.Conn, query string, args [][]byte, paramOIDs []uint32, paramFormats []int16, resultFormats []int16) *pgconn.Result {
+	pc := dbconn.PgConn()
+	if _, err := pc.Exec(context.TODO(), "BEGIN READ ONLY").ReadAll(); err != nil {
+		return &pgconn.Result{Err: err}
 	}
-	b, erre = encode(b, []pgproto3.Message{
-		&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
-	if erre != nil {
-		return fmt.Errorf("proxy select: %v", erre)
+	result := pc.ExecParams(context.TODO(), query, args, paramOIDs, paramFormats, resultFormats).Read()
+	end := "COMMIT"
+	if result.Err != nil {
+		end = "ROLLBACK"
+	}
+	if _, err := pc.Exec(context.TODO(), end).ReadAll(); err != nil && result.Err == nil {
+		result.Err = err
+	}
+	return result
+}
+
+// rowDescription converts field descriptions returned by the database into a
+// RowDescription message.  If formats is not nil, it specifies the result
+// format codes as in a Bind message.
+func rowDescription(fields []pgconn.FieldDescription, formats []int16) *pgproto3.RowDescription {
+	desc := &pgproto3.RowDescription{Fields: make([]pgproto3.FieldDescription, 0, len(fields))}
+	for i, f := range fields {
+		desc.Fields = append(desc.Fields, pgproto3.FieldDescription{
+			Name:                 []byte(f.Name),
+			TableOID:             f.TableOID,
+			TableAttributeNumber: f.TableAttributeNumber,
+			DataTypeOID:          f.DataTypeOID,
+			DataTypeSize:         f.DataTypeSize,
+			TypeModifier:         f.TypeModifier,
+			Format:               formatCode(formats, i),
+		})
+	}
+	return desc
+}
+
+// formatCode returns the format code of column i, given format codes as
+// specified in a Bind message: none (all text), one (applies to all), or one
+// per column.
+func formatCode(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return 0
+	case 1:
+		return formats[0]
+	default:
+		if i < len(formats) {
+			return formats[i]
+		}
+		return 0
+	}
+}
+
+// errorResponse converts an error into an ErrorResponse message, retaining
+// the fields of a database error.
+func errorResponse(err error) *pgproto3.ErrorResponse {
+	var e *pgconn.PgError
+	if errors.As(err, &e) {
+		return &pgproto3.ErrorResponse{
+			Severity: e.Severity,
+			Code:     e.Code,
+			Message:  e.Message,
+			Detail:   e.Detail,
+			Hint:     e.Hint,
+			Position: e.Position,
+		}
 	}
-	return write(conn, b)
+	return &pgproto3.ErrorResponse{Severity: "ERROR", Code: "XX000", Message: err.Error()}
 }
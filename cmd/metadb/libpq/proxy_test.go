@@ -0,0 +1,78 @@
+package libpq
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+func TestIsProxyAllowed(t *testing.T) {
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  (select 1)", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"with t as (select 'delete' as \"insert\") select * from t -- update", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE folio_users.users", true},
+		{"SHOW search_path", true},
+		{"WITH t AS (INSERT INTO a VALUES (1) RETURNING *) SELECT * FROM t", false},
+		{"with t as (delete from a returning *) select * from t", false},
+		{"WITH t AS (SELECT 1) UPDATE a SET x = 1", false},
+		{"INSERT INTO a VALUES (1)", false},
+		{"UPDATE a SET x = 1", false},
+		{"DELETE FROM a", false},
+		{"MERGE INTO a USING b ON a.id = b.id WHEN MATCHED THEN DELETE", false},
+		{"TRUNCATE a", false},
+		{"CREATE TABLE a (x integer)", false},
+		{"DROP TABLE a", false},
+		{"ALTER TABLE a ADD COLUMN y integer", false},
+		{"GRANT SELECT ON a TO public", false},
+		{"COPY a FROM '/tmp/a'", false},
+		{"COPY (SELECT 1) TO STDOUT", false},
+		{"CALL p()", false},
+		{"", false},
+		{"SET search_path = folio_users, public", true},
+		{"set session statement_timeout to 0", true},
+		{"SET LOCAL work_mem = '64MB'", true},
+		{"SET \"DateStyle\" = ISO", true},
+		{"SET TIME ZONE 'UTC'", true},
+		{"RESET application_name", true},
+		{"RESET ALL", true},
+		{"SET ROLE postgres", false},
+		{"SET SESSION AUTHORIZATION postgres", false},
+		{"SET default_transaction_read_only = off", false},
+		{"SET transaction_read_only = off", false},
+		{"SET session_replication_role = replica", false},
+		{"RESET ROLE", false},
+		{"RESET ALL; SET ROLE postgres", false},
+		{"SET", false},
+		{"SET SESSION", false},
+	}
+	for _, c := range cases {
+		if got := isProxyAllowed(nil, c.query); got != c.want {
+			t.Errorf("%q: got %v; want %v", c.query, got, c.want)
+		}
+	}
+	if !isProxyAllowed(&ast.SelectStmt{}, "") {
+		t.Errorf("select statement: got false; want true")
+	}
+}
+
+func TestProxySettings(t *testing.T) {
+	for name := range proxySettings {
+		for _, q := range []string{"SET " + name + " = DEFAULT", "SET " + name + " TO DEFAULT", "RESET " + name} {
+			if !isProxyAllowed(nil, q) {
+				t.Errorf("%q: got false; want true", q)
+			}
+		}
+	}
+	for _, name := range []string{"role", "session_authorization", "default_transaction_read_only",
+		"transaction_read_only", "session_replication_role", "log_statement", "shared_preload_libraries"} {
+		if proxySettings[name] {
+			t.Errorf("%q: setting should not be allowed", name)
+		}
+	}
+}
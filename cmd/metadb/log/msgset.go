@@ -1,6 +1,10 @@
 package log
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
+)
 
 type MessageSet struct {
 	mu       sync.Mutex
@@ -21,8 +25,10 @@ func (d *MessageSet) Insert(msg string) bool {
 
 	_, ok := d.messages[msg]
 	if ok {
+		metrics.DedupWarnings.Inc("suppressed")
 		return false
 	}
 	d.messages[msg] = struct{}{}
+	metrics.DedupWarnings.Inc("logged")
 	return true
 }
@@ -59,6 +59,7 @@ func run() error {
 	var syncOpt = option.Sync{}
 	var endSyncOpt = option.EndSync{}
 	var migrateOpt = option.Migrate{}
+	var replayOpt = option.Replay{}
 	var logfile, csvlogfile string
 
 	var cmdInit = &cobra.Command{
@@ -130,7 +131,12 @@ func run() error {
 			//        serverOpt.Port = metadbAdminPort
 			//}
 			serverOpt.RewriteJSON = rewriteJSON == "1"
-			serverOpt.Listen = "127.0.0.1"
+			if serverOpt.Listen == "" {
+				serverOpt.Listen = "127.0.0.1"
+			}
+			if serverOpt.MetricsListen == "" {
+				serverOpt.MetricsListen = "127.0.0.1"
+			}
 			if err = server.Start(&serverOpt); err != nil {
 				return fatal(err, logf, csvlogf)
 			}
@@ -141,15 +147,17 @@ func run() error {
 	_ = dirFlag(cmdStart, &serverOpt.Datadir)
 	_ = logFlag(cmdStart, &logfile)
 	//_ = csvlogFlag(cmdStart, &csvlogfile)
-	//_ = listenFlag(cmdStart, &serverOpt.Listen)
+	_ = listenFlag(cmdStart, &serverOpt.Listen)
 	_ = portFlag(cmdStart, &serverOpt.Port)
-	//_ = certFlag(cmdStart, &serverOpt.TLSCert)
-	//_ = keyFlag(cmdStart, &serverOpt.TLSKey)
+	_ = metricsPortFlag(cmdStart, &serverOpt.MetricsPort)
+	_ = metricsListenFlag(cmdStart, &serverOpt.MetricsListen)
+	_ = certFlag(cmdStart, &serverOpt.TLSCert)
+	_ = keyFlag(cmdStart, &serverOpt.TLSKey)
 	_ = debugFlag(cmdStart, &serverOpt.Debug)
 	_ = traceLogFlag(cmdStart, &serverOpt.Trace)
 	_ = noKafkaCommitFlag(cmdStart, &serverOpt.NoKafkaCommit)
 	_ = logSourceFlag(cmdStart, &serverOpt.LogSource)
-	//_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
+	_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
 	_ = memoryLimitFlag(cmdStart, &serverOpt.MemoryLimit)
 
 	var cmdStop = &cobra.Command{
@@ -237,6 +245,35 @@ func run() error {
 	_ = dirFlag(cmdMigrate, &migrateOpt.Datadir)
 	_ = traceFlag(cmdMigrate, &eout.EnableTrace)
 
+	var cmdReplay = &cobra.Command{
+		Use:  "replay",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err = initColor(); err != nil {
+				return err
+			}
+			replayOpt.Global = globalOpt
+			replayOpt.Files = args
+			replayOpt.RewriteJSON = rewriteJSON == "1"
+			var logf, csvlogf *os.File
+			if logf, csvlogf, err = setupLog(logfile, csvlogfile, replayOpt.Debug, replayOpt.Trace); err != nil {
+				return err
+			}
+			if err = server.Replay(&replayOpt); err != nil {
+				return fatal(err, logf, csvlogf)
+			}
+			return nil
+		},
+	}
+	cmdReplay.SetHelpFunc(help)
+	cmdReplay.Flags().StringVar(&replayOpt.Source, "source", "", "")
+	_ = cmdReplay.MarkFlagRequired("source")
+	_ = dirFlag(cmdReplay, &replayOpt.Datadir)
+	_ = logFlag(cmdReplay, &logfile)
+	_ = debugFlag(cmdReplay, &replayOpt.Debug)
+	_ = traceLogFlag(cmdReplay, &replayOpt.Trace)
+
 	var cmdVersion = &cobra.Command{
 		Use: "version",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -262,7 +299,7 @@ func run() error {
 	//rootCmd.PersistentFlags().StringVar(&_, "client", metadbClientPort, ""+
 	//        "client port")
 	// Add commands.
-	rootCmd.AddCommand(cmdStart, cmdStop, cmdInit, cmdUpgrade, cmdSync, cmdEndSync, cmdMigrate, cmdVersion)
+	rootCmd.AddCommand(cmdStart, cmdStop, cmdInit, cmdUpgrade, cmdSync, cmdEndSync, cmdMigrate, cmdReplay, cmdVersion)
 	var err error
 	if err = rootCmd.Execute(); err != nil {
 		return err
@@ -278,6 +315,7 @@ var helpUpgrade = "Upgrade Metadb instance to current version\n"
 var helpSync = "begin synchronization with a data source\n"
 var helpEndSync = "End synchronization and remove leftover data\n"
 var helpMigrate = "Migrate historical data from LDP\n"
+var helpReplay = "Write change events from files to the database\n"
 var helpVersion = "Print metadb version\n"
 
 func help(cmd *cobra.Command, commandLine []string) {
@@ -297,6 +335,7 @@ func help(cmd *cobra.Command, commandLine []string) {
 			"  sync                        - " + helpSync +
 			"  endsync                     - " + helpEndSync +
 			"  migrate                     - " + helpMigrate +
+			"  replay                      - " + helpReplay +
 			"  version                     - " + helpVersion +
 			"\n" +
 			"Use \"metadb help <command>\" for more information about a command.\n")
@@ -310,12 +349,14 @@ func help(cmd *cobra.Command, commandLine []string) {
 			dirFlag(nil, nil) +
 			logFlag(nil, nil) +
 			//csvlogFlag(nil, nil) +
-			//listenFlag(nil, nil) +
+			listenFlag(nil, nil) +
 			portFlag(nil, nil) +
-			//certFlag(nil, nil) +
-			//keyFlag(nil, nil) +
+			metricsPortFlag(nil, nil) +
+			metricsListenFlag(nil, nil) +
+			certFlag(nil, nil) +
+			keyFlag(nil, nil) +
 			debugFlag(nil, nil) +
-			//noTLSFlag(nil, nil) +
+			noTLSFlag(nil, nil) +
 			traceLogFlag(nil, nil) +
 			noKafkaCommitFlag(nil, nil) +
 			logSourceFlag(nil, nil) +
@@ -394,6 +435,19 @@ func help(cmd *cobra.Command, commandLine []string) {
 			"  -D, --dir <d>               - Metadb data directory\n" +
 			traceFlag(nil, nil) +
 			"")
+	case "replay":
+		fmt.Printf("" +
+			helpReplay +
+			"\n" +
+			"Usage:  metadb replay <options> <file>...\n" +
+			"\n" +
+			"Options:\n" +
+			"      --source <s>            - Data source to replay change events as\n" +
+			dirFlag(nil, nil) +
+			logFlag(nil, nil) +
+			debugFlag(nil, nil) +
+			traceLogFlag(nil, nil) +
+			"")
 	case "version":
 		fmt.Printf("" +
 			helpVersion +
@@ -471,13 +525,13 @@ func traceLogFlag(cmd *cobra.Command, trace *bool) string {
 	return ""
 }
 
-//func listenFlag(cmd *cobra.Command, listen *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(listen, "listen", "", "")
-//	}
-//	return "" +
-//		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
-//}
+func listenFlag(cmd *cobra.Command, listen *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(listen, "listen", "", "")
+	}
+	return "" +
+		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
+}
 
 func portFlag(cmd *cobra.Command, adminPort *string) string {
 	if cmd != nil {
@@ -487,22 +541,40 @@ func portFlag(cmd *cobra.Command, adminPort *string) string {
 		"  -p, --port <p>              - Port to listen on (default: " + defaultPort + ")\n"
 }
 
-//func certFlag(cmd *cobra.Command, cert *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(cert, "cert", "", "")
-//	}
-//	return "" +
-//		"      --cert <f>              - File name of server certificate, including the\n" +
-//		"                                CA's certificate and intermediates\n"
-//}
+func metricsPortFlag(cmd *cobra.Command, metricsPort *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(metricsPort, "metricsport", "", "")
+	}
+	return "" +
+		"      --metricsport <p>       - Port to serve Prometheus metrics on (default:\n" +
+		"                                disabled)\n"
+}
 
-//func keyFlag(cmd *cobra.Command, key *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(key, "key", "", "")
-//	}
-//	return "" +
-//		"      --key <f>               - File name of server private key\n"
-//}
+func metricsListenFlag(cmd *cobra.Command, metricsListen *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(metricsListen, "metricslisten", "", "")
+	}
+	return "" +
+		"      --metricslisten <a>     - Address to serve metrics on (default:\n" +
+		"                                127.0.0.1)\n"
+}
+
+func certFlag(cmd *cobra.Command, cert *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(cert, "cert", "", "")
+	}
+	return "" +
+		"      --cert <f>              - File name of server certificate, including the\n" +
+		"                                CA's certificate and intermediates\n"
+}
+
+func keyFlag(cmd *cobra.Command, key *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(key, "key", "", "")
+	}
+	return "" +
+		"      --key <f>               - File name of server private key\n"
+}
 
 func logFlag(cmd *cobra.Command, logfile *string) string {
 	if cmd != nil {
@@ -537,14 +609,14 @@ func dirFlag(cmd *cobra.Command, datadir *string) string {
 }
 */
 
-//func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
-//	if cmd != nil {
-//		cmd.Flags().BoolVar(noTLS, "notls", false, "")
-//	}
-//	return "" +
-//		"      --notls                 - Disable TLS in client connections [insecure,\n" +
-//		"                                use for testing only]\n"
-//}
+func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
+	if cmd != nil {
+		cmd.Flags().BoolVar(noTLS, "notls", false, "")
+	}
+	return "" +
+		"      --notls                 - Disable TLS in client connections [insecure,\n" +
+		"                                use for testing only]\n"
+}
 
 func memoryLimitFlag(cmd *cobra.Command, memoryLimit *float64) string {
 	if cmd != nil {
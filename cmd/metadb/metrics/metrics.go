@@ -0,0 +1,294 @@
+// Package metrics collects server metrics and exposes them over HTTP in the
+// Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics exported by the server.
+var (
+	EventsRead = NewCounterVec("metadb_events_read_total",
+		"Number of change events read from a data source.", "source")
+	LastEventTime = NewGaugeVec("metadb_last_event_timestamp_seconds",
+		"Time when a change event was last read from a data source, in seconds since the epoch.", "source")
+	CommandsExecuted = NewCounterVec("metadb_commands_executed_total",
+		"Number of commands executed, by operation.", "source", "op")
+	FlushDuration = NewHistogramVec("metadb_flush_duration_seconds",
+		"Time taken to write buffered commands to the database.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}, "source")
+	ConsumerLag = NewGaugeVec("metadb_consumer_lag",
+		"Number of messages in a Kafka partition that have not yet been read.", "source", "topic", "partition")
+	Rebalances = NewCounterVec("metadb_consumer_rebalances_total",
+		"Number of Kafka consumer group rebalance events.", "source", "event")
+	DedupWarnings = NewCounterVec("metadb_dedup_warnings_total",
+		"Number of deduplicated warnings, by whether the warning was logged or suppressed as a repeat.", "result")
+	MaintenanceDuration = NewGaugeVec("metadb_maintenance_duration_seconds",
+		"Time taken by the last run of a maintenance job.", "source", "job")
+)
+
+var registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// family is a metric and its values for each combination of label values.
+type family struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histogram data
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newFamily(name, help, typ string, buckets []float64, labels []string) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	registry.mu.Lock()
+	registry.families = append(registry.families, f)
+	registry.mu.Unlock()
+	return f
+}
+
+// get returns the series having the specified label values.  The caller must
+// hold f.mu.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	k := strings.Join(labelValues, "\x00")
+	s, ok := f.series[k]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[k] = s
+	}
+	return s
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	f *family
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: newFamily(name, help, "counter", nil, labels)}
+}
+
+// Add increases the counter having the specified label values by n.
+func (c *CounterVec) Add(n float64, labelValues ...string) {
+	c.f.mu.Lock()
+	c.f.get(labelValues).value += n
+	c.f.mu.Unlock()
+}
+
+// Inc increases the counter having the specified label values by 1.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	f *family
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: newFamily(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the gauge having the specified label values.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value = v
+	g.f.mu.Unlock()
+}
+
+// SetToCurrentTime sets the gauge having the specified label values to the
+// current time in seconds since the epoch.
+func (g *GaugeVec) SetToCurrentTime(labelValues ...string) {
+	g.Set(float64(time.Now().UnixNano())/1e9, labelValues...)
+}
+
+// Delete removes the gauge having the specified label values, for example
+// when a partition is no longer assigned.
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.f.mu.Lock()
+	delete(g.f.series, strings.Join(labelValues, "\x00"))
+	g.f.mu.Unlock()
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	f *family
+}
+
+// NewHistogramVec creates a histogram having the specified upper bounds of
+// buckets, which must be in increasing order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{f: newFamily(name, help, "histogram", buckets, labels)}
+}
+
+// Observe adds a value to the histogram having the specified label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	s := h.f.get(labelValues)
+	for i, b := range h.f.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	h.f.mu.Unlock()
+}
+
+// ObserveDuration adds the time elapsed since start, in seconds, to the
+// histogram having the specified label values.
+func (h *HistogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Write writes all metrics to w in the Prometheus text format.
+func Write(w io.Writer) error {
+	registry.mu.Lock()
+	families := append([]*family(nil), registry.families...)
+	registry.mu.Unlock()
+	b := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(b)
+	}
+	return b.Flush()
+}
+
+func (f *family) write(b *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(b, "# HELP %s %s\n", f.name, f.help)
+	_, _ = fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			writeSample(b, f.name, f.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+		for i, le := range f.buckets {
+			writeSample(b, f.name+"_bucket", f.labels, s.labelValues, "le", formatValue(le), float64(s.counts[i]))
+		}
+		writeSample(b, f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(b, f.name+"_sum", f.labels, s.labelValues, "", "", s.sum)
+		writeSample(b, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func writeSample(b *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, v float64) {
+	_, _ = b.WriteString(name)
+	if len(labels) != 0 || extraLabel != "" {
+		_ = b.WriteByte('{')
+		for i := range labels {
+			if i != 0 {
+				_ = b.WriteByte(',')
+			}
+			writeLabel(b, labels[i], labelValues[i])
+		}
+		if extraLabel != "" {
+			if len(labels) != 0 {
+				_ = b.WriteByte(',')
+			}
+			writeLabel(b, extraLabel, extraValue)
+		}
+		_ = b.WriteByte('}')
+	}
+	_ = b.WriteByte(' ')
+	_, _ = b.WriteString(formatValue(v))
+	_ = b.WriteByte('\n')
+}
+
+func writeLabel(b *bufio.Writer, label, value string) {
+	_, _ = b.WriteString(label)
+	_, _ = b.WriteString(`="`)
+	for _, c := range value {
+		switch c {
+		case '\\':
+			_, _ = b.WriteString(`\\`)
+		case '"':
+			_, _ = b.WriteString(`\"`)
+		case '\n':
+			_, _ = b.WriteString(`\n`)
+		default:
+			_, _ = b.WriteRune(c)
+		}
+	}
+	_ = b.WriteByte('"')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Handler returns an HTTP handler that serves the metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w)
+	})
+}
+
+// ListenAndServe serves the metrics at path /metrics on the specified
+// address.
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	svr := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return svr.ListenAndServe()
+}
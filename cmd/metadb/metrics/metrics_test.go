@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounterVec("test_events_total", "Test counter.", "source")
+	c.Inc(`a"b`)
+	c.Add(2, `a"b`)
+	h := NewHistogramVec("test_duration_seconds", "Test histogram.", []float64{0.1, 1}, "source")
+	h.Observe(0.5, "x")
+	h.Observe(2, "x")
+	var b strings.Builder
+	if err := Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"# TYPE test_events_total counter\n",
+		`test_events_total{source="a\"b"} 3` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{source="x",le="0.1"} 0` + "\n",
+		`test_duration_seconds_bucket{source="x",le="1"} 1` + "\n",
+		`test_duration_seconds_bucket{source="x",le="+Inf"} 2` + "\n",
+		`test_duration_seconds_sum{source="x"} 2.5` + "\n",
+		`test_duration_seconds_count{source="x"} 2` + "\n",
+	}
+	out := b.String()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q:\n%s", w, out)
+		}
+	}
+}
@@ -27,6 +27,8 @@ type Server struct {
 	LogSource     string
 	Listen        string
 	Port          string
+	MetricsPort   string
+	MetricsListen string
 	TLSCert       string
 	TLSKey        string
 	NoTLS         bool
@@ -58,6 +60,16 @@ type EndSync struct {
 	Force   bool
 }
 
+type Replay struct {
+	Global
+	Debug       bool
+	Trace       bool
+	Datadir     string
+	Source      string
+	Files       []string
+	RewriteJSON bool
+}
+
 type Migrate struct {
 	Global
 	Datadir string
@@ -0,0 +1,275 @@
+package pgrepl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Message is a logical replication message written by the pgoutput plugin.
+type Message interface {
+	messageType() byte
+}
+
+// Begin marks the beginning of a transaction.
+type Begin struct {
+	FinalLSN   LSN // LSN of the commit record
+	CommitTime time.Time
+	XID        uint32
+}
+
+// Commit marks the end of a transaction.
+type Commit struct {
+	CommitLSN  LSN
+	EndLSN     LSN // LSN following the commit record
+	CommitTime time.Time
+}
+
+// Relation describes a table.  It is sent before the first change to the
+// table in a session and after the table definition changes.
+type Relation struct {
+	ID        uint32
+	Namespace string
+	Name      string
+	// ReplicaIdentity is 'd' (default), 'n' (nothing), 'f' (full), or 'i'
+	// (index).
+	ReplicaIdentity byte
+	Columns         []RelationColumn
+}
+
+type RelationColumn struct {
+	Key     bool // Part of the replica identity
+	Name    string
+	TypeOID uint32
+	TypeMod int32
+}
+
+// Insert is a new row.
+type Insert struct {
+	RelationID uint32
+	New        Tuple
+}
+
+// Update is an updated row.  Old is the previous replica identity, if it
+// changed, or the previous row if the replica identity is full; otherwise it
+// is nil.
+type Update struct {
+	RelationID uint32
+	Old        Tuple
+	New        Tuple
+}
+
+// Delete is a deleted row.  Old contains the replica identity, or the whole
+// row if the replica identity is full.
+type Delete struct {
+	RelationID uint32
+	Old        Tuple
+}
+
+// Truncate lists tables that have been truncated.
+type Truncate struct {
+	RelationIDs []uint32
+}
+
+// Other is a message that is not used, such as an origin or type message.
+type Other struct {
+	Type byte
+}
+
+func (*Begin) messageType() byte    { return 'B' }
+func (*Commit) messageType() byte   { return 'C' }
+func (*Relation) messageType() byte { return 'R' }
+func (*Insert) messageType() byte   { return 'I' }
+func (*Update) messageType() byte   { return 'U' }
+func (*Delete) messageType() byte   { return 'D' }
+func (*Truncate) messageType() byte { return 'T' }
+func (m *Other) messageType() byte  { return m.Type }
+
+// Tuple is the data of a row, with one value per column of the relation.
+type Tuple []TupleValue
+
+// TupleValue is a column value in text format.
+type TupleValue struct {
+	// Kind is 'n' for null, 'u' for an unchanged TOASTed value that is not
+	// sent, or 't' for a value in text format.
+	Kind byte
+	Data []byte
+}
+
+// postgresEpoch is the epoch used for timestamps in the replication protocol.
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// pgTime converts a replication protocol timestamp, in microseconds since
+// the PostgreSQL epoch, to a time.
+func pgTime(us int64) time.Time {
+	return postgresEpoch.Add(time.Duration(us) * time.Microsecond)
+}
+
+// ParseMessage decodes a pgoutput message (protocol version 1).
+func ParseMessage(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("pgoutput: empty message")
+	}
+	d := &decoder{data: data[1:]}
+	var m Message
+	switch data[0] {
+	case 'B':
+		m = &Begin{
+			FinalLSN:   LSN(d.uint64()),
+			CommitTime: pgTime(int64(d.uint64())),
+			XID:        d.uint32(),
+		}
+	case 'C':
+		_ = d.uint8() // Flags
+		m = &Commit{
+			CommitLSN:  LSN(d.uint64()),
+			EndLSN:     LSN(d.uint64()),
+			CommitTime: pgTime(int64(d.uint64())),
+		}
+	case 'R':
+		r := &Relation{
+			ID:              d.uint32(),
+			Namespace:       d.string(),
+			Name:            d.string(),
+			ReplicaIdentity: d.uint8(),
+		}
+		n := int(d.uint16())
+		for i := 0; i < n && d.err == nil; i++ {
+			r.Columns = append(r.Columns, RelationColumn{
+				Key:     d.uint8()&1 != 0,
+				Name:    d.string(),
+				TypeOID: d.uint32(),
+				TypeMod: int32(d.uint32()),
+			})
+		}
+		m = r
+	case 'I':
+		ins := &Insert{RelationID: d.uint32()}
+		if t := d.uint8(); t != 'N' && d.err == nil {
+			return nil, fmt.Errorf("pgoutput: insert: unexpected tuple type %q", t)
+		}
+		ins.New = d.tuple()
+		m = ins
+	case 'U':
+		u := &Update{RelationID: d.uint32()}
+		t := d.uint8()
+		if t == 'K' || t == 'O' {
+			u.Old = d.tuple()
+			t = d.uint8()
+		}
+		if t != 'N' && d.err == nil {
+			return nil, fmt.Errorf("pgoutput: update: unexpected tuple type %q", t)
+		}
+		u.New = d.tuple()
+		m = u
+	case 'D':
+		del := &Delete{RelationID: d.uint32()}
+		if t := d.uint8(); t != 'K' && t != 'O' && d.err == nil {
+			return nil, fmt.Errorf("pgoutput: delete: unexpected tuple type %q", t)
+		}
+		del.Old = d.tuple()
+		m = del
+	case 'T':
+		n := int(d.uint32())
+		_ = d.uint8() // Options
+		tr := &Truncate{}
+		for i := 0; i < n && d.err == nil; i++ {
+			tr.RelationIDs = append(tr.RelationIDs, d.uint32())
+		}
+		m = tr
+	default:
+		return &Other{Type: data[0]}, nil
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("pgoutput: message %q: %w", data[0], d.err)
+	}
+	return m, nil
+}
+
+// decoder reads binary fields from a message.  After an error, all reads
+// return zero values, and the error is retained in err.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = fmt.Errorf("unexpected end of message")
+		d.data = nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// string reads a null-terminated string.
+func (d *decoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	for i, c := range d.data {
+		if c == 0 {
+			s := string(d.data[:i])
+			d.data = d.data[i+1:]
+			return s
+		}
+	}
+	d.err = fmt.Errorf("unterminated string")
+	d.data = nil
+	return ""
+}
+
+func (d *decoder) tuple() Tuple {
+	n := int(d.uint16())
+	t := make(Tuple, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		v := TupleValue{Kind: d.uint8()}
+		switch v.Kind {
+		case 'n', 'u':
+		case 't', 'b':
+			size := int(d.uint32())
+			if b := d.next(size); b != nil {
+				v.Data = append([]byte(nil), b...)
+			}
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("unknown tuple value kind %q", v.Kind)
+			}
+		}
+		t = append(t, v)
+	}
+	return t
+}
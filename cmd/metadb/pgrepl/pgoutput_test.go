@@ -0,0 +1,82 @@
+package pgrepl
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestParseLSN(t *testing.T) {
+	l, err := ParseLSN("16/B374D848")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != LSN(0x16B374D848) {
+		t.Errorf("got %x", uint64(l))
+	}
+	if s := l.String(); s != "16/B374D848" {
+		t.Errorf("got %q", s)
+	}
+	if _, err = ParseLSN("16B374D848"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	var rel []byte
+	rel = append(rel, 'R')
+	rel = binary.BigEndian.AppendUint32(rel, 16385)
+	rel = append(rel, "public\x00item\x00"...)
+	rel = append(rel, 'd')
+	rel = binary.BigEndian.AppendUint16(rel, 2)
+	rel = append(rel, 1)
+	rel = append(rel, "id\x00"...)
+	rel = binary.BigEndian.AppendUint32(rel, 23)
+	rel = binary.BigEndian.AppendUint32(rel, 0xffffffff)
+	rel = append(rel, 0)
+	rel = append(rel, "name\x00"...)
+	rel = binary.BigEndian.AppendUint32(rel, 25)
+	rel = binary.BigEndian.AppendUint32(rel, 0xffffffff)
+	m, err := ParseMessage(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRel := &Relation{
+		ID:              16385,
+		Namespace:       "public",
+		Name:            "item",
+		ReplicaIdentity: 'd',
+		Columns: []RelationColumn{
+			{Key: true, Name: "id", TypeOID: 23, TypeMod: -1},
+			{Name: "name", TypeOID: 25, TypeMod: -1},
+		},
+	}
+	if !reflect.DeepEqual(m, wantRel) {
+		t.Errorf("got %+v, want %+v", m, wantRel)
+	}
+
+	var upd []byte
+	upd = append(upd, 'U')
+	upd = binary.BigEndian.AppendUint32(upd, 16385)
+	upd = append(upd, 'N')
+	upd = binary.BigEndian.AppendUint16(upd, 2)
+	upd = append(upd, 't')
+	upd = binary.BigEndian.AppendUint32(upd, 2)
+	upd = append(upd, "42"...)
+	upd = append(upd, 'u')
+	m, err = ParseMessage(upd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUpd := &Update{
+		RelationID: 16385,
+		New:        Tuple{{Kind: 't', Data: []byte("42")}, {Kind: 'u'}},
+	}
+	if !reflect.DeepEqual(m, wantUpd) {
+		t.Errorf("got %+v, want %+v", m, wantUpd)
+	}
+
+	if _, err = ParseMessage(upd[:len(upd)-3]); err == nil {
+		t.Error("expected error for truncated message")
+	}
+}
@@ -0,0 +1,203 @@
+// Package pgrepl reads changes from a PostgreSQL database using logical
+// replication with the pgoutput plugin.
+package pgrepl
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// LSN is a PostgreSQL write-ahead log location.
+type LSN uint64
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// ParseLSN parses an LSN in the form "XXXXXXXX/XXXXXXXX".
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return LSN(h<<32 | l), nil
+}
+
+// Conn is a replication connection.
+type Conn struct {
+	conn *pgconn.PgConn
+}
+
+// Connect opens a replication connection to the database specified by a
+// libpq connection string.
+func Connect(ctx context.Context, connString string) (*Conn, error) {
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	config.RuntimeParams["replication"] = "database"
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn}, nil
+}
+
+func (c *Conn) Close(ctx context.Context) error {
+	return c.conn.Close(ctx)
+}
+
+// Slot is a newly created replication slot.
+type Slot struct {
+	Name string
+	// ConsistentPoint is the LSN from which changes are streamed after the
+	// snapshot.
+	ConsistentPoint LSN
+	// SnapshotName identifies the snapshot exported by the slot.  It can be
+	// used with SET TRANSACTION SNAPSHOT only until another command is run on
+	// the replication connection.
+	SnapshotName string
+}
+
+// CreateSlot creates a logical replication slot that uses the pgoutput
+// plugin, and exports a snapshot of the database as of the slot's consistent
+// point.
+func (c *Conn) CreateSlot(ctx context.Context, name string) (*Slot, error) {
+	sql := "CREATE_REPLICATION_SLOT " + quoteIdent(name) + " LOGICAL pgoutput EXPORT_SNAPSHOT"
+	results, err := c.conn.Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("creating replication slot %q: %w", name, err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) < 3 {
+		return nil, fmt.Errorf("creating replication slot %q: unexpected result", name)
+	}
+	row := results[0].Rows[0]
+	lsn, err := ParseLSN(string(row[1]))
+	if err != nil {
+		return nil, fmt.Errorf("creating replication slot %q: %w", name, err)
+	}
+	return &Slot{Name: string(row[0]), ConsistentPoint: lsn, SnapshotName: string(row[2])}, nil
+}
+
+// StartReplication begins streaming changes from a slot, for the tables in
+// a publication, starting after the LSN start.  If start is 0, streaming
+// begins at the slot's confirmed position.
+func (c *Conn) StartReplication(ctx context.Context, slot, publication string, start LSN) error {
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names %s)",
+		quoteIdent(slot), start, quoteLiteral(quoteIdent(publication)))
+	c.conn.Frontend().Send(&pgproto3.Query{String: sql})
+	if err := c.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("starting replication: %w", err)
+	}
+	for {
+		msg, err := c.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("starting replication: %w", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("starting replication: %w", pgconn.ErrorResponseToPgError(msg))
+		case *pgproto3.NoticeResponse:
+		default:
+			return fmt.Errorf("starting replication: unexpected message %T", msg)
+		}
+	}
+}
+
+// XLogData is a chunk of write-ahead log data, which contains a pgoutput
+// message.
+type XLogData struct {
+	WALStart LSN
+	WALEnd   LSN
+	Data     []byte
+}
+
+// Keepalive is sent by the server periodically.  If ReplyRequested is set,
+// the client should send a status update immediately.
+type Keepalive struct {
+	WALEnd         LSN
+	ReplyRequested bool
+}
+
+// Receive waits for the next message from the server, which is either
+// *XLogData or *Keepalive.  If no message is received before the context is
+// done, nil is returned with an error for which pgconn.Timeout returns true.
+func (c *Conn) Receive(ctx context.Context) (any, error) {
+	for {
+		msg, err := c.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if len(msg.Data) == 0 {
+				continue
+			}
+			switch msg.Data[0] {
+			case 'w':
+				if len(msg.Data) < 25 {
+					return nil, fmt.Errorf("replication: invalid XLogData message")
+				}
+				return &XLogData{
+					WALStart: LSN(binary.BigEndian.Uint64(msg.Data[1:])),
+					WALEnd:   LSN(binary.BigEndian.Uint64(msg.Data[9:])),
+					Data:     append([]byte(nil), msg.Data[25:]...),
+				}, nil
+			case 'k':
+				if len(msg.Data) < 18 {
+					return nil, fmt.Errorf("replication: invalid keepalive message")
+				}
+				return &Keepalive{
+					WALEnd:         LSN(binary.BigEndian.Uint64(msg.Data[1:])),
+					ReplyRequested: msg.Data[17] != 0,
+				}, nil
+			}
+		case *pgproto3.ErrorResponse:
+			return nil, fmt.Errorf("replication: %w", pgconn.ErrorResponseToPgError(msg))
+		case *pgproto3.CopyDone:
+			return nil, fmt.Errorf("replication: stream ended by server")
+		}
+	}
+}
+
+// SendStatus reports to the server that changes up to the LSN flushed have
+// been written, so that the server can discard write-ahead log that is no
+// longer needed by the slot.
+func (c *Conn) SendStatus(flushed LSN) error {
+	data := make([]byte, 34)
+	data[0] = 'r'
+	binary.BigEndian.PutUint64(data[1:], uint64(flushed))  // Written
+	binary.BigEndian.PutUint64(data[9:], uint64(flushed))  // Flushed
+	binary.BigEndian.PutUint64(data[17:], uint64(flushed)) // Applied
+	binary.BigEndian.PutUint64(data[25:], uint64(time.Since(postgresEpoch).Microseconds()))
+	c.conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	if err := c.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("sending replication status: %w", err)
+	}
+	return nil
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"time"
+)
+
+const (
+	retryInitialDelay = 5 * time.Second
+	retryMaxDelay     = 10 * time.Minute
+	retryFatalDelay   = 24 * time.Hour
+)
+
+// backoff computes exponentially increasing delays between attempts to
+// restart a stream, up to retryMaxDelay.
+type backoff struct {
+	delay time.Duration
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	if b.delay == 0 {
+		b.delay = retryInitialDelay
+	} else {
+		b.delay = min(b.delay*2, retryMaxDelay)
+	}
+	return b.delay
+}
+
+// reset restores the initial delay.
+func (b *backoff) reset() {
+	b.delay = 0
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	var b backoff
+	want := []time.Duration{
+		5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second,
+		160 * time.Second, 320 * time.Second, retryMaxDelay, retryMaxDelay, retryMaxDelay,
+	}
+	for i, w := range want {
+		if got := b.next(); got != w {
+			t.Errorf("attempt %d: got %v; want %v", i+1, got, w)
+		}
+	}
+	b.reset()
+	if got := b.next(); got != retryInitialDelay {
+		t.Errorf("after reset: got %v; want %v", got, retryInitialDelay)
+	}
+	if got := b.next(); got != 2*retryInitialDelay {
+		t.Errorf("after reset, second attempt: got %v; want %v", got, 2*retryInitialDelay)
+	}
+}
@@ -3,53 +3,98 @@ package server
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
 )
 
+// execbuffer buffers the writes of a command graph, all of which are made in
+// the transaction tx.
 type execbuffer struct {
-	ctx context.Context
-	dp  *pgxpool.Pool
+	ctx    context.Context
+	tx     *catalog.Tx
+	source string
 	// syncIDs is a map of buffered IDs ready for COPY to sync tables.
 	syncIDs map[dbx.Table][][]any
-	// mergeData is a slice of buffered update-insert SQL statement pairs.
-	mergeData map[dbx.Table][][]string
+	// mergeData is a slice of buffered merge SQL statements, each of which
+	// returns the __id of the inserted row.
+	mergeData map[dbx.Table][]string
 	syncMode  dsync.Mode
+	// offsets contains the Kafka offsets to be stored when the transaction
+	// is committed, and group is the consumer group they belong to.
+	offsets map[catalog.TopicPartition]int64
+	group   string
+	// slot is the replication slot of a PostgreSQL data source, if the
+	// transaction writes the last rows of its initial snapshot.
+	slot string
+	// auditColumns is set if the columns __op and __source_position
+	// are to be added to tables.
+	auditColumns bool
 }
 
 func (e *execbuffer) queueSyncID(table *dbx.Table, id int64) {
 	e.syncIDs[*table] = append(e.syncIDs[*table], []any{id})
 }
 
-func (e *execbuffer) queueMergeData(table *dbx.Table, update, insert *string) {
-	e.mergeData[*table] = append(e.mergeData[*table], []string{*update, *insert})
+func (e *execbuffer) queueMergeData(table *dbx.Table, merge *string) {
+	e.mergeData[*table] = append(e.mergeData[*table], *merge)
 }
 
-func (e *execbuffer) flush() error {
-	tx, err := e.dp.Begin(e.ctx)
-	if err != nil {
-		return fmt.Errorf("flush: begin txn: %w", err)
+// hasMergeData returns true if merges into any of the tables are buffered.
+func (e *execbuffer) hasMergeData(tables []dbx.Table) bool {
+	for _, t := range tables {
+		if len(e.mergeData[t]) != 0 {
+			return true
+		}
 	}
-	defer tx.Rollback(e.ctx)
+	return false
+}
+
+// flush writes the buffered data in the transaction.  The writes are not
+// committed until commit is called.
+func (e *execbuffer) flush() error {
+	defer metrics.FlushDuration.ObserveDuration(time.Now(), e.source)
 	// Flush merge data.
 	log.Trace("FLUSH merge data")
-	if err = e.flushMergeData(tx); err != nil {
+	if err := e.flushMergeData(e.tx); err != nil {
 		return fmt.Errorf("flushing exec buffer: writing merge data: %w", err)
 	}
 	// Flush sync IDs.
 	log.Trace("FLUSH sync IDs")
-	if err = e.flushSyncIDs(tx); err != nil {
+	if err := e.flushSyncIDs(e.tx); err != nil {
 		return fmt.Errorf("flushing exec buffer: writing to sync tables: %w", err)
 	}
+	return nil
+}
+
+// commit flushes the buffered data, writes the Kafka offsets or snapshot
+// status, and commits the transaction.
+func (e *execbuffer) commit() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	if len(e.offsets) != 0 {
+		log.Trace("FLUSH offsets")
+		if err := catalog.WriteKafkaOffsets(e.ctx, e.tx, e.source, e.group, e.offsets); err != nil {
+			return fmt.Errorf("flushing exec buffer: %w", err)
+		}
+	}
+	if e.slot != "" {
+		log.Trace("FLUSH snapshot complete")
+		if err := catalog.WriteSnapshotComplete(e.ctx, e.tx, e.source, e.slot); err != nil {
+			return fmt.Errorf("flushing exec buffer: %w", err)
+		}
+	}
 	log.Trace("FLUSH commit")
-	if err = tx.Commit(e.ctx); err != nil {
+	if err := e.tx.Commit(e.ctx); err != nil {
 		return fmt.Errorf("flushing exec buffer: commit: %w", err)
 	}
+	e.offsets = nil
 	return nil
 }
 
@@ -84,16 +129,13 @@ func (e *execbuffer) flushMergeData(tx pgx.Tx) error {
 				ids[j] = []any{0}
 			}
 			for k := i; k < batchEndIndex; k++ {
-				// Queue UPDATE.
-				batch.Queue(a[k][0])
-				// Queue INSERT.
 				p := &(ids[k-i][0])
-				batch.Queue(a[k][1]).QueryRow(func(row pgx.Row) error {
+				batch.Queue(a[k]).QueryRow(func(row pgx.Row) error {
 					return row.Scan(p)
 				})
 			}
 			if err := tx.SendBatch(e.ctx, &batch).Close(); err != nil {
-				return fmt.Errorf("update and insert: %w", err)
+				return fmt.Errorf("merge: %w", err)
 			}
 			// If resync mode, flush IDs to sync table.
 			if e.syncMode == dsync.Resync {
@@ -112,6 +154,6 @@ func (e *execbuffer) flushMergeData(tx pgx.Tx) error {
 			}
 		}
 	}
-	e.mergeData = make(map[dbx.Table][][]string) // Clear buffers.
+	e.mergeData = make(map[dbx.Table][]string) // Clear buffers.
 	return nil
 }
@@ -25,7 +25,7 @@ func addPartition(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command)
 		return fmt.Errorf("adding partition for table %q year %q: %v", cmd.SchemaName+"."+cmd.TableName,
 			yearStr, err)
 	}
-	if err = cat.AddPartYear(cmd.SchemaName, cmd.TableName, year); err != nil {
+	if err = cat.AddPartYear(ebuf.tx, cmd.SchemaName, cmd.TableName, year); err != nil {
 		return fmt.Errorf("adding partition for table %q year %q: %v", cmd.SchemaName+"."+cmd.TableName,
 			yearStr, err)
 	}
@@ -174,19 +174,19 @@ func alterColumnToVarchar(table *sqlx.Table, column string, typesize int64, db s
 */
 
 // Change column type to a specified new type, optionally casting data to the new type
-func alterColumnType(dq dbx.Queryable, cat *catalog.Catalog, table *dbx.Table, column string, datatype command.DataType, typesize int64, cast bool) error {
+func alterColumnType(tx *catalog.Tx, cat *catalog.Catalog, table *dbx.Table, column string, datatype command.DataType, typesize int64, cast bool) error {
 	sqltype := command.DataTypeToSQL(datatype, typesize)
 	var caststr string
 	if cast {
 		caststr = " USING \"" + column + "\"::" + sqltype
 	}
 	var q = "ALTER TABLE %s ALTER COLUMN \"" + column + "\" TYPE " + sqltype + caststr
-	if _, err := dq.Exec(context.TODO(), fmt.Sprintf(q, table.MainSQL())); err != nil {
+	if _, err := tx.Exec(context.TODO(), fmt.Sprintf(q, table.MainSQL())); err != nil {
 		return fmt.Errorf("changing type of column %q in table %q to %q: alter column: %v",
 			column, table, sqltype, err)
 	}
 	// Update schema.
-	cat.UpdateColumn(&dbx.Column{Schema: table.Schema, Table: table.Table, Column: column}, sqltype)
+	cat.UpdateColumn(tx, &dbx.Column{Schema: table.Schema, Table: table.Table, Column: column}, sqltype)
 	return nil
 }
 
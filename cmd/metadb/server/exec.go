@@ -7,25 +7,38 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/internal/uuid"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
 )
 
-func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, syncMode dsync.Mode, dedup *log.MessageSet) error {
-	if cmdgraph.Commands.Len() == 0 {
+// execCommandGraph executes the commands in cmdgraph in a single transaction,
+// including any schema changes.  The Kafka offsets, if any, are stored in the
+// same transaction, and if slot is not empty, the initial snapshot read from
+// the replication slot is recorded as complete.
+func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, source, group string, offsets map[catalog.TopicPartition]int64, slot string, auditColumns bool, syncMode dsync.Mode, dedup *log.MessageSet) error {
+	if cmdgraph.Commands.Len() == 0 && len(offsets) == 0 && slot == "" {
 		return nil
 	}
+	tx, err := cat.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("exec command list: begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 	ebuf := &execbuffer{
-		ctx:       ctx,
-		dp:        dp,
-		syncIDs:   make(map[dbx.Table][][]any),
-		mergeData: make(map[dbx.Table][][]string),
-		syncMode:  syncMode,
+		ctx:          ctx,
+		tx:           tx,
+		source:       source,
+		syncIDs:      make(map[dbx.Table][][]any),
+		mergeData:    make(map[dbx.Table][]string),
+		syncMode:     syncMode,
+		group:        group,
+		slot:         slot,
+		auditColumns: auditColumns,
 	}
 	txnTime := time.Now()
 	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
@@ -54,7 +67,7 @@ func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmd
 					if err = execDeltaSchema(ebuf, cat, tcmd, delta, table); err != nil {
 						return fmt.Errorf("schema: %w", err)
 					}
-					m, id, err := isCurrentIdenticalMatch(ebuf.ctx, tcmd, ebuf.dp, table)
+					m, id, err := isCurrentIdenticalMatch(ebuf.ctx, tcmd, ebuf.tx, table)
 					if err != nil {
 						return fmt.Errorf("matcher: %w", err)
 					}
@@ -71,9 +84,13 @@ func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmd
 			}
 		}
 	}
-	if err := ebuf.flush(); err != nil {
+	ebuf.offsets = offsets
+	if err := ebuf.commit(); err != nil {
 		return fmt.Errorf("exec command list: %w", err)
 	}
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		metrics.CommandsExecuted.Inc(source, e.Value.(*command.Command).Op.String())
+	}
 	log.Trace("=================================================================")
 	log.Trace("exec: %d records %s", cmdgraph.Commands.Len(), fmt.Sprintf("[%.4f s]", time.Since(txnTime).Seconds()))
 	log.Trace("=================================================================")
@@ -81,6 +98,13 @@ func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmd
 }
 
 func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+	// If the key values of an updated row have changed, the previous
+	// version of the row is deleted.
+	if cmd.Replaces != nil {
+		if err := execDeleteData(ebuf, cat, cmd.Replaces, "update"); err != nil {
+			return false, fmt.Errorf("delete: %w", err)
+		}
+	}
 	// Make schema changes if needed by the command.
 	if cmd.Op == command.MergeOp {
 		table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
@@ -94,13 +118,20 @@ func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, s
 		if err = addPartition(ebuf, cat, cmd); err != nil {
 			return false, fmt.Errorf("schema: %w", err)
 		}
+		if ebuf.auditColumns && !cat.AuditColumns(table) {
+			if err = cat.AddAuditColumns(ebuf.tx, table); err != nil {
+				return false, fmt.Errorf("schema: %w", err)
+			}
+		}
 		// Note that execDeltaSchema() may adjust data types in cmd.
 		if err = execDeltaSchema(ebuf, cat, cmd, delta, table); err != nil {
 			return false, fmt.Errorf("schema: %w", err)
 		}
-		// Ensure indexes are created on primary key columns.
+		// Ensure indexes are created on primary key columns.  If rows
+		// are identified by all of their columns, only columns having
+		// types of limited size are indexed.
 		for _, col := range cmd.Column {
-			if col.PrimaryKey != 0 {
+			if col.PrimaryKey != 0 && (!cmd.FullRowKey || isFixedSizeType(col.DType)) {
 				column := &dbx.Column{Schema: table.Schema, Table: table.Table, Column: col.Name}
 				if cat.IndexExists(column) {
 					continue
@@ -108,7 +139,7 @@ func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, s
 				if err = ebuf.flush(); err != nil {
 					return false, fmt.Errorf("creating indexes: %w", err)
 				}
-				if err = cat.AddIndex(column); err != nil {
+				if err = cat.AddIndex(ebuf.tx, column); err != nil {
 					return false, err
 				}
 			}
@@ -144,7 +175,7 @@ func addTable(ebuf *execbuffer, cmd *command.Command, cat *catalog.Catalog, tabl
 		return fmt.Errorf("creating table %q : %v", table, err)
 	}
 	parentTable := dbx.Table{Schema: cmd.ParentTable.Schema, Table: cmd.ParentTable.Table}
-	err := cat.CreateNewTable(table, cmd.Transformed, &parentTable, source)
+	err := cat.CreateNewTable(ebuf.tx, table, cmd.Transformed, &parentTable, source)
 	if err != nil {
 		return fmt.Errorf("creating table %q: %v", table, err)
 	}
@@ -163,7 +194,7 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("delta schema: adding column %q in table %q: %v", col.name, table, err)
 			}
-			if err := cat.AddColumn(table, col.name, col.newType, col.newTypeSize); err != nil {
+			if err := cat.AddColumn(ebuf.tx, table, col.name, col.newType, col.newTypeSize); err != nil {
 				return fmt.Errorf("delta schema: adding column %q in table %q: %v", col.name, table, err)
 			}
 			continue
@@ -217,7 +248,7 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.IntegerType, err)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.IntegerType, col.newTypeSize, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.IntegerType, col.newTypeSize, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.IntegerType, err)
 			}
 			continue
@@ -229,19 +260,31 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("altering column %q (%q) type to %v: %v", table, col.name, command.FloatType, err)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.FloatType, col.newTypeSize, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.FloatType, col.newTypeSize, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.FloatType, err)
 			}
 			continue
 		}
 
+		// If both the old and new types are arrays of integers, change the column type
+		// to handle the larger element size.
+		if col.oldType == command.IntegerArrayType && col.newType == command.IntegerArrayType {
+			if err := ebuf.flush(); err != nil {
+				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.IntegerArrayType, err)
+			}
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.IntegerArrayType, col.newTypeSize, false); err != nil {
+				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.IntegerArrayType, err)
+			}
+			continue
+		}
+
 		// If this is a change from an integer to float type, the column type can be
 		// changed using a cast.
 		if col.oldType == command.IntegerType && col.newType == command.FloatType {
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("altering column %q (%q) type to %v: %v", table, col.name, command.FloatType, err)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.FloatType, col.newTypeSize, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.FloatType, col.newTypeSize, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.FloatType, err)
 			}
 			continue
@@ -253,7 +296,7 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("altering column %q (%q) type to %v: %v", table, col.name, command.NumericType, err)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.NumericType, 0, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.NumericType, 0, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.NumericType, err)
 			}
 			continue
@@ -265,7 +308,7 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := ebuf.flush(); err != nil {
 				return fmt.Errorf("altering column %q (%q) type to %v: %v", table, col.name, command.NumericType, err)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.NumericType, 0, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.NumericType, 0, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.NumericType, err)
 			}
 			continue
@@ -285,7 +328,7 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			for _, d := range delta.column {
 				log.Trace("COLUMN: %#v", d)
 			}
-			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.TextType, 0, false); err != nil {
+			if err := alterColumnType(ebuf.tx, cat, table, col.name, command.TextType, 0, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.TextType, err)
 			}
 		}
@@ -296,13 +339,14 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
 	switch cmd.Op {
 	case command.MergeOp:
-		match, err := execMergeData(ebuf, cmd, syncMode, dedup)
+		audit := cat.AuditColumns(&dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName})
+		match, err := execMergeData(ebuf, cmd, audit, syncMode, dedup)
 		if err != nil {
 			return false, fmt.Errorf("merge: %w", err)
 		}
 		return match, nil
 	case command.DeleteOp:
-		if err := execDeleteData(ebuf, cat, cmd); err != nil {
+		if err := execDeleteData(ebuf, cat, cmd, "delete"); err != nil {
 			return false, fmt.Errorf("delete: %w", err)
 		}
 		return false, nil
@@ -316,12 +360,16 @@ func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 	}
 }
 
-// execMergeData executes a merge command in the database.
-func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+// execMergeData executes a merge command in the database.  If audit is set,
+// the table has the columns __op and __source_position.  These describe only
+// how a row was ended, and so they are set for the row being ended but not
+// for the new row, unless it is inserted into the history before a later
+// row.
+func execMergeData(ebuf *execbuffer, cmd *command.Command, audit bool, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
 	table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
 	// Check if the current record (if any) is identical to the new one.  If so, we
 	// can avoid making any changes in the database.
-	match, id, err := isCurrentIdenticalMatch(ebuf.ctx, cmd, ebuf.dp, table)
+	match, id, err := isCurrentIdenticalMatch(ebuf.ctx, cmd, ebuf.tx, table)
 	if err != nil {
 		return false, fmt.Errorf("matcher: %w", err)
 	}
@@ -363,7 +411,7 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 		b.WriteString(primaryKeyFilter)
 		b.WriteString(" LIMIT 1")
 		var rows pgx.Rows
-		rows, err = ebuf.dp.Query(context.TODO(), b.String())
+		rows, err = ebuf.tx.Query(ebuf.ctx, b.String())
 		if err != nil {
 			return false, fmt.Errorf("querying for unavailable data: %w", err)
 		}
@@ -385,6 +433,10 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 			return false, fmt.Errorf("reading matching current row: %w", err)
 		}
 		rows.Close()
+		if !found && cmd.RequireCurrent {
+			log.Trace("row filter not satisfied by previous row in table %q", table)
+			return true, nil
+		}
 		if !found {
 			msg := fmt.Sprintf("no current value for unavailable data in table %q", table)
 			if dedup.Insert(msg) {
@@ -406,30 +458,67 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 			}
 		}
 	}
-	// Set the current row, if any, to __current=FALSE.
+	// The new row is inserted into the history at the time of the change.
+	// Normally the change is later than the start of the current row, which
+	// is ended, and the new row becomes the current row.  Only if there is
+	// no such current row, for example because change events have arrived
+	// out of order, is the rest of the history searched: the row that was
+	// valid at the time of the change, if any, is ended, and the new row
+	// takes its place until it would have ended, or until the next row
+	// starts.  If no row follows, the new row becomes the current row.
+	mainTable := "\"" + table.Schema + "\".\"" + table.Table + "__\""
+	keyFilter := " WHERE __origin='" + cmd.Origin + "'" + primaryKeyFilter
+	validFilter := keyFilter + " AND __start<='" + cmd.SourceTimestamp + "' AND __end>'" + cmd.SourceTimestamp + "'" +
+		" AND NOT EXISTS (SELECT FROM c)"
 	var b strings.Builder
-	b.WriteString("UPDATE \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\" SET __end='")
+	b.WriteString("WITH c AS (UPDATE ")
+	b.WriteString(mainTable)
+	b.WriteString(" SET __end='")
 	b.WriteString(cmd.SourceTimestamp)
 	b.WriteString("',__current='f'")
-	b.WriteString(" WHERE __current AND __origin='")
-	b.WriteString(cmd.Origin)
-	b.WriteByte('\'')
-	b.WriteString(primaryKeyFilter)
-	update := b.String()
-	// Insert the new row.
-	b.Reset()
-	b.WriteString("INSERT INTO \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\"(__start,__end,__current")
+	if audit {
+		b.WriteString(auditSQL("update", cmd.SourcePosition))
+	}
+	b.WriteString(keyFilter)
+	b.WriteString(" AND __current AND __start<='")
+	b.WriteString(cmd.SourceTimestamp)
+	// If the table records how rows were ended, the new row also takes
+	// the place of the ended row in that respect.
+	b.WriteString("' RETURNING 1),v AS (SELECT __end e")
+	if audit {
+		b.WriteString(",__op o,__source_position p")
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(mainTable)
+	b.WriteString(validFilter)
+	b.WriteString(" ORDER BY __end DESC LIMIT 1),u AS (UPDATE ")
+	b.WriteString(mainTable)
+	b.WriteString(" SET __end='")
+	b.WriteString(cmd.SourceTimestamp)
+	b.WriteString("',__current='f'")
+	if audit {
+		b.WriteString(auditSQL("update", cmd.SourcePosition))
+	}
+	b.WriteString(validFilter)
+	b.WriteString("),n AS (SELECT CASE WHEN EXISTS (SELECT FROM c) THEN '9999-12-31 00:00:00Z'::timestamptz " +
+		"ELSE coalesce((SELECT e FROM v),(SELECT min(__start) FROM ")
+	b.WriteString(mainTable)
+	b.WriteString(keyFilter)
+	b.WriteString(" AND __start>'")
+	b.WriteString(cmd.SourceTimestamp)
+	b.WriteString("'),'9999-12-31 00:00:00Z'::timestamptz) END e")
+	if audit {
+		b.WriteString(",EXISTS (SELECT FROM v) f,(SELECT o FROM v) o,(SELECT p FROM v) p")
+	}
+	b.WriteString(")INSERT INTO ")
+	b.WriteString(mainTable)
+	b.WriteString("(__start,__end,__current")
 	if cmd.Origin != "" {
 		b.WriteString(",__origin")
 	}
+	if audit {
+		b.WriteString(",__op,__source_position")
+	}
 	for i := range columns {
 		b.WriteString(",\"")
 		b.WriteString(columns[i].Name)
@@ -437,24 +526,29 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 	}
 	b.WriteString(")VALUES('")
 	b.WriteString(cmd.SourceTimestamp)
-	b.WriteString("','9999-12-31 00:00:00Z','t'")
+	b.WriteString("',(SELECT e FROM n),(SELECT e='9999-12-31 00:00:00Z' FROM n)")
 	if cmd.Origin != "" {
 		b.WriteString(",'")
 		b.WriteString(cmd.Origin)
 		b.WriteByte('\'')
 	}
+	if audit {
+		// A row that is followed by a later row was ended by an update.
+		b.WriteString(",(SELECT CASE WHEN f THEN o WHEN e<>'9999-12-31 00:00:00Z' THEN 'update' END FROM n)," +
+			"(SELECT p FROM n)")
+	}
 	for i := range columns {
 		b.WriteString(",")
 		encodeSQLData(&b, columns[i].SQLData, columns[i].DType)
 	}
 	b.WriteString(") RETURNING __id")
-	insert := b.String()
-	ebuf.queueMergeData(table, &update, &insert)
+	merge := b.String()
+	ebuf.queueMergeData(table, &merge)
 	return false, nil
 }
 
 // isCurrentIdentical looks for an identical row in the current table.
-func isCurrentIdenticalMatch(ctx context.Context, cmd *command.Command, tx *pgxpool.Pool, table *dbx.Table) (bool, int64, error) {
+func isCurrentIdenticalMatch(ctx context.Context, cmd *command.Command, dq dbx.Queryable, table *dbx.Table) (bool, int64, error) {
 	// Match on all columns, except "unavailable" columns (which indicates a column
 	// did not change and we can assume it matches).
 	var b strings.Builder
@@ -465,6 +559,10 @@ func isCurrentIdenticalMatch(ctx context.Context, cmd *command.Command, tx *pgxp
 	b.WriteString("\" WHERE __origin='")
 	b.WriteString(cmd.Origin)
 	b.WriteByte('\'')
+	// A change that is older than the current record does not match it.
+	b.WriteString(" AND __start<='")
+	b.WriteString(cmd.SourceTimestamp)
+	b.WriteByte('\'')
 	columns := cmd.Column
 	for i := range columns {
 		if columns[i].Unavailable {
@@ -480,7 +578,7 @@ func isCurrentIdenticalMatch(ctx context.Context, cmd *command.Command, tx *pgxp
 		}
 	}
 	b.WriteString(" LIMIT 1")
-	rows, err := tx.Query(ctx, b.String())
+	rows, err := dq.Query(ctx, b.String())
 	if err != nil {
 		return false, 0, fmt.Errorf("querying for matching current row: %w", err)
 	}
@@ -546,33 +644,85 @@ func buildColumnMap(columns []command.CommandColumn) map[string]*command.Command
 	return m
 }
 
-func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command) error {
+// execDeleteData ends the rows matching the key of a delete command.  The
+// operation op is recorded in tables that have the column __op.
+func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, op string) error {
+	// If the table has not been created, there are no rows to delete.  This
+	// is usual for deletes generated by row filters.
+	tables := descendantTables(cat, cmd)
+	if len(tables) == 0 {
+		return nil
+	}
 	// Flush buffer before deletion, to prevent a previous merge with the same tuple
-	// ID from being applied later.
-	if err := ebuf.flush(); err != nil {
-		return fmt.Errorf("exec delete data: %w", err)
+	// ID from being applied later.  The buffer is not flushed if it has no
+	// merges into the tables, so that consecutive deletes do not split
+	// batches of merges into other tables.
+	if ebuf.hasMergeData(tables) {
+		if err := ebuf.flush(); err != nil {
+			return fmt.Errorf("exec delete data: %w", err)
+		}
 	}
 	primaryKeyFilter := wherePKDataEqualSQL(cmd.Column)
-	// Find matching current records in table and descendants, and mark as not current.
+	// Find records in table and descendants that were valid at the time of
+	// the deletion, and end them.  Normally this is the current record, but
+	// if the deletion has arrived out of order, it is an earlier one.
 	batch := pgx.Batch{}
+	for _, table := range tables {
+		var audit string
+		if cat.AuditColumns(&table) {
+			audit = auditSQL(op, cmd.SourcePosition)
+		}
+		batch.Queue("UPDATE " + table.MainSQL() +
+			" SET __end='" + cmd.SourceTimestamp + "',__current=FALSE" + audit + " WHERE __origin='" + cmd.Origin + "'" +
+			" AND __start<='" + cmd.SourceTimestamp + "' AND __end>'" + cmd.SourceTimestamp + "'" +
+			primaryKeyFilter)
+	}
+	if err := ebuf.tx.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
+		return fmt.Errorf("exec delete data: %w", err)
+	}
+	return nil
+}
+
+// descendantTables returns the table of a command and its transformed
+// tables.
+func descendantTables(cat *catalog.Catalog, cmd *command.Command) []dbx.Table {
+	var tables []dbx.Table
 	cat.TraverseDescendantTables(dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
 		func(table dbx.Table) {
-			batch.Queue("UPDATE " + table.MainSQL() +
-				" SET __end='" + cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" +
-				cmd.Origin + "'" + primaryKeyFilter)
+			tables = append(tables, table)
 		})
-	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
-		return fmt.Errorf("exec delete data: %w", err)
+	return tables
+}
+
+// auditSQL returns assignments to the columns __op and __source_position,
+// which record the operation that ended a row and its position in the
+// source.
+func auditSQL(op string, pos command.Position) string {
+	var b strings.Builder
+	b.WriteString(",__op='")
+	b.WriteString(op)
+	b.WriteString("',__source_position=")
+	if p := pos.String(); p != "" {
+		dbx.EncodeString(&b, p)
+	} else {
+		b.WriteString("NULL")
 	}
-	return nil
+	return b.String()
 }
 
+// wherePKDataEqualSQL returns a filter that matches the key values of a row.
+// A null key value, which is possible if the key is not a primary key in the
+// source database, matches null.  Unavailable values are not compared.
 func wherePKDataEqualSQL(columns []command.CommandColumn) string {
 	var b strings.Builder
 	for _, c := range columns {
-		if c.PrimaryKey != 0 {
+		if c.PrimaryKey != 0 && !c.Unavailable {
 			b.WriteString(" AND")
-			if c.DType == command.JSONType {
+			if c.SQLData == nil {
+				b.WriteString(" \"")
+				b.WriteString(c.Name)
+				b.WriteString("\" IS NULL")
+			} else if c.DType == command.JSONType {
 				b.WriteString(" \"")
 				b.WriteString(c.Name)
 				b.WriteString("\"::text=")
@@ -589,15 +739,31 @@ func wherePKDataEqualSQL(columns []command.CommandColumn) string {
 	return b.String()
 }
 
+// isFixedSizeType returns true if values of a data type have a limited size,
+// so that they can be indexed.
+func isFixedSizeType(dtype command.DataType) bool {
+	switch dtype {
+	case command.BooleanType, command.DateType, command.FloatType, command.IntegerType, command.NumericType,
+		command.TimeType, command.TimestampType, command.TimestamptzType, command.TimetzType, command.UUIDType,
+		command.IntervalType:
+		return true
+	default:
+		return false
+	}
+}
+
 func encodeSQLData(b *strings.Builder, sqldata *string, datatype command.DataType) {
 	if sqldata == nil {
 		b.WriteString("NULL")
 		return
 	}
 	switch datatype {
-	case command.TextType, command.JSONType:
+	case command.TextType, command.JSONType, command.ByteaType,
+		command.BooleanArrayType, command.IntegerArrayType, command.FloatArrayType, command.NumericArrayType,
+		command.TextArrayType, command.UUIDArrayType:
 		dbx.EncodeString(b, *sqldata)
-	case command.UUIDType, command.DateType, command.TimeType, command.TimetzType, command.TimestampType, command.TimestamptzType:
+	case command.UUIDType, command.DateType, command.TimeType, command.TimetzType, command.TimestampType, command.TimestamptzType,
+		command.IntervalType:
 		b.WriteByte('\'')
 		b.WriteString(*sqldata)
 		b.WriteByte('\'')
@@ -617,12 +783,15 @@ func execTruncateData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comma
 	}
 	// Find all current records in table and descendants, and mark as not current.
 	batch := pgx.Batch{}
-	cat.TraverseDescendantTables(dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
-		func(table dbx.Table) {
-			batch.Queue("UPDATE " + table.MainSQL() + " SET __end='" +
-				cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" + cmd.Origin + "'")
-		})
-	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
+	for _, table := range descendantTables(cat, cmd) {
+		var audit string
+		if cat.AuditColumns(&table) {
+			audit = auditSQL("truncate", cmd.SourcePosition)
+		}
+		batch.Queue("UPDATE " + table.MainSQL() + " SET __end='" +
+			cmd.SourceTimestamp + "',__current=FALSE" + audit + " WHERE __current AND __origin='" + cmd.Origin + "'")
+	}
+	if err := ebuf.tx.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
 		return fmt.Errorf("exec truncate data: %w", err)
 	}
 	return nil
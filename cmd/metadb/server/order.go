@@ -0,0 +1,123 @@
+package server
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// streamOrder keeps database writes in order when a source is read by
+// concurrent consumers.  Commands for a table are executed by only one
+// consumer at a time.  In addition, the offset of the last command written
+// is recorded for each table and Kafka partition, so that change events that
+// are read again after a partition has been reassigned to another consumer
+// are not written a second time, possibly out of order.
+type streamOrder struct {
+	mu      sync.Mutex
+	tables  map[dbx.Table]*sync.Mutex
+	written map[writtenKey]int64
+}
+
+type writtenKey struct {
+	table     dbx.Table
+	topic     string
+	partition int32
+}
+
+func newStreamOrder() *streamOrder {
+	return &streamOrder{
+		tables:  make(map[dbx.Table]*sync.Mutex),
+		written: make(map[writtenKey]int64),
+	}
+}
+
+// lock acquires the locks of all tables written by commands in cmdgraph.
+// The locks are acquired in a fixed order to prevent deadlock.  The returned
+// function releases the locks.
+func (o *streamOrder) lock(cmdgraph *command.CommandGraph) func() {
+	tables := commandTables(cmdgraph)
+	mutexes := make([]*sync.Mutex, len(tables))
+	o.mu.Lock()
+	for i, t := range tables {
+		m, ok := o.tables[t]
+		if !ok {
+			m = new(sync.Mutex)
+			o.tables[t] = m
+		}
+		mutexes[i] = m
+	}
+	o.mu.Unlock()
+	for _, m := range mutexes {
+		m.Lock()
+	}
+	return func() {
+		for i := len(mutexes) - 1; i >= 0; i-- {
+			mutexes[i].Unlock()
+		}
+	}
+}
+
+// removeWritten removes commands that have already been written from
+// cmdgraph.  The caller must hold the locks of the tables.
+func (o *streamOrder) removeWritten(cmdgraph *command.CommandGraph) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	removed := 0
+	var next *list.Element
+	for e := cmdgraph.Commands.Front(); e != nil; e = next {
+		next = e.Next()
+		cmd := e.Value.(*command.Command)
+		offset, ok := o.written[newWrittenKey(cmd)]
+		if ok && cmd.SourcePosition.Offset <= offset {
+			cmdgraph.Commands.Remove(e)
+			removed++
+		}
+	}
+	return removed
+}
+
+// setWritten records the offsets of commands in cmdgraph after they have been
+// written.  The caller must hold the locks of the tables.
+func (o *streamOrder) setWritten(cmdgraph *command.CommandGraph) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		k := newWrittenKey(cmd)
+		if offset, ok := o.written[k]; !ok || cmd.SourcePosition.Offset > offset {
+			o.written[k] = cmd.SourcePosition.Offset
+		}
+	}
+}
+
+func newWrittenKey(cmd *command.Command) writtenKey {
+	return writtenKey{
+		table:     dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
+		topic:     cmd.SourcePosition.Topic,
+		partition: cmd.SourcePosition.Partition,
+	}
+}
+
+// commandTables returns the tables written by commands in cmdgraph, sorted by
+// schema and table name.
+func commandTables(cmdgraph *command.CommandGraph) []dbx.Table {
+	m := make(map[dbx.Table]struct{})
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		m[dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}] = struct{}{}
+	}
+	tables := make([]dbx.Table, 0, len(m))
+	for t := range m {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Schema != tables[j].Schema {
+			return tables[i].Schema < tables[j].Schema
+		}
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
+}
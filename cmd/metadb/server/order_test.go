@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+)
+
+// orderEvent is a change event in partition p at offset n, for table t.
+type orderEvent struct {
+	p int32
+	n int64
+	t string
+}
+
+// orderStore simulates the database: the change events written, and the
+// stored offsets, which are not replaced by lower offsets.
+type orderStore struct {
+	written map[orderEvent]bool
+	last    map[writtenKey]int64
+	offsets map[int32]int64
+}
+
+// orderEvents returns the change events of partition p from offset start up
+// to end, alternating between the tables.
+func orderEvents(p int32, start, end int64, tables ...string) []orderEvent {
+	var e []orderEvent
+	for n := start; n < end; n++ {
+		e = append(e, orderEvent{p: p, n: n, t: tables[int(n)%len(tables)]})
+	}
+	return e
+}
+
+// write processes a batch of change events as in processStream, and checks
+// that writes to each table and partition are in order.
+func (s *orderStore) write(t *testing.T, o *streamOrder, name string, events []orderEvent) {
+	cmdgraph := command.NewCommandGraph()
+	offsets := make(map[int32]int64)
+	for _, e := range events {
+		cmdgraph.Commands.PushBack(&command.Command{
+			Op:             command.MergeOp,
+			SchemaName:     "s",
+			TableName:      e.t,
+			SourcePosition: command.Position{Topic: "db.s", Partition: e.p, Offset: e.n},
+		})
+		offsets[e.p] = e.n + 1
+	}
+	unlock := o.lock(cmdgraph)
+	o.removeWritten(cmdgraph)
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		k := newWrittenKey(cmd)
+		if last, ok := s.last[k]; ok && cmd.SourcePosition.Offset <= last {
+			t.Errorf("%s: %s written at offset %d after offset %d", name, cmd.TableName,
+				cmd.SourcePosition.Offset, last)
+		}
+		s.last[k] = cmd.SourcePosition.Offset
+		s.written[orderEvent{p: cmd.SourcePosition.Partition, n: cmd.SourcePosition.Offset, t: cmd.TableName}] = true
+	}
+	for p, n := range offsets {
+		s.offsets[p] = max(s.offsets[p], n)
+	}
+	o.setWritten(cmdgraph)
+	unlock()
+}
+
+// check verifies that no stored offset is past a change event that has not
+// been written.
+func (s *orderStore) check(t *testing.T, name string, log map[int32][]orderEvent) {
+	for p, events := range log {
+		for _, e := range events {
+			if e.n < s.offsets[p] && !s.written[e] {
+				t.Errorf("%s: partition %d: offset %d stored, but event at offset %d not written",
+					name, p, s.offsets[p], e.n)
+			}
+		}
+	}
+}
+
+func TestStreamOrderOffsets(t *testing.T) {
+	log := map[int32][]orderEvent{
+		0: orderEvents(0, 0, 20, "t1", "t2"),
+		1: orderEvents(1, 0, 10, "t2", "t3"),
+	}
+	// Consumer 1 reads a batch and is slow to write it.  Meanwhile its
+	// partitions are reassigned to consumer 2, which reads them again from
+	// the stored offsets, and writes several batches.
+	slow := append(orderEvents(0, 0, 10, "t1", "t2"), orderEvents(1, 0, 5, "t2", "t3")...)
+	batches := [][]orderEvent{
+		append(orderEvents(0, 0, 15, "t1", "t2"), orderEvents(1, 0, 3, "t2", "t3")...),
+		orderEvents(1, 3, 10, "t2", "t3"),
+		orderEvents(0, 15, 20, "t1", "t2"),
+	}
+	for i := 0; i <= len(batches); i++ {
+		name := fmt.Sprintf("slow batch completed after %d others", i)
+		s := &orderStore{
+			written: make(map[orderEvent]bool),
+			last:    make(map[writtenKey]int64),
+			offsets: make(map[int32]int64),
+		}
+		o := newStreamOrder()
+		for j, b := range batches {
+			if j == i {
+				s.write(t, o, name, slow)
+				s.check(t, name, log)
+			}
+			s.write(t, o, name, b)
+			s.check(t, name, log)
+		}
+		if i == len(batches) {
+			s.write(t, o, name, slow)
+			s.check(t, name, log)
+		}
+		for p, events := range log {
+			if s.offsets[p] != int64(len(events)) {
+				t.Errorf("%s: partition %d: got offset %d; want %d", name, p, s.offsets[p], len(events))
+			}
+		}
+	}
+}
+
+func TestStreamOrderRemoveWritten(t *testing.T) {
+	o := newStreamOrder()
+	batch := func(events []orderEvent) *command.CommandGraph {
+		cmdgraph := command.NewCommandGraph()
+		for _, e := range events {
+			cmdgraph.Commands.PushBack(&command.Command{
+				SchemaName:     "s",
+				TableName:      e.t,
+				SourcePosition: command.Position{Topic: "db.s", Partition: e.p, Offset: e.n},
+			})
+		}
+		return cmdgraph
+	}
+	o.setWritten(batch([]orderEvent{{0, 4, "t1"}, {1, 7, "t1"}}))
+	cmdgraph := batch([]orderEvent{{0, 4, "t1"}, {0, 5, "t1"}, {0, 3, "t2"}, {1, 6, "t1"}, {1, 8, "t1"}})
+	if n := o.removeWritten(cmdgraph); n != 2 {
+		t.Errorf("got %d removed; want 2", n)
+	}
+	var got []int64
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		got = append(got, e.Value.(*command.Command).SourcePosition.Offset)
+	}
+	if fmt.Sprint(got) != "[5 3 8]" {
+		t.Errorf("got offsets %v; want [5 3 8]", got)
+	}
+}
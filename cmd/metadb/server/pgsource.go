@@ -0,0 +1,685 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
+	"github.com/metadb-project/metadb/cmd/metadb/pgrepl"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// pgStatusInterval is the maximum time between status updates sent to the
+// source database.
+const pgStatusInterval = 10 * time.Second
+
+// pgPollLoop reads changes from a PostgreSQL data source using logical
+// replication.  If the replication slot does not exist, it is created and
+// the initial data are read from the snapshot exported by the slot.
+func pgPollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
+	waitUserPerms, err := goUpdateUserPerms(cat, spr)
+	if err != nil {
+		return err
+	}
+	syncMode, err := dsync.ReadSyncMode(spr.svr.dp, spr.source.Name)
+	if err != nil {
+		log.Error("unable to read sync mode: %v", err)
+	}
+	if syncMode != dsync.NoSync {
+		spr.source.Status.Sync.Snapshot()
+	}
+	dedup := log.NewMessageSet()
+	if err = compileSourceFilters(spr); err != nil {
+		return &dberr.FatalError{Err: err}
+	}
+
+	// The regular connection is used to read the snapshot and to look up
+	// primary keys.
+	sc, err := pgx.Connect(ctx, spr.source.Connection)
+	if err != nil {
+		spr.source.Status.Stream.Error()
+		return fmt.Errorf("connecting to source database: %w", err)
+	}
+	defer func(sc *pgx.Conn) {
+		_ = sc.Close(context.TODO())
+	}(sc)
+	rc, err := pgrepl.Connect(ctx, spr.source.Connection)
+	if err != nil {
+		spr.source.Status.Stream.Error()
+		return fmt.Errorf("connecting to source database for replication: %w", err)
+	}
+	defer func(rc *pgrepl.Conn) {
+		_ = rc.Close(context.TODO())
+	}(rc)
+
+	var exists bool
+	q := "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name=$1)"
+	if err = sc.QueryRow(ctx, q, spr.source.Slot).Scan(&exists); err != nil {
+		return fmt.Errorf("looking up replication slot %q: %w", spr.source.Slot, err)
+	}
+	if exists {
+		// If the snapshot was not completely written, the slot is
+		// dropped and the snapshot is taken again.
+		complete, err := cat.SnapshotComplete(spr.source.Name, spr.source.Slot)
+		if err != nil {
+			return err
+		}
+		if !complete {
+			log.Warning("source %q: snapshot from replication slot %q is incomplete; dropping slot",
+				spr.source.Name, spr.source.Slot)
+			q = "SELECT pg_drop_replication_slot($1)"
+			if _, err = sc.Exec(ctx, q, spr.source.Slot); err != nil {
+				return fmt.Errorf("dropping replication slot %q: %w", spr.source.Slot, err)
+			}
+			exists = false
+		}
+	}
+	var start pgrepl.LSN
+	if !exists {
+		if err = cat.ClearSnapshotComplete(spr.source.Name); err != nil {
+			return err
+		}
+		slot, err := rc.CreateSlot(ctx, spr.source.Slot)
+		if err != nil {
+			return err
+		}
+		log.Info("source %q: created replication slot %q at %s", spr.source.Name, slot.Name, slot.ConsistentPoint)
+		spr.source.Status.Stream.Active()
+		if err = pgSnapshot(ctx, cat, spr, sc, slot.Name, slot.SnapshotName, syncMode, dedup); err != nil {
+			// Drop the slot so that the snapshot is taken again
+			// when the stream is restarted.
+			_ = rc.Close(context.TODO())
+			q = "SELECT pg_drop_replication_slot($1)"
+			if _, derr := sc.Exec(context.TODO(), q, slot.Name); derr != nil {
+				log.Error("source %q: dropping replication slot %q: %v", spr.source.Name, slot.Name, derr)
+			}
+			return fmt.Errorf("snapshot: %w", err)
+		}
+		start = slot.ConsistentPoint
+	}
+
+	waitUserPerms.Wait()
+
+	if err = rc.StartReplication(ctx, spr.source.Slot, spr.source.Publication, start); err != nil {
+		spr.source.Status.Stream.Error()
+		return err
+	}
+	spr.source.Status.Stream.Active()
+	log.Debug("receiving data from source %q", spr.source.Name)
+	return pgStream(ctx, cat, spr, rc, sc, syncMode, dedup)
+}
+
+// pgRelation is a table in the source database.
+type pgRelation struct {
+	skip    bool // Table is filtered out
+	origin  string
+	schema  string
+	table   string
+	columns []pgColumn
+	hasKey  bool
+	fullRow bool // Rows are identified by all of their columns
+	oldKey  bool // Previous key values are sent for updates and deletes
+}
+
+type pgColumn struct {
+	name       string
+	dtype      command.DataType
+	dtypeSize  int64
+	primaryKey int
+}
+
+// newPGRelation applies the schema and table filters to a table.  The columns
+// are described by names and type OIDs, and keys gives the position of each
+// primary key column.  The key may be replaced by key columns defined for the
+// table, or by all columns if the table has no primary key.
+func newPGRelation(spr *sproc, schema, table string, names []string, types []uint32, keys map[string]int) *pgRelation {
+	opts := &spr.options
+	r := &pgRelation{table: command.Rename(opts.TableRename, table)}
+	var ok bool
+	r.origin, r.schema, ok = command.SourceSchema(schema, opts.SchemaPassFilter, opts.SchemaStopFilter,
+		opts.TrimSchemaPrefix, opts.AddSchemaPrefix, opts.SchemaRename, opts.Origins)
+	if !ok || (len(opts.TableStopFilter) > 0 && util.MatchRegexps(opts.TableStopFilter, schema+"."+table)) {
+		r.skip = true
+		return r
+	}
+	if k := command.MatchTableKey(opts.TableKeys, r.schema, r.table); k != nil {
+		keys = make(map[string]int)
+		for i, name := range k {
+			keys[name] = i + 1
+		}
+	}
+	r.fullRow = len(keys) == 0 && opts.FullRowKey
+	r.hasKey = len(keys) != 0 || r.fullRow
+	r.columns = make([]pgColumn, len(names))
+	var n int
+	for i := range names {
+		dtype, dtypeSize := pgDataType(types[i])
+		r.columns[i] = pgColumn{name: names[i], dtype: dtype, dtypeSize: dtypeSize, primaryKey: keys[names[i]]}
+		if r.fullRow {
+			r.columns[i].primaryKey = i + 1
+		}
+		if r.columns[i].primaryKey != 0 {
+			n++
+		}
+	}
+	if names != nil && !r.fullRow && n != len(keys) {
+		log.Warning("key columns not found in table %s.%s", r.schema, r.table)
+		r.hasKey = false
+	}
+	return r
+}
+
+// pgOldKey returns true if the replica identity of a table includes its key
+// columns, so that the previous key values of updated and deleted rows are
+// sent by the source.
+func pgOldKey(r *pgRelation, rel *pgrepl.Relation) bool {
+	if rel.ReplicaIdentity == 'f' {
+		return true
+	}
+	if r.fullRow {
+		return false
+	}
+	for i, col := range r.columns {
+		if col.primaryKey != 0 && (i >= len(rel.Columns) || !rel.Columns[i].Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// pgPrimaryKey returns the position of each primary key column of the table
+// having the specified OID.
+func pgPrimaryKey(ctx context.Context, dq dbx.Queryable, oid uint32, schema, table string) (map[string]int, error) {
+	q := "SELECT a.attname, array_position(i.indkey::int2[], a.attnum) " +
+		"FROM pg_index i JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey) " +
+		"WHERE i.indrelid = $1 AND i.indisprimary"
+	rows, err := dq.Query(ctx, q, oid)
+	if err != nil {
+		return nil, fmt.Errorf("reading primary key of %s.%s: %w", schema, table, err)
+	}
+	keys := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var pos int
+		if err = rows.Scan(&name, &pos); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading primary key of %s.%s: %w", schema, table, err)
+		}
+		keys[name] = pos
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading primary key of %s.%s: %w", schema, table, err)
+	}
+	return keys, nil
+}
+
+// command creates a command from a row of the table.  Values that are nil
+// are null, and unchanged values that were not sent by the source are
+// indicated by unavailable.  For a delete, only the primary key columns are
+// included.
+func (r *pgRelation) command(op command.Operation, values [][]byte, unavailable []bool, ts string, pos command.Position) *command.Command {
+	c := &command.Command{
+		Op:              op,
+		SchemaName:      r.schema,
+		TableName:       r.table,
+		Origin:          r.origin,
+		SourceTimestamp: ts,
+		SourcePosition:  pos,
+		FullRowKey:      r.fullRow,
+	}
+	if op == command.TruncateOp {
+		return c
+	}
+	for i, col := range r.columns {
+		if i >= len(values) || (op == command.DeleteOp && col.primaryKey == 0) {
+			continue
+		}
+		cc := command.CommandColumn{
+			Name:       col.name,
+			DType:      col.dtype,
+			DTypeSize:  col.dtypeSize,
+			PrimaryKey: col.primaryKey,
+		}
+		switch {
+		case unavailable != nil && unavailable[i]:
+			cc.Unavailable = true
+		case values[i] != nil:
+			cc.SQLData = pgSQLData(values[i], col.dtype)
+			if cc.SQLData != nil {
+				cc.Data = *cc.SQLData
+			}
+		}
+		c.Column = append(c.Column, cc)
+	}
+	return c
+}
+
+// pgDataType maps a PostgreSQL type OID to a data type.  Types that are not
+// recognized are stored as text.
+func pgDataType(oid uint32) (command.DataType, int64) {
+	switch oid {
+	case 16: // bool
+		return command.BooleanType, 0
+	case 17: // bytea
+		return command.ByteaType, 0
+	case 20: // int8
+		return command.IntegerType, 8
+	case 21: // int2
+		return command.IntegerType, 2
+	case 23: // int4
+		return command.IntegerType, 4
+	case 114, 3802: // json, jsonb
+		return command.JSONType, 0
+	case 700: // float4
+		return command.FloatType, 4
+	case 701: // float8
+		return command.FloatType, 8
+	case 1082: // date
+		return command.DateType, 0
+	case 1083: // time
+		return command.TimeType, 0
+	case 1114: // timestamp
+		return command.TimestampType, 0
+	case 1184: // timestamptz
+		return command.TimestamptzType, 0
+	case 1186: // interval
+		return command.IntervalType, 0
+	case 1266: // timetz
+		return command.TimetzType, 0
+	case 1700: // numeric
+		return command.NumericType, 0
+	case 2950: // uuid
+		return command.UUIDType, 0
+	case 1000: // _bool
+		return command.BooleanArrayType, 0
+	case 1005: // _int2
+		return command.IntegerArrayType, 2
+	case 1007: // _int4
+		return command.IntegerArrayType, 4
+	case 1016: // _int8
+		return command.IntegerArrayType, 8
+	case 1021: // _float4
+		return command.FloatArrayType, 4
+	case 1022: // _float8
+		return command.FloatArrayType, 8
+	case 1231: // _numeric
+		return command.NumericArrayType, 0
+	case 1009, 1015: // _text, _varchar
+		return command.TextArrayType, 0
+	case 2951: // _uuid
+		return command.UUIDArrayType, 0
+	default:
+		return command.TextType, 0
+	}
+}
+
+// pgSQLData converts a value in PostgreSQL text format to SQL data.  Floating
+// point and numeric special values such as NaN, which cannot be written
+// without quoting, are converted to null.
+func pgSQLData(data []byte, dtype command.DataType) *string {
+	s := string(data)
+	switch dtype {
+	case command.BooleanType:
+		if s == "t" {
+			s = "true"
+		} else {
+			s = "false"
+		}
+	case command.FloatType, command.NumericType:
+		switch strings.ToLower(s) {
+		case "nan", "infinity", "-infinity":
+			return nil
+		}
+	}
+	return &s
+}
+
+// pgSnapshot writes all rows of the tables in the publication, as of the
+// snapshot exported by the replication slot.  The snapshot is recorded as
+// complete in the transaction that writes its last rows.
+func pgSnapshot(ctx context.Context, cat *catalog.Catalog, spr *sproc, sc *pgx.Conn, slotName, snapshotName string, syncMode dsync.Mode, dedup *log.MessageSet) error {
+	log.Info("source %q: reading snapshot", spr.source.Name)
+	tx, err := sc.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer func(tx pgx.Tx) {
+		_ = tx.Rollback(context.TODO())
+	}(tx)
+	if _, err = tx.Exec(ctx, "SET TRANSACTION SNAPSHOT '"+snapshotName+"'"); err != nil {
+		return err
+	}
+	q := "SELECT c.oid, p.schemaname, p.tablename " +
+		"FROM pg_publication_tables p " +
+		"JOIN pg_namespace n ON n.nspname = p.schemaname " +
+		"JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = p.tablename " +
+		"WHERE p.pubname = $1 ORDER BY p.schemaname, p.tablename"
+	rows, err := tx.Query(ctx, q, spr.source.Publication)
+	if err != nil {
+		return fmt.Errorf("reading tables in publication %q: %w", spr.source.Publication, err)
+	}
+	type pubTable struct {
+		oid           uint32
+		schema, table string
+	}
+	var tables []pubTable
+	for rows.Next() {
+		var t pubTable
+		if err = rows.Scan(&t.oid, &t.schema, &t.table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	ts := command.FormatSourceTimestamp(time.Now())
+	cmdgraph := command.NewCommandGraph()
+	var total int
+	for _, t := range tables {
+		n, err := pgSnapshotTable(ctx, cat, spr, tx, cmdgraph, t.oid, t.schema, t.table, ts, syncMode, dedup)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.schema, t.table, err)
+		}
+		total += n
+	}
+	if err = pgExec(ctx, cat, spr, cmdgraph, slotName, syncMode, dedup); err != nil {
+		return err
+	}
+	cat.ResetLastSnapshotRecord(spr.source.Name)
+	log.Info("source %q: snapshot complete: %d rows", spr.source.Name, total)
+	if syncMode != dsync.NoSync {
+		spr.source.Status.Sync.SnapshotComplete()
+		log.Info("source %q snapshot complete; consider running \"metadb endsync\"", spr.source.Name)
+	}
+	return tx.Commit(ctx)
+}
+
+// pgSnapshotTable adds the rows of a table to cmdgraph, writing them whenever
+// the checkpoint segment size is reached.  The remaining rows are left in
+// cmdgraph to be written by the caller.  It returns the number of rows read.
+func pgSnapshotTable(ctx context.Context, cat *catalog.Catalog, spr *sproc, tx pgx.Tx, cmdgraph *command.CommandGraph, oid uint32, schema, table, ts string, syncMode dsync.Mode, dedup *log.MessageSet) (int, error) {
+	// The primary key is read before the rows, which use the same
+	// connection.
+	keys, err := pgPrimaryKey(ctx, tx, oid, schema, table)
+	if err != nil {
+		return 0, err
+	}
+	if newPGRelation(spr, schema, table, nil, nil, keys).skip {
+		return 0, nil
+	}
+	q := "SELECT * FROM " + pgx.Identifier{schema, table}.Sanitize()
+	rows, err := tx.Query(ctx, q, pgx.QueryResultFormats{pgx.TextFormatCode})
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	fields := rows.FieldDescriptions()
+	names := make([]string, len(fields))
+	types := make([]uint32, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+		types[i] = f.DataTypeOID
+	}
+	rel := newPGRelation(spr, schema, table, names, types, keys)
+	if !rel.hasKey {
+		pgKeyNotDefined(dedup, rel)
+		return 0, nil
+	}
+	var n int
+	for rows.Next() {
+		raw := rows.RawValues()
+		values := make([][]byte, len(raw))
+		for i := range raw {
+			if raw[i] != nil {
+				values[i] = append([]byte(nil), raw[i]...)
+			}
+		}
+		n++
+		c := rel.command(command.MergeOp, values, nil, ts, command.Position{})
+		if c = command.FilterRow(dedup, spr.options.RowFilters, c, true); c != nil {
+			_ = cmdgraph.Commands.PushBack(c)
+		}
+		if cmdgraph.Commands.Len() >= spr.svr.db.CheckpointSegmentSize {
+			if err = pgExec(ctx, cat, spr, cmdgraph, "", syncMode, dedup); err != nil {
+				return 0, err
+			}
+			cat.ResetLastSnapshotRecord(spr.source.Name)
+			cmdgraph.Commands.Init()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// pgStream reads changes from the replication connection.  Changes are
+// written to the database one or more whole source transactions at a time,
+// after which the source is notified that the changes have been written.
+func pgStream(ctx context.Context, cat *catalog.Catalog, spr *sproc, rc *pgrepl.Conn, sc *pgx.Conn, syncMode dsync.Mode, dedup *log.MessageSet) error {
+	relations := make(map[uint32]*pgRelation)
+	cmdgraph := command.NewCommandGraph()
+	var inTxn bool
+	var ts string
+	var events int
+	var pending, flushed pgrepl.LSN // End of the last transaction read and written
+	lastFlush := time.Now()
+	lastStatus := time.Now()
+	for {
+		rctx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, err := rc.Receive(rctx)
+		cancel()
+		if err != nil && !pgconn.Timeout(err) {
+			return err
+		}
+		switch m := msg.(type) {
+		case *pgrepl.XLogData:
+			pm, err := pgrepl.ParseMessage(m.Data)
+			if err != nil {
+				return err
+			}
+			pos := command.Position{LSN: uint64(m.WALStart)}
+			switch pm := pm.(type) {
+			case *pgrepl.Begin:
+				inTxn = true
+				ts = command.FormatSourceTimestamp(pm.CommitTime)
+			case *pgrepl.Commit:
+				inTxn = false
+				pending = pm.EndLSN
+			case *pgrepl.Relation:
+				names := make([]string, len(pm.Columns))
+				types := make([]uint32, len(pm.Columns))
+				for i, col := range pm.Columns {
+					names[i] = col.Name
+					types[i] = col.TypeOID
+				}
+				keys, err := pgPrimaryKey(ctx, sc, pm.ID, pm.Namespace, pm.Name)
+				if err != nil {
+					return err
+				}
+				rel := newPGRelation(spr, pm.Namespace, pm.Name, names, types, keys)
+				rel.oldKey = pgOldKey(rel, pm)
+				relations[pm.ID] = rel
+			case *pgrepl.Insert:
+				events++
+				if rel, err := pgLookupRelation(relations, pm.RelationID); err != nil {
+					return err
+				} else if !rel.skip {
+					if !rel.hasKey {
+						pgKeyNotDefined(dedup, rel)
+						break
+					}
+					values, _ := tupleValues(pm.New)
+					c := rel.command(command.MergeOp, values, nil, ts, pos)
+					if c = command.FilterRow(dedup, spr.options.RowFilters, c, false); c != nil {
+						_ = cmdgraph.Commands.PushBack(c)
+					}
+				}
+			case *pgrepl.Update:
+				events++
+				if rel, err := pgLookupRelation(relations, pm.RelationID); err != nil {
+					return err
+				} else if !rel.skip {
+					if !rel.hasKey {
+						pgKeyNotDefined(dedup, rel)
+						break
+					}
+					values, unavailable := tupleValues(pm.New)
+					c := rel.command(command.MergeOp, values, unavailable, ts, pos)
+					// If the key values have changed, the previous
+					// version of the row is deleted.
+					if pm.Old != nil && rel.oldKey {
+						oldValues, _ := tupleValues(pm.Old)
+						if old := rel.command(command.DeleteOp, oldValues, nil, ts, pos); command.KeyChanged(old, c) {
+							c.Replaces = old
+						}
+					} else if rel.fullRow {
+						// The previous version of the row cannot
+						// be found, and remains current.
+						log.Warning("previous values of row not available: %s.%s: previous version of updated row remains current",
+							rel.schema, rel.table)
+					}
+					if c = command.FilterRow(dedup, spr.options.RowFilters, c, false); c != nil {
+						_ = cmdgraph.Commands.PushBack(c)
+					}
+				}
+			case *pgrepl.Delete:
+				events++
+				if rel, err := pgLookupRelation(relations, pm.RelationID); err != nil {
+					return err
+				} else if !rel.skip {
+					if !rel.hasKey {
+						pgKeyNotDefined(dedup, rel)
+						break
+					}
+					if !rel.oldKey {
+						msg := fmt.Sprintf("replica identity does not include key: %s.%s", rel.schema, rel.table)
+						if dedup.Insert(msg) {
+							log.Warning("%s", msg)
+						}
+						break
+					}
+					values, _ := tupleValues(pm.Old)
+					_ = cmdgraph.Commands.PushBack(rel.command(command.DeleteOp, values, nil, ts, pos))
+				}
+			case *pgrepl.Truncate:
+				events++
+				for _, id := range pm.RelationIDs {
+					rel, err := pgLookupRelation(relations, id)
+					if err != nil {
+						return err
+					}
+					if !rel.skip {
+						_ = cmdgraph.Commands.PushBack(rel.command(command.TruncateOp, nil, nil, ts, pos))
+					}
+				}
+			}
+		case *pgrepl.Keepalive:
+			// If all changes read have been written, the position
+			// can be advanced past changes that are not published.
+			if !inTxn && pending == flushed && m.WALEnd > flushed {
+				pending, flushed = m.WALEnd, m.WALEnd
+			}
+			if m.ReplyRequested {
+				if err = rc.SendStatus(flushed); err != nil {
+					return err
+				}
+				lastStatus = time.Now()
+			}
+		}
+
+		// Write complete transactions.
+		if !inTxn && pending > flushed &&
+			(msg == nil || cmdgraph.Commands.Len() >= spr.svr.db.CheckpointSegmentSize ||
+				time.Since(lastFlush) >= 5*time.Second) {
+			if err = pgExec(ctx, cat, spr, cmdgraph, "", syncMode, dedup); err != nil {
+				return err
+			}
+			if events > 0 {
+				metrics.EventsRead.Add(float64(events), spr.source.Name)
+				metrics.LastEventTime.SetToCurrentTime(spr.source.Name)
+				spr.source.Status.Progress.AddEvents(int64(events))
+				log.Debug("checkpoint: events=%d, commands=%d", events, cmdgraph.Commands.Len())
+			}
+			if ts != "" {
+				spr.source.Status.Progress.SetSourceTimestamp(ts)
+			}
+			flushed = pending
+			if err = rc.SendStatus(flushed); err != nil {
+				return err
+			}
+			cmdgraph = command.NewCommandGraph()
+			events = 0
+			lastFlush = time.Now()
+			lastStatus = lastFlush
+		}
+		if time.Since(lastStatus) >= pgStatusInterval {
+			if err = rc.SendStatus(flushed); err != nil {
+				return err
+			}
+			lastStatus = time.Now()
+		}
+	}
+}
+
+func pgLookupRelation(relations map[uint32]*pgRelation, id uint32) (*pgRelation, error) {
+	rel, ok := relations[id]
+	if !ok {
+		return nil, fmt.Errorf("relation %d not defined", id)
+	}
+	return rel, nil
+}
+
+// pgKeyNotDefined logs a warning that changes to a table are skipped because
+// the table has no key.
+func pgKeyNotDefined(dedup *log.MessageSet, rel *pgRelation) {
+	msg := fmt.Sprintf("primary key not defined: %s.%s", rel.schema, rel.table)
+	if dedup.Insert(msg) {
+		log.Warning("%s", msg)
+	}
+}
+
+// tupleValues returns the values of a tuple, and which values are unchanged
+// values that were not sent.
+func tupleValues(t pgrepl.Tuple) ([][]byte, []bool) {
+	values := make([][]byte, len(t))
+	var unavailable []bool
+	for i, v := range t {
+		switch v.Kind {
+		case 't':
+			values[i] = v.Data
+		case 'u':
+			if unavailable == nil {
+				unavailable = make([]bool, len(t))
+			}
+			unavailable[i] = true
+		}
+	}
+	return values, unavailable
+}
+
+// pgExec rewrites and writes the commands in cmdgraph.  If slot is not empty,
+// the snapshot read from the replication slot is recorded as complete.
+func pgExec(ctx context.Context, cat *catalog.Catalog, spr *sproc, cmdgraph *command.CommandGraph, slot string, syncMode dsync.Mode, dedup *log.MessageSet) error {
+	if err := rewriteCommandGraph(cmdgraph, spr.svr.opt.RewriteJSON, spr.columnRules, spr.source.ColumnHashKey); err != nil {
+		return &dberr.FatalError{Err: fmt.Errorf("rewriter: %w", err)}
+	}
+	if err := execCommandGraph(0, ctx, cat, cmdgraph, spr.source.Name, "", nil, slot, spr.source.AuditColumns, syncMode, dedup); err != nil {
+		return fmt.Errorf("executor: %w", err)
+	}
+	return nil
+}
@@ -3,22 +3,25 @@ package server
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
-	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/avro"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/change"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dberr"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
 	"github.com/metadb-project/metadb/cmd/metadb/status"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 	"github.com/metadb-project/metadb/cmd/metadb/util"
@@ -29,36 +32,111 @@ func goPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server) {
 	if svr.opt.NoKafkaCommit {
 		log.Info("Kafka commits disabled")
 	}
-	// For now, we support only one source
-	spr, err := waitForConfig(svr)
-	if err != nil {
-		log.Fatal("%s", err)
-		os.Exit(1)
+	// The source log is shared by all data sources.
+	var sourceLog *log.SourceLog
+	if svr.opt.LogSource != "" {
+		var err error
+		if sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
+	}
+	// Each enabled data source is read by a separate poll loop.  Data
+	// sources that are enabled while the server is running are started as
+	// they are found, and data sources that are disabled or dropped are
+	// stopped.  The cancel function of each poll loop is kept until the
+	// loop has exited, so that a data source that is enabled again is not
+	// started twice.
+	running := make(map[string]context.CancelFunc)
+	exited := make(chan string)
+	for {
+		sprs, stop, err := checkSources(svr, running)
+		if err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
+		for _, name := range stop {
+			log.Info("stopping source %q", name)
+			running[name]()
+		}
+		for _, spr := range sprs {
+			spr.sourceLog = sourceLog
+			sctx, cancel := context.WithCancel(ctx)
+			running[spr.source.Name] = cancel
+			go func(spr *sproc) {
+				goSourcePollLoop(sctx, cat, svr, spr)
+				exited <- spr.source.Name
+			}(spr)
+		}
+		// Check less often once a data source is running.
+		delay := 2 * time.Second
+		if len(running) != 0 {
+			delay = 30 * time.Second
+		}
+		select {
+		case name := <-exited:
+			running[name]()
+			delete(running, name)
+			removeSource(svr, name)
+		case <-time.After(delay):
+		}
 	}
+}
 
-	err = logSyncMode(svr.dp, spr.source.Name)
+func goSourcePollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) {
+	err := logSyncMode(svr.dp, spr.source.Name)
 	if err != nil {
 		log.Fatal("%s", err)
 		os.Exit(1)
 	}
 
-	folio, err := isFolioModulePresent(svr.db)
-	if err != nil {
-		log.Error("checking for folio module: %v", err)
+	if err = cat.InitMaintenance(spr.source.Name); err != nil {
+		log.Error("%v", err)
 	}
-	reshare, err := isReshareModulePresent(svr.db)
-	if err != nil {
-		log.Error("checking for reshare module: %v", err)
-	}
-	go goMaintenance(svr.opt.Datadir, *(svr.db), svr.dp, cat, spr.source.Name, folio, reshare)
+	folio := spr.source.Module == "folio"
+	reshare := spr.source.Module == "reshare"
+	go goMaintenance(ctx, svr.opt.Datadir, *(svr.db), svr.dp, cat, spr.source.Name, folio, reshare)
 
+	var b backoff
 	for {
+		start := time.Now()
 		err := launchPollLoop(ctx, cat, svr, spr)
+		if ctx.Err() != nil {
+			log.Info("source %q: stream stopped", spr.source.Name)
+			return
+		}
+		// The stream is restarted even if it stopped without an error.
+		transient := err == nil || dberr.IsTransient(err)
 		if err == nil {
-			break
+			err = errors.New("stream stopped")
 		}
 		spr.source.Status.Stream.Error()
-		time.Sleep(24 * time.Hour)
+		spr.source.Status.LastError.Set(err.Error())
+		// Restart the stream after a delay.  Transient errors are retried
+		// with increasing delays, which are reset if the stream has been
+		// running for a while.  Other errors are retried after a longer
+		// delay, in case the problem has been corrected.
+		var delay time.Duration
+		if transient {
+			if time.Since(start) > retryMaxDelay {
+				b.reset()
+			}
+			delay = b.next()
+		} else {
+			delay = retryFatalDelay
+		}
+		retry := time.Now().Add(delay)
+		spr.source.Status.NextRetry.Set(retry)
+		log.Info("source %q: restarting stream at %s", spr.source.Name, retry.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			spr.source.Status.NextRetry.Clear()
+			log.Info("source %q: stream stopped", spr.source.Name)
+			return
+		case <-time.After(delay):
+		}
+		spr.source.Status.NextRetry.Clear()
+		spr.source.Status.LastError.Clear()
 	}
 }
 
@@ -83,7 +161,7 @@ func logSyncMode(dq dbx.Queryable, source string) error {
 func launchPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) (reterr error) {
 	defer func() {
 		if r := recover(); r != nil {
-			reterr = fmt.Errorf("%v", r)
+			reterr = &dberr.FatalError{Err: fmt.Errorf("panic: %v", r)}
 			log.Error("%s", reterr)
 			// Log stack trace.
 			buf := make([]byte, 65536)
@@ -93,19 +171,13 @@ func launchPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr
 	}()
 	reterr = outerPollLoop(ctx, cat, svr, spr)
 	if reterr != nil {
-		panic(reterr.Error())
+		log.Error("source %q: %s", spr.source.Name, reterr)
 	}
 	return
 }
 
 func outerPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) error {
 	var err error
-	// Set up source log
-	if svr.opt.LogSource != "" {
-		if spr.sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
-			return err
-		}
-	}
 
 	//// TMP
 	// set command.FolioTenant
@@ -115,14 +187,17 @@ func outerPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *
 		}
 		command.FolioTenant = folioTenant
 	*/
-	// set command.ReshareTenants
-	command.ReshareTenants, err = catalog.Origins(svr.db)
+	// set spr.options.Origins
+	spr.options.Origins, err = catalog.Origins(svr.db)
 	if err != nil {
 		return err
 	}
 	////
 
 	log.Debug("starting stream processor")
+	if spr.source.Type == "postgresql" {
+		return pgPollLoop(ctx, cat, spr)
+	}
 	if err = pollLoop(ctx, cat, spr); err != nil {
 		//log.Error("%s", err)
 		return err
@@ -159,10 +234,7 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 	if err != nil {
 		return err
 	}
-	dcsuper, err := spr.svr.db.ConnectSuper()
-	if err != nil {
-		return err
-	}
+	defer dbx.Close(dc)
 	//////////////////////////////////////////////////////////////////////////////
 	//spr.db = append(spr.db, db)
 	// Cache tracking
@@ -176,17 +248,10 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		}
 	*/
 	// Update user permissions in database
-	var waitUserPerms sync.WaitGroup
-	waitUserPerms.Add(1)
-	go func(trackedTables []dbx.Table) {
-		defer waitUserPerms.Done()
-		var dc2 *pgx.Conn
-		dc2, err = spr.svr.db.Connect()
-		if err != nil {
-			log.Error("%v", err)
-		}
-		sysdb.GoUpdateUserPerms(dc2, dcsuper, trackedTables)
-	}(cat.AllTables(spr.source.Name))
+	waitUserPerms, err := goUpdateUserPerms(cat, spr)
+	if err != nil {
+		return err
+	}
 	// Cache users
 	/*	users, err := cache.NewUsers(db)
 		if err != nil {
@@ -207,17 +272,31 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 	// messages.
 	dedup := log.NewMessageSet()
 
-	spr.schemaPassFilter, err = util.CompileRegexps(spr.source.SchemaPassFilter)
-	if err != nil {
-		return err
+	if err = compileSourceFilters(spr); err != nil {
+		return &dberr.FatalError{Err: err}
 	}
-	spr.schemaStopFilter, err = util.CompileRegexps(spr.source.SchemaStopFilter)
-	if err != nil {
-		return err
+	// Column rules cannot be applied to the messages as read from Kafka,
+	// and so they are not written to the source log.
+	if spr.sourceLog != nil && len(spr.columnRules) != 0 {
+		log.Warning("source %q: messages not logged to source log because column rules are defined", spr.source.Name)
+		spr.sourceLog = nil
 	}
-	spr.tableStopFilter, err = util.CompileRegexps(spr.source.TableStopFilter)
-	if err != nil {
-		return err
+	switch spr.source.Format {
+	case "avro":
+		spr.decoder = avro.NewDecoder(spr.source.SchemaRegistry)
+	case "json-schemaless":
+		spr.decoder = change.SchemalessDecoder{}
+	}
+	var deadLetter func(*kafka.Message, error) error
+	if spr.source.DeadLetter {
+		n, err := cat.CountDeadLetters(spr.source.Name)
+		if err != nil {
+			return err
+		}
+		spr.source.Status.DeadLetters.Set(n)
+		deadLetter = func(msg *kafka.Message, reason error) error {
+			return writeDeadLetter(cat, spr.source, msg, reason, len(spr.columnRules) != 0)
+		}
 	}
 	var brokers = spr.source.Brokers
 	var topics = spr.source.Topics
@@ -236,15 +315,27 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		"partition.assignment.strategy": "roundrobin",
 		"security.protocol":             spr.source.Security,
 	}
-	// During normal operation, we run single-threaded to give priority to user queries.
-	// During a sync process, we enable concurrency.
-	// This could be made configurable.
+	setConfigOption(config, "sasl.mechanisms", spr.source.SASLMechanism)
+	setConfigOption(config, "sasl.username", spr.source.SASLUsername)
+	setConfigOption(config, "sasl.password", spr.source.SASLPassword)
+	setConfigOption(config, "ssl.ca.location", spr.source.SSLCA)
+	setConfigOption(config, "ssl.certificate.location", spr.source.SSLCert)
+	setConfigOption(config, "ssl.key.location", spr.source.SSLKey)
+	// The number of concurrent consumers is configured separately for normal
+	// operation and for a sync process.
 	var consumersN int // Number of concurrent consumers
 	if syncMode == dsync.NoSync {
-		consumersN = 1
+		consumersN = spr.source.Concurrency
 	} else {
-		consumersN = 32
+		consumersN = spr.source.SyncConcurrency
 	}
+	// The change events of a source transaction may be in any partition, and
+	// so a single consumer is needed to buffer whole transactions.
+	if spr.source.Transactions && consumersN > 1 {
+		log.Info("source %q: transactions enabled; running 1 consumer", spr.source.Name)
+		consumersN = 1
+	}
+	log.Debug("source %q: running %d consumers", spr.source.Name, consumersN)
 	// First create the consumers.
 	consumers := make([]*kafka.Consumer, consumersN)
 	for i := 0; i < consumersN; i++ {
@@ -262,11 +353,29 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 			_ = consumers[i].Close()
 		}
 	}(consumers)
-	// Next subscribe to the topics and register a rebalance callback which sets rebalanceFlag.
-	var rebalanceFlag int32 // Atomic used to signal a rebalance
+	// Next subscribe to the topics.  The rebalance callback runs within
+	// Poll, in the thread of the consumer, and an error in assigning
+	// partitions is returned by that thread's next read.
+	assignErrs := make([]error, consumersN)
 	for i := 0; i < consumersN; i++ {
 		err = consumers[i].SubscribeTopics(topics, func(c *kafka.Consumer, event kafka.Event) error {
-			atomic.StoreInt32(&rebalanceFlag, int32(1))
+			log.Trace("rebalance: %v", event)
+			switch e := event.(type) {
+			case kafka.AssignedPartitions:
+				metrics.Rebalances.Inc(spr.source.Name, "assigned")
+				if err := assignStoredOffsets(c, cat, spr.source, e.Partitions, !spr.svr.opt.NoKafkaCommit); err != nil {
+					assignErrs[i] = err
+					return err
+				}
+			case kafka.RevokedPartitions:
+				metrics.Rebalances.Inc(spr.source.Name, "revoked")
+				for _, p := range e.Partitions {
+					if p.Topic != nil {
+						metrics.ConsumerLag.Delete(spr.source.Name, *p.Topic, strconv.Itoa(int(p.Partition)))
+						spr.source.Status.Progress.Remove(status.TopicPartition{Topic: *p.Topic, Partition: p.Partition})
+					}
+				}
+			}
 			return nil
 		})
 		if err != nil {
@@ -280,66 +389,185 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 	waitUserPerms.Wait()
 
 	// One thread (goroutine) per consumer runs a stream processor in a loop.
-	// When a rebalance occurs, we synchronize the threads to prevent out-of-order database writes.
+	// Database writes are kept in order per table by the shared streamOrder, which
+	// allows the threads to continue running across rebalances.  If any thread
+	// fails, stopFlag is set to stop the other threads.
 	var firstEvent int32 // Atomic used to log that data have been received
 	atomic.StoreInt32(&firstEvent, int32(1))
-	for {
-		var waitStreamProcs sync.WaitGroup
-		errStrings := make([]string, consumersN)
-		atomic.StoreInt32(&rebalanceFlag, int32(0)) // Reset
-		for i := 0; i < consumersN; i++ {
-			waitStreamProcs.Add(1)
-			go func(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, rebalanceFlag *int32, firstEvent *int32, errString *string) {
-				defer waitStreamProcs.Done()
-				processStream(thread, consumer, ctx, cat, spr, syncMode, dedup, rebalanceFlag, firstEvent, errString)
-			}(i, consumers[i], ctx, cat, spr, syncMode, dedup, &rebalanceFlag, &firstEvent, &(errStrings[i]))
-		}
+	var stopFlag int32 // Atomic used to signal the threads to stop
+	order := newStreamOrder()
+	var waitStreamProcs sync.WaitGroup
+	errs := make([]error, consumersN)
+	for i := 0; i < consumersN; i++ {
+		waitStreamProcs.Add(1)
+		go func(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, order *streamOrder, stopFlag *int32, firstEvent *int32, assignErr *error, reterr *error) {
+			defer waitStreamProcs.Done()
+			processStream(thread, consumer, ctx, cat, spr, syncMode, dedup, deadLetter, order, stopFlag, firstEvent, assignErr, reterr)
+			if *reterr != nil {
+				atomic.StoreInt32(stopFlag, int32(1))
+			}
+		}(i, consumers[i], ctx, cat, spr, syncMode, dedup, order, &stopFlag, &firstEvent, &(assignErrs[i]), &(errs[i]))
+	}
 
-		waitStreamProcs.Wait() // Synchronize the threads
+	waitStreamProcs.Wait()
 
-		// TODO This error handling is not quite right.
-		for i := 0; i < consumersN; i++ {
-			if errStrings[i] != "" {
-				spr.source.Status.Stream.Error()
-				return errors.New(errStrings[i])
-			}
+	for i := 0; i < consumersN; i++ {
+		if errs[i] != nil {
+			spr.source.Status.Stream.Error()
+			return errs[i]
 		}
 	}
+	return nil
+}
+
+// goUpdateUserPerms updates user permissions on the tables of a data source,
+// in a separate goroutine.  The returned WaitGroup is done when the update has
+// finished.
+func goUpdateUserPerms(cat *catalog.Catalog, spr *sproc) (*sync.WaitGroup, error) {
+	dcsuper, err := spr.svr.db.ConnectSuper()
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func(trackedTables []dbx.Table) {
+		defer wg.Done()
+		defer dbx.Close(dcsuper)
+		dc2, err := spr.svr.db.Connect()
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		defer dbx.Close(dc2)
+		sysdb.GoUpdateUserPerms(dc2, dcsuper, trackedTables)
+	}(cat.AllTables(spr.source.Name))
+	return &wg, nil
 }
 
-func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, rebalanceFlag *int32, firstEvent *int32, errString *string) {
+// compileSourceFilters compiles the schema and table filters of a data
+// source.
+func compileSourceFilters(spr *sproc) error {
+	var err error
+	opts := &spr.options
+	if opts.SchemaPassFilter, err = util.CompileRegexps(spr.source.SchemaPassFilter); err != nil {
+		return err
+	}
+	if opts.SchemaStopFilter, err = util.CompileRegexps(spr.source.SchemaStopFilter); err != nil {
+		return err
+	}
+	if opts.TableStopFilter, err = util.CompileRegexps(spr.source.TableStopFilter); err != nil {
+		return err
+	}
+	opts.TrimSchemaPrefix = spr.source.TrimSchemaPrefix
+	opts.AddSchemaPrefix = spr.source.AddSchemaPrefix
+	opts.FullRowKey = spr.source.FullRowKey
+	// Rules in the preset, if any, are applied first.
+	preset, err := command.RenamePreset(spr.source.RenamePreset)
+	if err != nil {
+		return err
+	}
+	rules, err := command.ParseRenameRules(spr.source.SchemaRename)
+	if err != nil {
+		return err
+	}
+	opts.SchemaRename = append(append([]command.RenameRule{}, preset...), rules...)
+	if opts.TableRename, err = command.ParseRenameRules(spr.source.TableRename); err != nil {
+		return err
+	}
+	if spr.columnRules, err = command.ParseColumnRules(spr.source.ColumnRules, spr.source.ColumnHashKey); err != nil {
+		return err
+	}
+	if opts.RowFilters, err = command.ParseRowFilters(spr.source.RowFilters); err != nil {
+		return err
+	}
+	if opts.TableKeys, err = command.ParseTableKeys(spr.source.TableKeys); err != nil {
+		return err
+	}
+	return nil
+}
+
+func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, deadLetter func(*kafka.Message, error) error, order *streamOrder, stopFlag *int32, firstEvent *int32, assignErr *error, reterr *error) {
 	// Parameters spr and syncMode are not thread-safe and should not be modified during stream processing.
 
+	// If enabled, source transactions are buffered across batches until
+	// they are complete.
+	var txns *txnBuffer
+	if spr.source.Transactions {
+		txns = newTxnBuffer(spr.source.Name)
+	}
+
+	read := func() (*kafka.Message, error) {
+		msg, err := readChangeEvent(consumer, spr.sourceLog, kafkaPollTimeout)
+		if *assignErr != nil {
+			return nil, *assignErr
+		}
+		return msg, err
+	}
+
 	for { // Stream processing main loop
 		cmdgraph := command.NewCommandGraph()
 
 		// Parse
-		eventReadCount, err := parseChangeEvents(cat, dedup, consumer, cmdgraph, spr.schemaPassFilter,
-			spr.schemaStopFilter, spr.tableStopFilter, spr.source.TrimSchemaPrefix,
-			spr.source.AddSchemaPrefix, spr.sourceLog, spr.svr.db.CheckpointSegmentSize)
+		offsets := make(map[catalog.TopicPartition]int64)
+		eventReadCount, err := parseChangeEvents(cat, spr, dedup, read, cmdgraph, deadLetter, offsets, txns)
 		if err != nil {
-			*errString = fmt.Sprintf("parser: %v", err)
+			*reterr = fmt.Errorf("parser: %w", err)
 			return
 		}
+		if txns != nil {
+			if n := txns.release(cmdgraph, dedup); n > 0 {
+				log.Trace("[%d] releasing %d transactions", thread, n)
+			}
+			txns.limitOffsets(offsets)
+		}
+		if eventReadCount > 0 {
+			metrics.EventsRead.Add(float64(eventReadCount), spr.source.Name)
+			metrics.LastEventTime.SetToCurrentTime(spr.source.Name)
+		}
+		spr.source.Status.Progress.AddEvents(int64(eventReadCount))
 		if atomic.LoadInt32(firstEvent) == 1 {
 			atomic.StoreInt32(firstEvent, int32(0))
 			log.Debug("receiving data from source %q", spr.source.Name)
 		}
 
 		// Rewrite
-		if err = rewriteCommandGraph(cmdgraph, spr.svr.opt.RewriteJSON); err != nil {
-			*errString = fmt.Sprintf("rewriter: %v", err)
+		if err = rewriteCommandGraph(cmdgraph, spr.svr.opt.RewriteJSON, spr.columnRules, spr.source.ColumnHashKey); err != nil {
+			*reterr = &dberr.FatalError{Err: fmt.Errorf("rewriter: %w", err)}
 			return
 		}
 
 		// Execute
-		if err = execCommandGraph(thread, ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, syncMode, dedup); err != nil {
-			*errString = fmt.Sprintf("executor: %v", err)
+		unlock := order.lock(cmdgraph)
+		if n := order.removeWritten(cmdgraph); n > 0 {
+			log.Trace("[%d] skipping %d events already written", thread, n)
+		}
+		if err = execCommandGraph(thread, ctx, cat, cmdgraph, spr.source.Name, spr.source.Group, offsets, "",
+			spr.source.AuditColumns, syncMode, dedup); err != nil {
+			unlock()
+			*reterr = fmt.Errorf("executor: %w", err)
 			return
 		}
+		order.setWritten(cmdgraph)
+		unlock()
+		if ts := latestSourceTimestamp(cmdgraph); ts != "" {
+			spr.source.Status.Progress.SetSourceTimestamp(ts)
+		}
 
 		if eventReadCount > 0 && !spr.svr.opt.NoKafkaCommit {
-			_, err = consumer.Commit()
+			var committed []kafka.TopicPartition
+			if txns == nil {
+				committed, err = consumer.Commit()
+			} else if len(offsets) != 0 {
+				// Commit only up to the transactions that are
+				// still buffered.
+				committed, err = consumer.CommitOffsets(kafkaOffsets(offsets))
+			}
+			for _, p := range committed {
+				if p.Topic != nil && p.Offset >= 0 {
+					tp := status.TopicPartition{Topic: *p.Topic, Partition: p.Partition}
+					spr.source.Status.Progress.SetCommitted(tp, int64(p.Offset))
+				}
+			}
 			if err != nil {
 				e := err.(kafka.Error)
 				if e.IsFatal() {
@@ -356,13 +584,15 @@ func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, ca
 			}
 		}
 
+		updateProgress(consumer, spr.source)
+
 		if eventReadCount > 0 {
 			log.Debug("[%d] checkpoint: events=%d, commands=%d", thread, eventReadCount, cmdgraph.Commands.Len())
 		}
 
 		// Check if sync snapshot may have completed.
 		if syncMode != dsync.NoSync {
-			if spr.source.Status.Stream.Get() == status.StreamActive && cat.HoursSinceLastSnapshotRecord() > 3.0 {
+			if spr.source.Status.Stream.Get() == status.StreamActive && cat.HoursSinceLastSnapshotRecord(spr.source.Name) > 3.0 {
 				spr.source.Status.Sync.SnapshotComplete()
 				msg := fmt.Sprintf("source %q snapshot complete (deadline exceeded); consider running \"metadb endsync\"",
 					spr.source.Name)
@@ -374,23 +604,44 @@ func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, ca
 			}
 		}
 
-		if atomic.LoadInt32(rebalanceFlag) == 1 { // Exit thread on rebalance
-			log.Trace("[%d] rebalance", thread)
+		if atomic.LoadInt32(stopFlag) == 1 { // Exit thread if another thread has failed
+			log.Trace("[%d] stop", thread)
+			break
+		}
+		if ctx.Err() != nil { // Exit thread if the data source has been stopped
+			log.Trace("[%d] stop", thread)
 			break
 		}
 	}
 
 }
 
-func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *kafka.Consumer, cmdgraph *command.CommandGraph, schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix string, sourceLog *log.SourceLog, checkpointSegmentSize int) (int, error) {
-	kafkaPollTimeout := 100     // Poll timeout in milliseconds.
+// kafkaPollTimeout is the Kafka poll timeout in milliseconds.
+const kafkaPollTimeout = 100
+
+// messageReader reads the next message from a data source.  A nil message and
+// nil error indicate a poll timeout, and io.EOF indicates that there are no
+// more messages.
+type messageReader func() (*kafka.Message, error)
+
+// parseChangeEvents reads up to a checkpoint segment of change events and adds
+// the resulting commands to cmdgraph, using the filters and other options of
+// the data source spr.  The offset of the next message to be read from each
+// partition is recorded in offsets.
+func parseChangeEvents(cat *catalog.Catalog, spr *sproc, dedup *log.MessageSet, read messageReader, cmdgraph *command.CommandGraph, deadLetter func(*kafka.Message, error) error, offsets map[catalog.TopicPartition]int64, txns *txnBuffer) (int, error) {
 	pollTimeoutCountLimit := 20 // Maximum allowable number of consecutive poll timeouts.
 	pollLoopTimeout := 120.0    // Overall pool loop timeout in seconds.
 	snapshot := false
 	var eventReadCount int
 	pollTimeoutCount := 0
 	startTime := time.Now()
-	for x := 0; x < checkpointSegmentSize; x++ {
+	// A nil *catalog.Catalog stored in the interface would not compare
+	// equal to nil.
+	var columns command.ColumnCatalog
+	if cat != nil {
+		columns = cat
+	}
+	for x := 0; x < spr.svr.db.CheckpointSegmentSize; x++ {
 		// Catch the possibility of many poll timeouts between messages, because each
 		// poll timeouts takes kafkaPollTimeout ms.  This also provides an overall timeout
 		// for the poll loop.
@@ -400,8 +651,11 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 		}
 		var err error
 		var msg *kafka.Message
-		if msg, err = readChangeEvent(consumer, sourceLog, kafkaPollTimeout); err != nil {
-			return 0, fmt.Errorf("reading message from Kafka: %w", err)
+		if msg, err = read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fmt.Errorf("reading message: %w", err)
 		}
 		if msg == nil { // Poll timeout is indicated by the nil return.
 			pollTimeoutCount++
@@ -414,26 +668,76 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 			pollTimeoutCount = 0 // We are only interested in consecutive timeouts.
 		}
 		eventReadCount++
+		var tp catalog.TopicPartition
+		if msg.TopicPartition.Topic != nil {
+			// Record the offset of the next message to be read.
+			tp = catalog.TopicPartition{Topic: *msg.TopicPartition.Topic, Partition: msg.TopicPartition.Partition}
+			offsets[tp] = int64(msg.TopicPartition.Offset) + 1
+		}
 
 		var ce *change.Event
-		ce, err = change.NewEvent(msg)
+		ce, err = change.NewEvent(msg, spr.decoder)
 		if err != nil {
+			// If the schema registry could not be read, the
+			// message is not known to be invalid, and it is read
+			// again when the stream is restarted.
+			var rerr *avro.RegistryError
+			if errors.As(err, &rerr) {
+				return 0, &dberr.TransientError{Err: fmt.Errorf("decoding change event: %w", err)}
+			}
+			if deadLetter != nil {
+				if err = deadLetter(msg, err); err != nil {
+					return 0, err
+				}
+				continue
+			}
 			log.Error("%s", err)
 			ce = nil
 		}
 
-		c, snap, err := command.NewCommand(dedup, ce, schemaPassFilter, schemaStopFilter, tableStopFilter,
-			trimSchemaPrefix, addSchemaPrefix)
-		if err != nil {
-			log.Debug("%v", *ce)
-			return 0, fmt.Errorf("parsing command: %w", err)
+		// Transaction metadata records are used only to buffer
+		// transactions.
+		var txnID string
+		if txns != nil && ce != nil {
+			if t := ce.Transaction; t != nil {
+				switch {
+				case t.Status == "BEGIN":
+					txns.begin(t.ID, tp, ce.Offset)
+				case t.EventCount != nil:
+					txns.end(t.ID, *t.EventCount, tp, ce.Offset)
+				}
+				continue
+			}
+			if ce.Value != nil && ce.Value.Payload != nil {
+				txnID = ce.Value.Payload.TransactionID()
+			}
 		}
-		if c == nil {
-			continue
+
+		c, snap, err := command.NewCommand(dedup, ce, &spr.options, columns)
+		if err != nil {
+			if deadLetter != nil {
+				if err = deadLetter(msg, fmt.Errorf("parsing command: %w", err)); err != nil {
+					return 0, err
+				}
+				if txnID != "" {
+					txns.skip(txnID, tp, ce.Offset)
+				}
+				continue
+			}
+			if ce != nil {
+				log.Debug("%v", *ce)
+			}
+			return 0, &dberr.FatalError{Err: fmt.Errorf("parsing command: %w", err)}
 		}
 		if snap {
 			snapshot = true
 		}
+		if txnID != "" && txns.add(txnID, c, tp, ce.Offset) {
+			continue
+		}
+		if c == nil {
+			continue
+		}
 		_ = cmdgraph.Commands.PushBack(c)
 	}
 	commandsN := cmdgraph.Commands.Len()
@@ -441,11 +745,104 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 		log.Trace("read %d events", commandsN)
 	}
 	if snapshot {
-		cat.ResetLastSnapshotRecord()
+		cat.ResetLastSnapshotRecord(spr.source.Name)
 	}
 	return eventReadCount, nil
 }
 
+// assignStoredOffsets assigns partitions to a consumer, starting from the
+// offsets stored in the database.  Partitions that have no stored offset start
+// from the offset committed in Kafka.  If the stored offsets cannot be read,
+// the partitions are assigned but paused, so that no change events are read
+// from the committed offsets, and an error is returned.  If checkCommitted is
+// set, a committed offset that is earlier than the stored offset, for example
+// if the consumer group has been reset in Kafka, is reported but not used.
+func assignStoredOffsets(consumer *kafka.Consumer, cat *catalog.Catalog, source *sysdb.SourceConnector, partitions []kafka.TopicPartition, checkCommitted bool) error {
+	offsets, err := cat.ReadKafkaOffsets(source.Name, source.Group)
+	if err != nil {
+		if aerr := consumer.Assign(partitions); aerr == nil {
+			_ = consumer.Pause(partitions)
+		}
+		return fmt.Errorf("assigning partitions: %w", err)
+	}
+	committed := make(map[catalog.TopicPartition]kafka.Offset)
+	if checkCommitted && len(offsets) != 0 {
+		if c, err := consumer.Committed(partitions, 10000); err == nil {
+			for _, p := range c {
+				if p.Topic != nil {
+					committed[catalog.TopicPartition{Topic: *p.Topic, Partition: p.Partition}] = p.Offset
+				}
+			}
+		}
+	}
+	assign := make([]kafka.TopicPartition, len(partitions))
+	copy(assign, partitions)
+	for i, p := range assign {
+		if p.Topic == nil {
+			continue
+		}
+		tp := catalog.TopicPartition{Topic: *p.Topic, Partition: p.Partition}
+		if offset, ok := offsets[tp]; ok {
+			if c, ok := committed[tp]; ok && c >= 0 && int64(c) < offset {
+				log.Warning("source %q: %s[%d]: committed offset %d is earlier than stored offset %d; "+
+					"starting at stored offset", source.Name, *p.Topic, p.Partition, c, offset)
+			} else {
+				log.Debug("source %q: %s[%d]: starting at stored offset %d", source.Name, *p.Topic, p.Partition, offset)
+			}
+			assign[i].Offset = kafka.Offset(offset)
+		}
+	}
+	return consumer.Assign(assign)
+}
+
+// kafkaOffsets converts offsets to the form used by the Kafka client.
+func kafkaOffsets(offsets map[catalog.TopicPartition]int64) []kafka.TopicPartition {
+	tps := make([]kafka.TopicPartition, 0, len(offsets))
+	for tp, o := range offsets {
+		topic := tp.Topic
+		tps = append(tps, kafka.TopicPartition{Topic: &topic, Partition: tp.Partition, Offset: kafka.Offset(o)})
+	}
+	return tps
+}
+
+// updateProgress records the position, high watermark, and lag of each
+// partition assigned to the consumer.  The high watermarks are those cached by
+// the Kafka client, and so no request is made to the brokers.
+func updateProgress(consumer *kafka.Consumer, source *sysdb.SourceConnector) {
+	assigned, err := consumer.Assignment()
+	if err != nil || len(assigned) == 0 {
+		return
+	}
+	positions, err := consumer.Position(assigned)
+	if err != nil {
+		return
+	}
+	for _, p := range positions {
+		if p.Topic == nil || p.Offset < 0 { // No position if nothing has been read
+			continue
+		}
+		_, high, err := consumer.GetWatermarkOffsets(*p.Topic, p.Partition)
+		if err != nil || high < 0 {
+			continue
+		}
+		tp := status.TopicPartition{Topic: *p.Topic, Partition: p.Partition}
+		pp := source.Status.Progress.SetPosition(tp, int64(p.Offset), high)
+		metrics.ConsumerLag.Set(float64(pp.Lag()), source.Name, *p.Topic, strconv.Itoa(int(p.Partition)))
+	}
+}
+
+// latestSourceTimestamp returns the latest source timestamp of the commands
+// in cmdgraph.
+func latestSourceTimestamp(cmdgraph *command.CommandGraph) string {
+	var ts string
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		if t := e.Value.(*command.Command).SourceTimestamp; t > ts {
+			ts = t
+		}
+	}
+	return ts
+}
+
 func readChangeEvent(consumer *kafka.Consumer, sourceLog *log.SourceLog, kafkaPollTimeout int) (*kafka.Message, error) {
 	ev := consumer.Poll(kafkaPollTimeout)
 	if ev == nil {
@@ -486,6 +883,42 @@ func readChangeEvent(consumer *kafka.Consumer, sourceLog *log.SourceLog, kafkaPo
 	return nil, nil
 }
 
+// writeDeadLetter stores a change event that could not be parsed in the
+// dead-letter table, so that the stream can continue.  If the data source has
+// column rules, which cannot be applied to an event that was not parsed, only
+// the position of the event is stored and not its key and value.
+func writeDeadLetter(cat *catalog.Catalog, source *sysdb.SourceConnector, msg *kafka.Message, reason error, columnRules bool) error {
+	d := &catalog.DeadLetter{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Error:     reason.Error(),
+	}
+	if !columnRules {
+		d.Key = msg.Key
+		d.Value = msg.Value
+	}
+	if msg.TopicPartition.Topic != nil {
+		d.Topic = *msg.TopicPartition.Topic
+	}
+	written, err := cat.WriteDeadLetter(source.Name, d)
+	if err != nil {
+		return fmt.Errorf("dead letter: %w", err)
+	}
+	if written {
+		source.Status.DeadLetters.Add(1)
+		log.Warning("dead letter: %s[%d]@%d: %v", d.Topic, d.Partition, d.Offset, reason)
+	}
+	return nil
+}
+
+// setConfigOption sets a Kafka configuration property if the value is not
+// empty.
+func setConfigOption(config *kafka.ConfigMap, key, value string) {
+	if value != "" {
+		(*config)[key] = value
+	}
+}
+
 func logTraceCommand(thread int, c *command.Command) {
 	var schemaTable string
 	if c.SchemaName == "" {
@@ -511,57 +944,57 @@ func logTraceCommand(thread int, c *command.Command) {
 	log.Trace("%s", b.String())
 }
 
-func waitForConfig(svr *server) (*sproc, error) {
-	var databases = dbxToConnector(svr.db)
-	var sources []*sysdb.SourceConnector
-	var ready bool
-	var err error
-	for {
-		sources, ready, err = waitForConfigSource(svr)
-		if err != nil {
-			return nil, err
+// checkSources compares the enabled data sources with those that are
+// running.  It returns a new sproc for each enabled data source that is not
+// running, and the names of running data sources that are no longer enabled.
+// New data sources are added to the server state.
+func checkSources(svr *server, running map[string]context.CancelFunc) ([]*sproc, []string, error) {
+	svr.state.mu.Lock()
+	defer svr.state.mu.Unlock()
+
+	sources, err := sysdb.ReadSourceConnectors(svr.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	enabled := make(map[string]struct{})
+	var sprs []*sproc
+	for _, src := range sources {
+		if !src.Enable {
+			continue
 		}
-		if ready {
-			break
+		enabled[src.Name] = struct{}{}
+		if _, ok := running[src.Name]; ok {
+			continue
 		}
+		src.Status.Stream.Waiting()
+		svr.state.sources = append(svr.state.sources, src)
+		sprs = append(sprs, &sproc{
+			source:    src,
+			databases: dbxToConnector(svr.db),
+			svr:       svr,
+		})
 	}
-	var src *sysdb.SourceConnector = sources[0]
-	var spr = &sproc{
-		source:    src,
-		databases: databases,
-		svr:       svr,
+	var stop []string
+	for name := range running {
+		if _, ok := enabled[name]; !ok {
+			stop = append(stop, name)
+		}
 	}
-	return spr, nil
+	return sprs, stop, nil
 }
 
-func waitForConfigSource(svr *server) ([]*sysdb.SourceConnector, bool, error) {
+// removeSource removes a data source that has stopped from the server state.
+func removeSource(svr *server, name string) {
 	svr.state.mu.Lock()
 	defer svr.state.mu.Unlock()
 
-	// var databases []*sysdb.DatabaseConnector
-	var sources []*sysdb.SourceConnector
-	var err error
-	// if databases, err = sysdb.ReadDatabaseConnectors(); err != nil {
-	// 	return nil, nil, false, err
-	// }
-	if sources, err = sysdb.ReadSourceConnectors(svr.db); err != nil {
-		return nil, false, err
-	}
-	if len(sources) > 0 {
-		if sources[0].Enable {
-			// Reread connectors in case configuration was incomplete.
-			if sources, err = sysdb.ReadSourceConnectors(svr.db); err != nil {
-				return nil, false, err
-			}
-			if len(sources) > 0 {
-				sources[0].Status.Stream.Waiting()
-				svr.state.sources = sources
-			}
-			return sources, true, nil
+	sources := make([]*sysdb.SourceConnector, 0, len(svr.state.sources))
+	for _, s := range svr.state.sources {
+		if s.Name != name {
+			sources = append(sources, s)
 		}
 	}
-	time.Sleep(2 * time.Second)
-	return nil, false, nil
+	svr.state.sources = sources
 }
 
 func dbxToConnector(db *dbx.DB) []*sysdb.DatabaseConnector {
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/option"
+	"github.com/metadb-project/metadb/cmd/metadb/process"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// maxReplayLine is the maximum length of a line in a replay file.
+const maxReplayLine = 256 * 1024 * 1024
+
+// Replay reads change events from files instead of Kafka and writes them to
+// the database as if they had been read by the data source opt.Source.  The
+// server must not be running.
+func Replay(opt *option.Replay) error {
+	running, pid, err := process.IsServerRunning(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	if running {
+		return fmt.Errorf("lock file %q already exists and server (PID %d) appears to be running",
+			util.SystemPIDFileName(opt.Datadir), pid)
+	}
+	if err = process.WritePIDFile(opt.Datadir); err != nil {
+		return err
+	}
+	defer process.RemovePIDFile(opt.Datadir)
+
+	db, err := util.ReadConfigDatabase(opt.Datadir)
+	if err != nil {
+		return fmt.Errorf("reading configuration file: %w", err)
+	}
+	dp, err := dbx.NewPool(context.TODO(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		return fmt.Errorf("creating database connection pool: %w", err)
+	}
+	defer dp.Close()
+
+	// Check that database version is compatible.
+	if err = catalog.CheckDatabaseCompatible(dp); err != nil {
+		return err
+	}
+	cat, err := catalog.Initialize(db, dp)
+	if err != nil {
+		return err
+	}
+
+	spr, err := replaySource(db, dp, opt)
+	if err != nil {
+		return err
+	}
+	if spr.options.Origins, err = catalog.Origins(db); err != nil {
+		return err
+	}
+	syncMode, err := dsync.ReadSyncMode(dp, spr.source.Name)
+	if err != nil {
+		return fmt.Errorf("reading sync mode: %w", err)
+	}
+	dedup := log.NewMessageSet()
+
+	for _, name := range opt.Files {
+		log.Info("replaying %q", name)
+		if err = replayFile(context.TODO(), cat, spr, syncMode, dedup, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// replaySource looks up the data source configuration to be used for
+// replaying change events.
+func replaySource(db *dbx.DB, dp *pgxpool.Pool, opt *option.Replay) (*sproc, error) {
+	sources, err := sysdb.ReadSourceConnectors(db)
+	if err != nil {
+		return nil, err
+	}
+	var src *sysdb.SourceConnector
+	for _, s := range sources {
+		if s.Name == opt.Source {
+			src = s
+		}
+	}
+	if src == nil {
+		return nil, fmt.Errorf("data source %q does not exist", opt.Source)
+	}
+	if src.Type == "postgresql" {
+		return nil, fmt.Errorf("data source %q: type %q not supported for replay", src.Name, src.Type)
+	}
+	spr := &sproc{
+		source: src,
+		svr:    &server{opt: &option.Server{RewriteJSON: opt.RewriteJSON}, db: db, dp: dp},
+	}
+	if err = compileSourceFilters(spr); err != nil {
+		return nil, err
+	}
+	switch src.Format {
+	case "avro":
+		return nil, fmt.Errorf("data source %q: format %q not supported for replay", src.Name, src.Format)
+	case "json-schemaless":
+		spr.decoder = change.SchemalessDecoder{}
+	}
+	return spr, nil
+}
+
+func replayFile(ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	r := newReplayReader(f, name)
+	var total int
+	for !r.eof {
+		cmdgraph := command.NewCommandGraph()
+		n, err := parseChangeEvents(cat, spr, dedup, r.read, cmdgraph, nil, make(map[catalog.TopicPartition]int64), nil)
+		if err != nil {
+			return fmt.Errorf("parser: %w", err)
+		}
+		if err = rewriteCommandGraph(cmdgraph, spr.svr.opt.RewriteJSON, spr.columnRules, spr.source.ColumnHashKey); err != nil {
+			return fmt.Errorf("rewriter: %w", err)
+		}
+		// Kafka offsets are not stored, since the messages were not
+		// read from Kafka.
+		if err = execCommandGraph(0, ctx, cat, cmdgraph, spr.source.Name, spr.source.Group, nil, "",
+			spr.source.AuditColumns, syncMode, dedup); err != nil {
+			return fmt.Errorf("executor: %w", err)
+		}
+		total += n
+		log.Debug("replay: events=%d, commands=%d", n, cmdgraph.Commands.Len())
+	}
+	log.Info("replayed %d events from %q", total, name)
+	return nil
+}
+
+// replayReader reads messages from a file in one of two formats, which is
+// determined by the first line.  A file written by the server option
+// --logsource contains, for each message, a line "#" followed by a line
+// containing the key and a line containing the value.  Otherwise the file is
+// read as JSON Lines, with each line containing an object having the
+// properties "key" and "value", and optionally "topic", "partition", and
+// "offset".  If a message does not record its topic, its position is given as
+// the file name and the line number on which the message begins.
+type replayReader struct {
+	scanner   *bufio.Scanner
+	name      string
+	sourceLog bool
+	started   bool
+	line      int
+	eof       bool
+}
+
+func newReplayReader(r io.Reader, name string) *replayReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayLine)
+	return &replayReader{scanner: scanner, name: name}
+}
+
+// replayMessage is a message in JSON Lines format.
+type replayMessage struct {
+	Topic     *string         `json:"topic"`
+	Partition int32           `json:"partition"`
+	Offset    *int64          `json:"offset"`
+	Key       json.RawMessage `json:"key"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// read implements messageReader.  Blank lines are skipped.
+func (r *replayReader) read() (*kafka.Message, error) {
+	line, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	for len(bytes.TrimSpace(line)) == 0 {
+		if line, err = r.next(); err != nil {
+			return nil, err
+		}
+	}
+	if !r.started {
+		r.started = true
+		r.sourceLog = string(line) == "#"
+	}
+	name := r.name
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &name, Offset: kafka.Offset(r.line)},
+	}
+	if r.sourceLog {
+		if string(line) != "#" {
+			return nil, fmt.Errorf("line %d: expected \"#\"", r.line)
+		}
+		if msg.Key, err = r.nextField(); err != nil {
+			return nil, err
+		}
+		if msg.Value, err = r.nextField(); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+	var m replayMessage
+	if err = json.Unmarshal(line, &m); err != nil {
+		return nil, fmt.Errorf("line %d: %w", r.line, err)
+	}
+	if m.Topic != nil {
+		msg.TopicPartition.Topic = m.Topic
+	}
+	msg.TopicPartition.Partition = m.Partition
+	if m.Offset != nil {
+		msg.TopicPartition.Offset = kafka.Offset(*m.Offset)
+	}
+	msg.Key = jsonField(m.Key)
+	msg.Value = jsonField(m.Value)
+	return msg, nil
+}
+
+// next returns the next line, or io.EOF at the end of the file.
+func (r *replayReader) next() ([]byte, error) {
+	if !r.scanner.Scan() {
+		r.eof = true
+		if err := r.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line+1, err)
+		}
+		return nil, io.EOF
+	}
+	r.line++
+	return r.scanner.Bytes(), nil
+}
+
+// nextField returns a copy of the next line, which is the key or value of a
+// message in source log format.  An empty line is returned as nil.
+func (r *replayReader) nextField() ([]byte, error) {
+	line, err := r.next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected end of file", r.line)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), line...), nil
+}
+
+// jsonField returns the key or value of a message in JSON Lines format, which
+// is nil if it is missing or null.
+func jsonField(data json.RawMessage) []byte {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return data
+}
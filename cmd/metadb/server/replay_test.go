@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReplayReaderJSONLines(t *testing.T) {
+	f := `{"key": {"id": 1}, "value": {"a": "x"}}
+
+{"topic": "sensor.public.item", "partition": 2, "offset": 50, "key": {"id": 2}, "value": null}
+`
+	r := newReplayReader(strings.NewReader(f), "events.jsonl")
+	msg, err := r.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := msg.TopicPartition
+	if *tp.Topic != "events.jsonl" || tp.Partition != 0 || tp.Offset != 1 {
+		t.Errorf("got position %s[%d]@%d; want events.jsonl[0]@1", *tp.Topic, tp.Partition, tp.Offset)
+	}
+	if string(msg.Key) != `{"id": 1}` || string(msg.Value) != `{"a": "x"}` {
+		t.Errorf("got key %s, value %s", msg.Key, msg.Value)
+	}
+	if msg, err = r.read(); err != nil {
+		t.Fatal(err)
+	}
+	tp = msg.TopicPartition
+	if *tp.Topic != "sensor.public.item" || tp.Partition != 2 || tp.Offset != 50 {
+		t.Errorf("got position %s[%d]@%d; want sensor.public.item[2]@50", *tp.Topic, tp.Partition, tp.Offset)
+	}
+	if msg.Value != nil {
+		t.Errorf("got value %s; want nil", msg.Value)
+	}
+	if _, err = r.read(); err != io.EOF || !r.eof {
+		t.Errorf("got %v; want EOF", err)
+	}
+}
+
+func TestReplayReaderSourceLog(t *testing.T) {
+	f := "#\n{\"id\":1}\n{\"a\":\"x\"}\n#\n{\"id\":2}\n\n#\n{\"id\":3}\n"
+	r := newReplayReader(strings.NewReader(f), "source.log")
+	msg, err := r.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp := msg.TopicPartition; *tp.Topic != "source.log" || tp.Offset != 1 {
+		t.Errorf("got position %s@%d; want source.log@1", *tp.Topic, tp.Offset)
+	}
+	if string(msg.Key) != `{"id":1}` || string(msg.Value) != `{"a":"x"}` {
+		t.Errorf("got key %s, value %s", msg.Key, msg.Value)
+	}
+	if msg, err = r.read(); err != nil {
+		t.Fatal(err)
+	}
+	if tp := msg.TopicPartition; tp.Offset != 4 || msg.Value != nil {
+		t.Errorf("got offset %d, value %s; want 4, nil", tp.Offset, msg.Value)
+	}
+	if _, err = r.read(); err == nil || err == io.EOF {
+		t.Errorf("truncated message: got %v; want error", err)
+	}
+}
@@ -8,10 +8,10 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 )
 
-func rewriteCommandGraph(cmdgraph *command.CommandGraph, rewriteJSON bool) error {
+func rewriteCommandGraph(cmdgraph *command.CommandGraph, rewriteJSON bool, columnRules []command.ColumnRule, hashKey string) error {
 	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
 		// Rewrite command
-		if err := rewriteCommand(e, rewriteJSON); err != nil {
+		if err := rewriteCommand(e, rewriteJSON, columnRules, hashKey); err != nil {
 			log.Debug("%v", *(e.Value.(*command.Command)))
 			return err
 		}
@@ -19,7 +19,21 @@ func rewriteCommandGraph(cmdgraph *command.CommandGraph, rewriteJSON bool) error
 	return nil
 }
 
-func rewriteCommand(cmde *list.Element, rewriteJSON bool) error {
+func rewriteCommand(cmde *list.Element, rewriteJSON bool, columnRules []command.ColumnRule, hashKey string) error {
+	// Remove or mask columns before the data are copied into transformed
+	// tables.
+	if len(columnRules) != 0 {
+		if err := command.ApplyColumnRules(cmde.Value.(*command.Command), columnRules, hashKey); err != nil {
+			return err
+		}
+		// The key values of a replaced row must be masked in the
+		// same way.
+		if r := cmde.Value.(*command.Command).Replaces; r != nil {
+			if err := command.ApplyColumnRules(r, columnRules, hashKey); err != nil {
+				return err
+			}
+		}
+	}
 	// Rewrite JSON objects.
 	columns := cmde.Value.(*command.Command).Column
 	for i := range columns {
@@ -30,5 +44,13 @@ func rewriteCommand(cmde *list.Element, rewriteJSON bool) error {
 			}
 		}
 	}
+	// Rules may also refer to transformed tables.
+	if sub := cmde.Value.(*command.Command).Subcommands; sub != nil && len(columnRules) != 0 {
+		for e := sub.Front(); e != nil; e = e.Next() {
+			if err := command.ApplyColumnRules(e.Value.(*command.Command), columnRules, hashKey); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
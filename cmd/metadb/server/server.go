@@ -2,12 +2,13 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"os"
 	"os/signal"
-	"regexp"
 	"runtime/debug"
 	"strings"
 	"sync"
@@ -17,11 +18,14 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/libpq"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/marctab"
+	"github.com/metadb-project/metadb/cmd/metadb/metrics"
 	"github.com/metadb-project/metadb/cmd/metadb/option"
 	"github.com/metadb-project/metadb/cmd/metadb/process"
 	"github.com/metadb-project/metadb/cmd/metadb/runsql"
@@ -51,13 +55,13 @@ type serverstate struct {
 
 // sproc stores state for a single poll loop.
 type sproc struct {
-	schemaPassFilter []*regexp.Regexp
-	schemaStopFilter []*regexp.Regexp
-	tableStopFilter  []*regexp.Regexp
-	source           *sysdb.SourceConnector
-	databases        []*sysdb.DatabaseConnector
-	sourceLog        *log.SourceLog
-	svr              *server
+	options     command.SourceOptions
+	columnRules []command.ColumnRule
+	decoder     change.Decoder
+	source      *sysdb.SourceConnector
+	databases   []*sysdb.DatabaseConnector
+	sourceLog   *log.SourceLog
+	svr         *server
 }
 
 func Start(opt *option.Server) error {
@@ -181,7 +185,22 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 
 	go goCreateFunctions(*(svr.db))
 
-	go libpq.Listen(svr.opt.Listen, svr.opt.Port, svr.db, &svr.state.sources)
+	var tlsConfig *tls.Config
+	if svr.opt.TLSCert != "" && svr.opt.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(svr.opt.TLSCert, svr.opt.TLSKey)
+		if err != nil {
+			return fmt.Errorf("loading server certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if err := libpq.CheckAuth(svr.db); err != nil {
+		return err
+	}
+	go libpq.Listen(svr.opt.Listen, svr.opt.Port, tlsConfig, svr.db, &svr.state.sources)
+
+	if svr.opt.MetricsPort != "" {
+		go goServeMetrics(svr.opt.MetricsListen, svr.opt.MetricsPort)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -212,67 +231,48 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 	return nil
 }
 
-func isFolioModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
-	if err != nil {
-		return false, fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='folio' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %w", err)
-	default:
-		return true, nil
-	}
-}
-
-func isReshareModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
-	if err != nil {
-		return false, fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='reshare' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %w", err)
-	default:
-		return true, nil
+func goServeMetrics(host, port string) {
+	log.Debug("serving metrics on address %q, port %s", host, port)
+	if err := metrics.ListenAndServe(net.JoinHostPort(host, port)); err != nil {
+		log.Error("serving metrics: %v", err)
 	}
 }
 
-func goMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool) {
+// goMaintenance runs maintenance for a data source periodically, until ctx is
+// canceled.
+func goMaintenance(ctx context.Context, datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool) {
 	for {
-		time.Sleep(5 * time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Minute):
+		}
 		syncMode, err := dsync.ReadSyncMode(dp, source)
 		if err != nil {
 			log.Error("unable to read sync mode: %v", err)
 		}
 		if folio && syncMode == dsync.NoSync {
+			start := time.Now()
 			if err := marctab.RunMarctab(db, datadir, cat); err != nil {
 				log.Error("marc__t: %v", err)
 			}
+			metrics.MaintenanceDuration.Set(time.Since(start).Seconds(), source, "marctab")
 		}
 		if err := checkTimeDailyMaintenance(datadir, db, dp, cat, source, folio, reshare, syncMode); err != nil {
 			log.Error("%v", err)
 		}
-		time.Sleep(55 * time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(55 * time.Minute):
+		}
 	}
 }
 
 func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool, syncMode dsync.Mode) error {
 	var overdue bool
-	q := "SELECT CURRENT_TIMESTAMP > next_maintenance_time FROM metadb.maintenance"
-	err := dp.QueryRow(context.TODO(), q).Scan(&overdue)
+	q := "SELECT CURRENT_TIMESTAMP > next_maintenance_time FROM metadb.maintenance WHERE source_name=$1"
+	err := dp.QueryRow(context.TODO(), q, source).Scan(&overdue)
 	switch {
 	case errors.Is(err, pgx.ErrNoRows):
 		fallthrough
@@ -297,7 +297,10 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 			}
 			path := "sql_metadb/derived_tables"
 			schema := "folio_derived"
-			if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			start := time.Now()
+			err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source)
+			metrics.MaintenanceDuration.Set(time.Since(start).Seconds(), source, schema)
+			if err != nil {
 				log.Warning("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
 				if tries >= 12 {
 					break
@@ -317,7 +320,10 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 			ref := reshareRef
 			path := "reports"
 			schema := "report"
-			if err = sqlfunc.SQLFunc(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			start := time.Now()
+			err = sqlfunc.SQLFunc(datadir, cat, db, url, ref, path, schema, source)
+			metrics.MaintenanceDuration.Set(time.Since(start).Seconds(), source, schema)
+			if err != nil {
 				log.Warning("sqlfunc: %v: repository=%s ref=%s path=%s", err, url, ref, path)
 				if tries >= 12 {
 					break
@@ -336,7 +342,10 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 			ref := reshareRef
 			path := "sql/derived_tables"
 			schema := "reshare_derived"
-			if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			start := time.Now()
+			err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source)
+			metrics.MaintenanceDuration.Set(time.Since(start).Seconds(), source, schema)
+			if err != nil {
 				log.Warning("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
 				if tries >= 12 {
 					break
@@ -348,11 +357,20 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 		}
 	}
 
+	if syncMode == dsync.NoSync {
+		start := time.Now()
+		if err = pruneHistory(db, cat, source); err != nil {
+			log.Error("retention: %v", err)
+		}
+		metrics.MaintenanceDuration.Set(time.Since(start).Seconds(), source, "retention")
+	}
+
 	// Schedule next maintenance
 	q = "UPDATE metadb.maintenance " +
 		"SET next_maintenance_time = next_maintenance_time +" +
-		" make_interval(0, 0, 0, (EXTRACT(DAY FROM (CURRENT_TIMESTAMP - next_maintenance_time)) + 1)::integer)"
-	if _, err = dp.Exec(context.TODO(), q); err != nil {
+		" make_interval(0, 0, 0, (EXTRACT(DAY FROM (CURRENT_TIMESTAMP - next_maintenance_time)) + 1)::integer)" +
+		" WHERE source_name=$1"
+	if _, err = dp.Exec(context.TODO(), q, source); err != nil {
 		return fmt.Errorf("error updating maintenance time: %w", err)
 	}
 
@@ -364,6 +382,59 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 	return nil
 }
 
+// pruneHistory removes the history partitions of tables of a data source
+// that are older than the retention period defined for each table.  A
+// partition is removed only if all of its rows started and ended before the
+// beginning of the period, and no current row started in its year.  An error in removing a partition is logged, and
+// the remaining tables are pruned.
+func pruneHistory(db dbx.DB, cat *catalog.Catalog, source string) error {
+	// Read the current options of the data source.
+	sources, err := sysdb.ReadSourceConnectors(&db)
+	if err != nil {
+		return fmt.Errorf("reading data source %q: %w", source, err)
+	}
+	var src *sysdb.SourceConnector
+	for _, s := range sources {
+		if s.Name == source {
+			src = s
+			break
+		}
+	}
+	if src == nil || len(src.Retention) == 0 {
+		return nil
+	}
+	rules, err := catalog.ParseRetentionRules(src.Retention)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, t := range cat.AllTables(source) {
+		years := catalog.MatchRetention(rules, t.Schema, t.Table)
+		if years == 0 {
+			continue
+		}
+		cutoff := catalog.RetentionCutoff(now, years)
+		for _, y := range catalog.PrunableYears(cat.PartYears(t.Schema, t.Table), cutoff) {
+			removed, err := cat.RemovePartYear(t.Schema, t.Table, y, cutoff, src.RetentionArchive)
+			if err != nil {
+				log.Warning("retention: removing history of table %q for year %d: %v", t.String(), y, err)
+				break
+			}
+			if !removed {
+				// Later partitions are likely to have rows that
+				// ended even later.
+				break
+			}
+			if src.RetentionArchive {
+				log.Info("archived history of table %q for year %d", t.String(), y)
+			} else {
+				log.Info("removed history of table %q for year %d", t.String(), y)
+			}
+		}
+	}
+	return nil
+}
+
 /*
 func vacuumAll(db dbx.DB, cat *catalog.Catalog, folio bool) error {
 	dcsuper, err := db.ConnectSuper()
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// txnTimeout is the time to wait for the remaining change events of a source
+// transaction before the transaction is applied without them.
+const txnTimeout = 2 * time.Minute
+
+// txnBuffer holds the commands of source transactions until all of their
+// change events have been read, as determined by the Debezium transaction
+// metadata.  Complete transactions are released in the order in which they
+// ended in the source database.
+type txnBuffer struct {
+	source string
+	txns   map[string]*sourceTxn
+	ended  []*sourceTxn // Transactions in the order of their END records
+	// Transactions that have been released, with the time of release, so
+	// that late records for them are not buffered again.
+	done map[string]time.Time
+	// seq is the sequence number of the next new transaction.
+	seq int64
+}
+
+// sourceTxn is a source transaction that has not been released.
+type sourceTxn struct {
+	id       string
+	commands []*command.Command
+	read     int64 // Number of change events read
+	total    int64 // Number of change events in the transaction, or -1 if not known
+	seen     time.Time
+	endTime  time.Time
+	// seq orders transactions by their first message read, which within
+	// each partition is the order of their first offsets.
+	seq int64
+	// Offsets of the first message read for the transaction in each
+	// partition, including transaction metadata records.
+	offsets map[catalog.TopicPartition]int64
+}
+
+func newTxnBuffer(source string) *txnBuffer {
+	return &txnBuffer{
+		source: source,
+		txns:   make(map[string]*sourceTxn),
+		done:   make(map[string]time.Time),
+	}
+}
+
+func (b *txnBuffer) txn(id string) *sourceTxn {
+	t, ok := b.txns[id]
+	if !ok {
+		t = &sourceTxn{
+			id:      id,
+			total:   -1,
+			seen:    time.Now(),
+			seq:     b.seq,
+			offsets: make(map[catalog.TopicPartition]int64),
+		}
+		b.txns[id] = t
+		b.seq++
+	}
+	return t
+}
+
+// addOffset records that a message for transaction t has been read.
+func (t *sourceTxn) addOffset(tp catalog.TopicPartition, offset int64) {
+	if o, ok := t.offsets[tp]; !ok || offset < o {
+		t.offsets[tp] = offset
+	}
+}
+
+// isDone returns true if transaction id has already been released.
+func (b *txnBuffer) isDone(id string) bool {
+	_, ok := b.done[id]
+	return ok
+}
+
+// begin records a BEGIN record from the transaction metadata topic.
+func (b *txnBuffer) begin(id string, tp catalog.TopicPartition, offset int64) {
+	if b.isDone(id) {
+		return
+	}
+	b.txn(id).addOffset(tp, offset)
+}
+
+// end records an END record from the transaction metadata topic, which
+// provides the number of change events in the transaction.
+func (b *txnBuffer) end(id string, eventCount int64, tp catalog.TopicPartition, offset int64) {
+	if b.isDone(id) {
+		return
+	}
+	t := b.txn(id)
+	t.addOffset(tp, offset)
+	if t.total != -1 {
+		return // Duplicate record
+	}
+	t.total = eventCount
+	t.endTime = time.Now()
+	b.ended = append(b.ended, t)
+}
+
+// add records a change event that is part of a transaction.  The command c
+// may be nil if the event does not result in a command, e.g. because the
+// table is filtered out.  If the transaction has already been released, the
+// event is not buffered and false is returned.
+func (b *txnBuffer) add(id string, c *command.Command, tp catalog.TopicPartition, offset int64) bool {
+	if b.isDone(id) {
+		return false
+	}
+	t := b.txn(id)
+	t.addOffset(tp, offset)
+	t.read++
+	if c != nil {
+		t.commands = append(t.commands, c)
+	}
+	return true
+}
+
+// skip records a change event that is part of a transaction but was not
+// parsed, e.g. because it was written to the dead-letter table.  The event is
+// counted so that the transaction can be complete without it.
+func (b *txnBuffer) skip(id string, tp catalog.TopicPartition, offset int64) {
+	b.add(id, nil, tp, offset)
+}
+
+// release adds the commands of transactions that are complete to cmdgraph.
+// Transactions are released in the order in which they ended, and so a
+// transaction is held back while any transaction that ended before it is
+// incomplete.  Transactions that remain incomplete after txnTimeout are
+// released with a warning.  The number of transactions released is returned.
+func (b *txnBuffer) release(cmdgraph *command.CommandGraph, dedup *log.MessageSet) int {
+	now := time.Now()
+	for id, tm := range b.done {
+		if now.Sub(tm) >= txnTimeout {
+			delete(b.done, id)
+		}
+	}
+	n := 0
+	i := 0
+	for ; i < len(b.ended); i++ {
+		t := b.ended[i]
+		if t.read < t.total && now.Sub(t.endTime) < txnTimeout {
+			break
+		}
+		if t.read < t.total {
+			b.warn(dedup, fmt.Sprintf("source %q: transaction %s: applying %d of %d change events after timeout",
+				b.source, t.id, t.read, t.total))
+		}
+		b.releaseTxn(t, cmdgraph, now)
+		n++
+	}
+	b.ended = b.ended[i:]
+	// Transactions for which no END record has been read, for example
+	// because the transaction metadata topic is not being read, are
+	// released after the timeout, in the order of their first offsets.
+	var expired []*sourceTxn
+	for _, t := range b.txns {
+		if t.total == -1 && now.Sub(t.seen) >= txnTimeout {
+			expired = append(expired, t)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].seq < expired[j].seq })
+	for _, t := range expired {
+		if t.read > 0 {
+			b.warn(dedup, fmt.Sprintf("source %q: transaction %s: applying %d change events without END record",
+				b.source, t.id, t.read))
+			n++
+		}
+		b.releaseTxn(t, cmdgraph, now)
+	}
+	return n
+}
+
+func (b *txnBuffer) releaseTxn(t *sourceTxn, cmdgraph *command.CommandGraph, now time.Time) {
+	for _, c := range t.commands {
+		_ = cmdgraph.Commands.PushBack(c)
+	}
+	delete(b.txns, t.id)
+	b.done[t.id] = now
+}
+
+func (b *txnBuffer) warn(dedup *log.MessageSet, msg string) {
+	if dedup.Insert(msg) {
+		log.Warning("%s", msg)
+	}
+}
+
+// limitOffsets lowers the offsets, which are the offsets of the next messages
+// to be read, so that they do not extend past any message of a transaction
+// that is still buffered.  This ensures that buffered messages are read again
+// if the stream is restarted.
+func (b *txnBuffer) limitOffsets(offsets map[catalog.TopicPartition]int64) {
+	for _, t := range b.txns {
+		for tp, o := range t.offsets {
+			if next, ok := offsets[tp]; ok && o < next {
+				offsets[tp] = o
+			}
+		}
+	}
+}
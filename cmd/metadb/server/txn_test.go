@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// releasedTables returns the table names of the commands in cmdgraph.
+func releasedTables(cmdgraph *command.CommandGraph) string {
+	var s string
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		s += e.Value.(*command.Command).TableName
+	}
+	return s
+}
+
+func TestTxnBufferReleaseWithoutEnd(t *testing.T) {
+	log.Init(io.Discard, false, false)
+	dedup := log.NewMessageSet()
+	tp := catalog.TopicPartition{Topic: "db.s.t", Partition: 0}
+	b := newTxnBuffer("src")
+	b.add("b", &command.Command{TableName: "b"}, tp, 1)
+	b.add("a", &command.Command{TableName: "a"}, tp, 2)
+	b.begin("e", tp, 3) // No change events read
+	b.add("c", &command.Command{TableName: "c"}, tp, 4)
+	b.add("a", &command.Command{TableName: "a"}, tp, 5)
+
+	cmdgraph := command.NewCommandGraph()
+	if n := b.release(cmdgraph, dedup); n != 0 || cmdgraph.Commands.Len() != 0 {
+		t.Fatalf("before timeout: got %d released, %q; want none", n, releasedTables(cmdgraph))
+	}
+	offsets := map[catalog.TopicPartition]int64{tp: 6}
+	b.limitOffsets(offsets)
+	if offsets[tp] != 1 {
+		t.Errorf("before timeout: got offset %d; want 1", offsets[tp])
+	}
+
+	// Transactions without an END record are released in the order of
+	// their first offsets after the timeout, except those that have not
+	// yet timed out.
+	for _, id := range []string{"a", "b", "e"} {
+		b.txns[id].seen = time.Now().Add(-txnTimeout)
+	}
+	if n := b.release(cmdgraph, dedup); n != 2 {
+		t.Errorf("got %d released; want 2", n)
+	}
+	if got := releasedTables(cmdgraph); got != "baa" {
+		t.Errorf("got %q; want \"baa\"", got)
+	}
+	offsets = map[catalog.TopicPartition]int64{tp: 6}
+	b.limitOffsets(offsets)
+	if offsets[tp] != 4 {
+		t.Errorf("after timeout: got offset %d; want 4", offsets[tp])
+	}
+	if b.add("a", &command.Command{TableName: "a"}, tp, 6) {
+		t.Error("late event of released transaction: got buffered; want not buffered")
+	}
+}
+
+func TestTxnBufferReleaseOrder(t *testing.T) {
+	tp := catalog.TopicPartition{Topic: "db.s.t", Partition: 0}
+	dedup := log.NewMessageSet()
+	b := newTxnBuffer("src")
+	b.add("x", &command.Command{TableName: "x"}, tp, 1)
+	b.add("y", &command.Command{TableName: "y"}, tp, 2)
+	b.end("x", 2, tp, 3)
+	b.end("y", 1, tp, 4)
+
+	// y is complete, but x ended first and is still incomplete.
+	cmdgraph := command.NewCommandGraph()
+	if n := b.release(cmdgraph, dedup); n != 0 {
+		t.Errorf("got %d released; want 0", n)
+	}
+	b.add("x", &command.Command{TableName: "x"}, tp, 5)
+	if n := b.release(cmdgraph, dedup); n != 2 {
+		t.Errorf("got %d released; want 2", n)
+	}
+	if got := releasedTables(cmdgraph); got != "xxy" {
+		t.Errorf("got %q; want \"xxy\"", got)
+	}
+}
+
+func TestTxnBufferDeadLetter(t *testing.T) {
+	tp := catalog.TopicPartition{Topic: "db.s.t", Partition: 0}
+	dedup := log.NewMessageSet()
+	b := newTxnBuffer("src")
+	b.begin("t", tp, 10)
+	b.add("t", &command.Command{TableName: "a"}, tp, 11)
+	b.skip("t", tp, 12) // Written to the dead-letter table
+	b.add("t", &command.Command{TableName: "b"}, tp, 13)
+	b.end("t", 3, tp, 14)
+
+	offsets := map[catalog.TopicPartition]int64{tp: 15}
+	b.limitOffsets(offsets)
+	if offsets[tp] != 10 {
+		t.Errorf("before release: got offset %d; want 10", offsets[tp])
+	}
+	cmdgraph := command.NewCommandGraph()
+	if n := b.release(cmdgraph, dedup); n != 1 {
+		t.Errorf("got %d released; want 1", n)
+	}
+	if got := releasedTables(cmdgraph); got != "ab" {
+		t.Errorf("got %q; want \"ab\"", got)
+	}
+	offsets = map[catalog.TopicPartition]int64{tp: 15}
+	b.limitOffsets(offsets)
+	if offsets[tp] != 15 {
+		t.Errorf("after release: got offset %d; want 15", offsets[tp])
+	}
+}
@@ -185,7 +185,7 @@ func checkForDirectives(cat *catalog.Catalog, url, ref, fullpath string, input s
 			}
 			// Add table
 			if !cat.TableExists(requireTable) {
-				if err := cat.CreateNewTable(requireTable, false, &dbx.Table{}, source); err != nil {
+				if err := cat.CreateNewTable(nil, requireTable, false, &dbx.Table{}, source); err != nil {
 					return fmt.Errorf("creating new table: %s: %v", requireTable, err)
 				}
 			}
@@ -195,7 +195,7 @@ func checkForDirectives(cat *catalog.Catalog, url, ref, fullpath string, input s
 				t = "text"
 			}
 			dtype, dtypesize := command.MakeDataType(t)
-			if err := cat.AddColumn(requireTable, requireColumn, dtype, dtypesize); err != nil {
+			if err := cat.AddColumn(nil, requireTable, requireColumn, dtype, dtypesize); err != nil {
 				return fmt.Errorf("creating new column: %s.%s: %v", requireTable, requireColumn, err)
 			}
 			log.Debug("created column %s.%s", requireTable, requireColumn)
@@ -1,12 +1,21 @@
 package status
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Source struct {
-	Stream Stream
-	Sync   Sync
+	Stream      Stream
+	Sync        Sync
+	DeadLetters Counter
+	Progress    Progress
+	NextRetry   Time
+	LastError   Message
 }
 
 type Stream int32
@@ -96,3 +105,255 @@ func (sy *Sync) SnapshotComplete() {
 func (sy *Sync) set(s Sync) {
 	atomic.StoreInt32((*int32)(sy), int32(s))
 }
+
+// Counter is a count that may be updated concurrently.
+type Counter int64
+
+func (c *Counter) Get() int64 {
+	return atomic.LoadInt64((*int64)(c))
+}
+
+func (c *Counter) Set(n int64) {
+	atomic.StoreInt64((*int64)(c), n)
+}
+
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64((*int64)(c), n)
+}
+
+// Time is a time that may be updated concurrently.  The zero value indicates
+// that no time is set.
+type Time int64
+
+// Get returns the time, or the zero time if no time is set.
+func (t *Time) Get() time.Time {
+	n := atomic.LoadInt64((*int64)(t))
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func (t *Time) Set(tm time.Time) {
+	atomic.StoreInt64((*int64)(t), tm.UnixNano())
+}
+
+func (t *Time) Clear() {
+	atomic.StoreInt64((*int64)(t), 0)
+}
+
+// Message is a text message that may be updated concurrently.
+type Message struct {
+	mu  sync.Mutex
+	msg string
+}
+
+func (m *Message) Get() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.msg
+}
+
+func (m *Message) Set(msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msg = msg
+}
+
+func (m *Message) Clear() {
+	m.Set("")
+}
+
+// rateWindow is the number of seconds over which the event rate is averaged.
+const rateWindow = 60
+
+// Progress records how far a data source stream has been read and applied.
+// It may be updated concurrently.
+type Progress struct {
+	mu         sync.Mutex
+	partitions map[TopicPartition]*PartitionProgress
+	// sourceTimestamp is the latest source timestamp of a change event
+	// written to the database.
+	sourceTimestamp string
+	// events contains the number of events read during each of the last
+	// rateWindow seconds, indexed by Unix time modulo rateWindow.
+	events     [rateWindow]int64
+	eventsTime int64 // Unix time of the latest second in events
+	start      time.Time
+}
+
+// TopicPartition identifies a Kafka partition.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// PartitionProgress is the position of a stream in a Kafka partition.
+// Offsets are -1 if they are not known.
+type PartitionProgress struct {
+	Committed int64 // Last committed offset
+	Position  int64 // Offset of the next message to be read
+	High      int64 // High watermark
+}
+
+// Lag returns the number of messages in the partition after the last
+// committed offset, or after the current position if no offset has been
+// committed.
+func (p PartitionProgress) Lag() int64 {
+	offset := p.Committed
+	if offset < 0 {
+		offset = p.Position
+	}
+	if offset < 0 || p.High < 0 {
+		return -1
+	}
+	return max(p.High-offset, 0)
+}
+
+func (p *Progress) partition(tp TopicPartition) *PartitionProgress {
+	if p.partitions == nil {
+		p.partitions = make(map[TopicPartition]*PartitionProgress)
+	}
+	pp, ok := p.partitions[tp]
+	if !ok {
+		pp = &PartitionProgress{Committed: -1, Position: -1, High: -1}
+		p.partitions[tp] = pp
+	}
+	return pp
+}
+
+// SetPosition records the current position and high watermark of a
+// partition, and returns the updated progress of the partition.
+func (p *Progress) SetPosition(tp TopicPartition, position, high int64) PartitionProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pp := p.partition(tp)
+	pp.Position = position
+	pp.High = high
+	return *pp
+}
+
+// SetCommitted records the last committed offset of a partition.
+func (p *Progress) SetCommitted(tp TopicPartition, offset int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partition(tp).Committed = offset
+}
+
+// Remove removes a partition, for example after it has been revoked from a
+// consumer.
+func (p *Progress) Remove(tp TopicPartition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.partitions, tp)
+}
+
+// Lag returns the total lag of all partitions, or -1 if it is not known.
+func (p *Progress) Lag() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := int64(-1)
+	for _, pp := range p.partitions {
+		if lag := pp.Lag(); lag >= 0 {
+			total = max(total, 0) + lag
+		}
+	}
+	return total
+}
+
+// PartitionsString returns the progress of each partition, sorted by topic
+// and partition.
+func (p *Progress) PartitionsString() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tps := make([]TopicPartition, 0, len(p.partitions))
+	for tp := range p.partitions {
+		tps = append(tps, tp)
+	}
+	sort.Slice(tps, func(i, j int) bool {
+		if tps[i].Topic != tps[j].Topic {
+			return tps[i].Topic < tps[j].Topic
+		}
+		return tps[i].Partition < tps[j].Partition
+	})
+	var b strings.Builder
+	for i, tp := range tps {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		pp := p.partitions[tp]
+		_, _ = fmt.Fprintf(&b, "%s[%d]: committed=%s high=%s lag=%s", tp.Topic, tp.Partition,
+			offsetString(pp.Committed), offsetString(pp.High), offsetString(pp.Lag()))
+	}
+	return b.String()
+}
+
+func offsetString(offset int64) string {
+	if offset < 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%d", offset)
+}
+
+// SetSourceTimestamp records the source timestamp of a change event written
+// to the database, if it is later than any previously recorded.  Timestamps
+// are in the fixed-width format of command.Command.SourceTimestamp.
+func (p *Progress) SetSourceTimestamp(ts string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ts > p.sourceTimestamp {
+		p.sourceTimestamp = ts
+	}
+}
+
+// SourceTimestamp returns the latest source timestamp of a change event
+// written to the database, or "" if none has been written.
+func (p *Progress) SourceTimestamp() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sourceTimestamp
+}
+
+// AddEvents records that n change events have been read.
+func (p *Progress) AddEvents(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.advance(now)
+	p.events[p.eventsTime%rateWindow] += n
+}
+
+// EventsPerSecond returns the rate at which change events have been read,
+// averaged over the last minute.
+func (p *Progress) EventsPerSecond() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.advance(now)
+	var total int64
+	for _, n := range p.events {
+		total += n
+	}
+	seconds := min(now.Sub(p.start).Seconds(), rateWindow)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return float64(total) / seconds
+}
+
+// advance clears the counts of seconds that have passed since events was last
+// updated.  The caller must hold p.mu.
+func (p *Progress) advance(now time.Time) {
+	if p.start.IsZero() {
+		p.start = now
+	}
+	t := now.Unix()
+	if t-p.eventsTime >= rateWindow {
+		p.events = [rateWindow]int64{}
+	} else {
+		for i := p.eventsTime + 1; i <= t; i++ {
+			p.events[i%rateWindow] = 0
+		}
+	}
+	p.eventsTime = t
+}
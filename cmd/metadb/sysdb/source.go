@@ -22,7 +22,16 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 		"SELECT name,enable,coalesce(brokers,''),coalesce(security,''),coalesce(topics,''),"+
 		"coalesce(consumergroup,''),coalesce(schemapassfilter,''),coalesce(schemastopfilter,''),"+
 		"coalesce(tablestopfilter,''),coalesce(trimschemaprefix,''),coalesce(addschemaprefix,''),"+
-		"coalesce(module,'') FROM metadb.source")
+		"coalesce(module,''),coalesce(format,''),coalesce(schemaregistry,''),"+
+		"coalesce(concurrency,0),coalesce(syncconcurrency,0),"+
+		"coalesce(saslmechanism,''),coalesce(saslusername,''),coalesce(saslpassword,''),"+
+		"coalesce(sslca,''),coalesce(sslcert,''),coalesce(sslkey,''),coalesce(deadletter,false),"+
+		"coalesce(transactions,false),coalesce(type,'kafka'),coalesce(connection,''),"+
+		"coalesce(publication,''),coalesce(slot,''),coalesce(schemarename,''),coalesce(tablerename,''),"+
+		"coalesce(renamepreset,''),coalesce(columnrules,''),coalesce(columnhashkey,''),"+
+		"coalesce(rowfilters,''),coalesce(tablekeys,''),coalesce(fullrowkey,false),"+
+		"coalesce(auditcolumns,false),coalesce(retention,''),coalesce(retentionarchive,false) "+
+		"FROM metadb.source")
 	if err != nil {
 		return nil, err
 	}
@@ -39,14 +48,41 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 		var trimschemaprefix string
 		var addschemaprefix string
 		var module string
+		var format string
+		var schemaregistry string
+		var concurrency, syncconcurrency int
+		var saslmechanism, saslusername, saslpassword string
+		var sslca, sslcert, sslkey string
+		var deadletter, transactions bool
+		var typeName, connection, publication, slot string
+		var schemarename, tablerename, renamepreset string
+		var columnrules, columnhashkey, rowfilters, tablekeys string
+		var fullrowkey, auditcolumns bool
+		var retention string
+		var retentionarchive bool
 		if err := rows.Scan(&name, &enable, &brokers, &security, &topics, &consumergroup, &schemapassfilter,
 			&schemastopfilter, &tablestopfilter, &trimschemaprefix, &addschemaprefix,
-			&module); err != nil {
+			&module, &format, &schemaregistry, &concurrency, &syncconcurrency,
+			&saslmechanism, &saslusername, &saslpassword, &sslca, &sslcert, &sslkey, &deadletter,
+			&transactions, &typeName, &connection, &publication, &slot, &schemarename, &tablerename,
+			&renamepreset, &columnrules, &columnhashkey, &rowfilters, &tablekeys, &fullrowkey,
+			&auditcolumns, &retention, &retentionarchive); err != nil {
 			return nil, err
 		}
 		if security == "" {
 			security = "ssl"
 		}
+		if format == "" {
+			format = "json"
+		}
+		// During normal operation, the default is to run single-threaded to give
+		// priority to user queries.  During a sync process, concurrency is enabled.
+		if concurrency == 0 {
+			concurrency = 1
+		}
+		if syncconcurrency == 0 {
+			syncconcurrency = 32
+		}
 		src = append(src, &SourceConnector{
 			Name:             name,
 			Enable:           enable,
@@ -60,6 +96,33 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 			TrimSchemaPrefix: trimschemaprefix,
 			AddSchemaPrefix:  addschemaprefix,
 			Module:           module,
+			Format:           format,
+			SchemaRegistry:   schemaregistry,
+			Concurrency:      concurrency,
+			SyncConcurrency:  syncconcurrency,
+			SASLMechanism:    saslmechanism,
+			SASLUsername:     saslusername,
+			SASLPassword:     saslpassword,
+			SSLCA:            sslca,
+			SSLCert:          sslcert,
+			SSLKey:           sslkey,
+			DeadLetter:       deadletter,
+			Transactions:     transactions,
+			Type:             typeName,
+			Connection:       connection,
+			Publication:      publication,
+			Slot:             slot,
+			SchemaRename:     util.SplitList(schemarename),
+			TableRename:      util.SplitList(tablerename),
+			RenamePreset:     renamepreset,
+			ColumnRules:      util.SplitList(columnrules),
+			ColumnHashKey:    columnhashkey,
+			RowFilters:       util.SplitList(rowfilters),
+			TableKeys:        util.SplitList(tablekeys),
+			FullRowKey:       fullrowkey,
+			AuditColumns:     auditcolumns,
+			Retention:        util.SplitList(retention),
+			RetentionArchive: retentionarchive,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -35,6 +35,33 @@ type SourceConnector struct {
 	TrimSchemaPrefix string
 	AddSchemaPrefix  string
 	Module           string
+	Format           string
+	SchemaRegistry   string
+	Concurrency      int
+	SyncConcurrency  int
+	SASLMechanism    string
+	SASLUsername     string
+	SASLPassword     string
+	SSLCA            string
+	SSLCert          string
+	SSLKey           string
+	DeadLetter       bool
+	Transactions     bool
+	Type             string // "kafka" or "postgresql"
+	Connection       string
+	Publication      string
+	Slot             string
+	SchemaRename     []string
+	TableRename      []string
+	RenamePreset     string // "" or "folio"
+	ColumnRules      []string
+	ColumnHashKey    string
+	RowFilters       []string
+	TableKeys        []string
+	FullRowKey       bool
+	AuditColumns     bool
+	Retention        []string
+	RetentionArchive bool
 	Status           status.Source
 }
 
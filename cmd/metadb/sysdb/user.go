@@ -28,6 +28,7 @@ func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 	for _, t := range trackedTables {
 		tables = append(tables, t.Main())
 	}
+	funcs := tablesWithFuncs(trackedTables)
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "log"})
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "table_update"})
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "base_table"})
@@ -41,6 +42,9 @@ func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 				_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.SQL()+" FROM "+u)
 				_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.MainSQL()+" FROM "+u)
 				//_, _ = adb.Exec(nil, "REVOKE SELECT ON "+adb.HistoryTableSQL(&t)+" FROM "+u)
+				if _, ok := funcs[t]; ok {
+					revokeTableFunctions(dcsuper, &t, u)
+				}
 			} else {
 				// Grant if regex matches
 				if util.UserPerm(re, &t) {
@@ -48,10 +52,16 @@ func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 					_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.SQL()+" TO "+u)
 					_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.MainSQL()+" TO "+u)
 					//_, _ = adb.Exec(nil, "GRANT SELECT ON "+adb.HistoryTableSQL(&t)+" TO "+u)
+					if _, ok := funcs[t]; ok {
+						_, _ = dcsuper.Exec(context.TODO(), t.GrantFuncsSQL(u))
+					}
 				} else {
 					_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.SQL()+" FROM "+u)
 					_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.MainSQL()+" FROM "+u)
 					//_, _ = adb.Exec(nil, "REVOKE SELECT ON "+adb.HistoryTableSQL(&t)+" FROM "+u)
+					if _, ok := funcs[t]; ok {
+						revokeTableFunctions(dcsuper, &t, u)
+					}
 				}
 			}
 
@@ -88,6 +98,24 @@ func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 	log.Trace("updated user permissions")
 }
 
+// tablesWithFuncs returns the set of tracked tables that have point-in-time
+// query functions.
+func tablesWithFuncs(trackedTables []dbx.Table) map[dbx.Table]struct{} {
+	funcs := make(map[dbx.Table]struct{})
+	for _, t := range trackedTables {
+		if t.HasFuncs() {
+			funcs[t] = struct{}{}
+		}
+	}
+	return funcs
+}
+
+// revokeTableFunctions revokes access by a user to the point-in-time query
+// functions of a table.
+func revokeTableFunctions(dcsuper *pgx.Conn, table *dbx.Table, user string) {
+	_, _ = dcsuper.Exec(context.TODO(), table.RevokeFuncsSQL(user))
+}
+
 /*
 func ListUser(rq *api.UserListRequest) (*api.UserListResponse, error) {
 	sysMu.Lock()
@@ -0,0 +1,24 @@
+package sysdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestTablesWithFuncs(t *testing.T) {
+	short := dbx.Table{Schema: "sensor", Table: "air_temp"}
+	long := dbx.Table{Schema: "sensor", Table: strings.Repeat("t", 60)}
+	funcs := tablesWithFuncs([]dbx.Table{short, long})
+	if _, ok := funcs[short]; !ok {
+		t.Errorf("%s: got no functions; want functions", short)
+	}
+	if _, ok := funcs[long]; ok {
+		t.Errorf("%s: got functions; want none", long)
+	}
+	// Main tables are granted separately and have no functions.
+	if _, ok := funcs[short.Main()]; ok {
+		t.Errorf("%s: got functions; want none", short.Main())
+	}
+}
@@ -128,19 +128,19 @@ func runMigration(dp *pgxpool.Pool, cat *catalog.Catalog, dpLDP *pgxpool.Pool, s
 		table, _ := dbx.ParseTable(m.metadbTable)
 		if !cat.TableExists(&table) {
 			eout.Info("creating table %s__", m.metadbTable)
-			if err = cat.CreateNewTable(&table, false, &dbx.Table{}, source); err != nil {
+			if err = cat.CreateNewTable(nil, &table, false, &dbx.Table{}, source); err != nil {
 				return fmt.Errorf("creating table \"%s__\": %v", table, err)
 			}
 		}
 		c := &dbx.Column{Schema: table.Schema, Table: table.Table, Column: "id"}
 		if cat.Column(c) == nil {
-			if err = cat.AddColumn(&table, "id", command.UUIDType, 0); err != nil {
+			if err = cat.AddColumn(nil, &table, "id", command.UUIDType, 0); err != nil {
 				return fmt.Errorf("adding column \"id\" in table \"%s__\": %v", table, err)
 			}
 		}
 		c = &dbx.Column{Schema: table.Schema, Table: table.Table, Column: m.jsonColumn}
 		if cat.Column(c) == nil {
-			if err = cat.AddColumn(&table, m.jsonColumn, command.JSONType, 0); err != nil {
+			if err = cat.AddColumn(nil, &table, m.jsonColumn, command.JSONType, 0); err != nil {
 				return fmt.Errorf("adding column %q in table \"%s__\": %v", m.jsonColumn, table, err)
 			}
 		}
@@ -315,7 +315,7 @@ func makeRecordPartition(cat *catalog.Catalog, metadbTable dbx.Table, timestamp
 	if cat.PartYearExists(metadbTable.Schema, metadbTable.Table, year) {
 		return nil
 	}
-	if err := cat.AddPartYear(metadbTable.Schema, metadbTable.Table, year); err != nil {
+	if err := cat.AddPartYear(nil, metadbTable.Schema, metadbTable.Table, year); err != nil {
 		return fmt.Errorf("adding partition for table %q year %d: %v", metadbTable.Main().String(),
 			year, err)
 	}
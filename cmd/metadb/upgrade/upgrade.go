@@ -413,6 +413,22 @@ var updbList = []updbFunc{
 	updb22,
 	updb23,
 	updb24,
+	updb25,
+	updb26,
+	updb27,
+	updb28,
+	updb29,
+	updb30,
+	updb31,
+	updb32,
+	updb33,
+	updb34,
+	updb35,
+	updb36,
+	updb37,
+	updb38,
+	updb39,
+	updb40,
 }
 
 func updb8(opt *dbopt) error {
@@ -1681,6 +1697,529 @@ func updb24(opt *dbopt) error {
 	return nil
 }
 
+func updb25(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add source options for message format.
+	q := "ALTER TABLE metadb.source ADD COLUMN format text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "ALTER TABLE metadb.source ADD COLUMN schemaregistry text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 25); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb26(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add source options for consumer concurrency.
+	q := "ALTER TABLE metadb.source ADD COLUMN concurrency integer"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "ALTER TABLE metadb.source ADD COLUMN syncconcurrency integer"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 26); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb27(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add source options for SASL authentication and TLS certificates.
+	for _, c := range []string{"saslmechanism", "saslusername", "saslpassword", "sslca", "sslcert", "sslkey"} {
+		q := "ALTER TABLE metadb.source ADD COLUMN " + c + " text"
+		if _, err = tx.Exec(context.TODO(), q); err != nil {
+			return err
+		}
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 27); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb28(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add dead-letter table and source option.
+	if err = catalog.CreateTableDeadLetter(tx); err != nil {
+		return err
+	}
+	q := "ALTER TABLE metadb.source ADD COLUMN deadletter boolean"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 28); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb29(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Schedule maintenance separately for each data source.  Each data
+	// source is given a copy of the existing schedule.
+	q := "ALTER TABLE metadb.maintenance ADD COLUMN source_name varchar(63)"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "INSERT INTO metadb.maintenance (source_name, next_maintenance_time) " +
+		"SELECT s.name, m.next_maintenance_time FROM metadb.source s CROSS JOIN " +
+		"(SELECT next_maintenance_time FROM metadb.maintenance WHERE source_name IS NULL LIMIT 1) m"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "DELETE FROM metadb.maintenance WHERE source_name IS NULL"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "ALTER TABLE metadb.maintenance ADD PRIMARY KEY (source_name)"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 29); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb30(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add table for Kafka offsets.
+	if err = catalog.CreateTableKafkaOffset(tx); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 30); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb31(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	q := "ALTER TABLE metadb.source ADD COLUMN transactions boolean"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 31); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb32(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	q := "ALTER TABLE metadb.source ADD COLUMN type text, ADD COLUMN connection text, " +
+		"ADD COLUMN publication text, ADD COLUMN slot text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 32); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb33(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	q := "ALTER TABLE metadb.source ADD COLUMN schemarename text, ADD COLUMN tablerename text, " +
+		"ADD COLUMN renamepreset text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Schema names were previously always rewritten by the rules that are
+	// now in the "folio" preset; existing data sources keep them.
+	if _, err = tx.Exec(context.TODO(), "UPDATE metadb.source SET renamepreset = 'folio'"); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 33); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb34(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	q := "ALTER TABLE metadb.source ADD COLUMN columnrules text, ADD COLUMN columnhashkey text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 34); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb35(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN rowfilters text"); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 35); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb36(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN tablekeys text"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN fullrowkey boolean"); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 36); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb37(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN auditcolumns boolean"); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 37); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb38(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Read table names.
+	q := "SELECT schema_name, table_name FROM metadb.base_table ORDER BY schema_name, table_name"
+	rows, err := tx.Query(context.TODO(), q)
+	if err != nil {
+		return fmt.Errorf("selecting table names: %w", err)
+	}
+	tables := make([]dbx.Table, 0)
+	for rows.Next() {
+		var schema, table string
+		if err = rows.Scan(&schema, &table); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading table names: %w", err)
+		}
+		tables = append(tables, dbx.Table{Schema: schema, Table: table})
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("reading table names: %w", err)
+	}
+	rows.Close()
+	// Create point-in-time query functions.  Privileges are granted when
+	// user permissions are next updated by the server.
+	for _, t := range tables {
+		if !t.HasFuncs() {
+			eout.Warning("table name %q too long for point-in-time query functions; skipping functions", t)
+			continue
+		}
+		if err = catalog.CreateTableFunctions(tx, &t); err != nil {
+			return err
+		}
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 38); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb39(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN retention text"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(context.TODO(), "ALTER TABLE metadb.source ADD COLUMN retentionarchive boolean"); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 39); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb40(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add table recording completed snapshots of PostgreSQL data sources.
+	if err = catalog.CreateTablePGSnapshot(tx); err != nil {
+		return err
+	}
+	// Snapshots of existing replication slots are assumed to be complete.
+	q := "INSERT INTO metadb.pg_snapshot(source_name,slot_name)" +
+		"SELECT name,slot FROM metadb.source WHERE type='postgresql' AND slot IS NOT NULL"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 40); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
 //func toPostgresArray(slice []string) string {
 //	var b strings.Builder
 //	b.WriteString("ARRAY[")
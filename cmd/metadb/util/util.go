@@ -13,7 +13,7 @@ import (
 	"gopkg.in/ini.v1"
 )
 
-const DatabaseVersion = 24
+const DatabaseVersion = 40
 
 // MetadbVersion is defined at build time via -ldflags.
 var MetadbVersion = "(unknown version)"